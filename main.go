@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"local-review-go/script"
 	"local-review-go/src/config"
 	"local-review-go/src/config/mysql"
 	"local-review-go/src/config/redis"
@@ -8,6 +10,7 @@ import (
 	"local-review-go/src/logic"
 	"local-review-go/src/model"
 	"local-review-go/src/utils"
+	"local-review-go/src/utils/redisx"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -16,25 +19,46 @@ import (
 func main() {
 	r := gin.Default()
 	config.Init()
+	if err := script.LoadAll(context.Background(), redis.GetRedisClient()); err != nil {
+		logrus.Fatalf("load lua scripts failed: %v", err)
+	}
+	for _, client := range redis.GetLockClients() {
+		// RedLock 容忍少数节点不可用，预加载失败的节点在执行时回退 EVAL
+		if err := script.Preload(context.Background(), client); err != nil {
+			logrus.Warnf("preload lua scripts on lock node %s failed: %v", client.Options().Addr, err)
+		}
+	}
 
-	shopLogic := logic.NewShopLogic(logic.ShopLogicDeps{})
+	blooms := logic.NewBloomRegistry(redis.GetRedisClient(), utils.NewLocker())
+	healthHandler := handler.NewHealthHandler(blooms)
+	shopLogic := logic.NewShopLogic(logic.ShopLogicDeps{BloomFilter: blooms.Filter(logic.BloomShop)})
 	shopHandler := handler.NewShopHandler(shopLogic)
-	userLogic := logic.NewUserLogic()
+	userLogic := logic.NewUserLogic(blooms)
 	userHandler := handler.NewUserHandler(userLogic)
 	shopTypeLogic := logic.NewShopTypeLogic()
 	shopTypeHandler := handler.NewShopTypeHandler(shopTypeLogic)
-	voucherLogic := logic.NewVoucherLogic()
+	voucherLogic := logic.NewVoucherLogic(blooms)
 	voucherHandler := handler.NewVoucherHandler(voucherLogic)
-	voucherOrderLogic := logic.NewVoucherOrderLogic()
+	notificationLogic := logic.NewNotificationLogic()
+	notificationHandler := handler.NewNotificationHandler(notificationLogic)
+	messageLogic := logic.NewMessageLogic()
+	messageHandler := handler.NewMessageHandler(messageLogic)
+	creditLogic := logic.NewCreditLogic()
+	creditHandler := handler.NewCreditHandler(creditLogic)
+	voucherOrderLogic := logic.NewVoucherOrderLogic(notificationLogic, newIDGenerator(), blooms)
 	voucherOrderHandler := handler.NewVoucherOrderHandler(voucherOrderLogic)
-	blogLogic := logic.NewBlogLogic()
-	blogHandler := handler.NewBlogHandler(blogLogic)
-	followLogic := logic.NewFollowLogic()
-	followHandler := handler.NewFollowHandler(followLogic)
 	uploadLogic := logic.NewUploadLogic()
 	uploadHandler := handler.NewUploadHandler(uploadLogic)
+	blogLogic := logic.NewBlogLogic(shopLogic, uploadLogic, notificationLogic, blooms)
+	blogHandler := handler.NewBlogHandler(blogLogic)
+	followLogic := logic.NewFollowLogic(notificationLogic)
+	followHandler := handler.NewFollowHandler(followLogic)
 	statisticsLogic := logic.NewStatisticsLogic()
 	statisticsHandler := handler.NewStatisticsHandler(statisticsLogic)
+	shopReviewLogic := logic.NewShopReviewLogic(uploadLogic)
+	shopReviewHandler := handler.NewShopReviewHandler(shopReviewLogic)
+	blogCommentsLogic := logic.NewBlogCommentsLogic(notificationLogic)
+	blogCommentsHandler := handler.NewBlogCommentsHandler(blogCommentsLogic)
 
 	// Auto Migrate
 	mysql.GetMysqlDB().AutoMigrate(
@@ -48,6 +72,13 @@ func main() {
 		&model.SecKillVoucher{},
 		&model.VoucherOrder{},
 		&model.Follow{},
+		&model.ShopReview{},
+		&model.Notification{},
+		&model.Message{},
+		&model.Conversation{},
+		&model.CreditTxn{},
+		&model.CreditEntry{},
+		&model.LockFence{},
 	)
 
 	handler.ConfigRouter(r, handler.Handlers{
@@ -60,83 +91,43 @@ func main() {
 		Follow:       followHandler,
 		Upload:       uploadHandler,
 		Statistics:   statisticsHandler,
+		ShopReview:   shopReviewHandler,
+		BlogComments: blogCommentsHandler,
+		Notification: notificationHandler,
+		Message:      messageHandler,
+		Credit:       creditHandler,
+		Health:       healthHandler,
 	})
 	voucherOrderLogic.StartConsumers()
+	notificationLogic.StartWorkers()
+	voucherLogic.StartWorkers()
+	blogLogic.StartWorkers()
+	userLogic.StartWorkers()
+	followLogic.StartWorkers()
 
-	// Init BloomFilter (同步预热)
-	initBloomFilter(shopLogic)
+	// 布隆过滤器在后台预热，不阻塞服务启动
+	blooms.StartWorkers()
 
 	r.Run(":8088")
 
 }
 
-// initBloomFilter 异步预热布隆过滤器
-func initBloomFilter(shopLogic logic.ShopLogic) {
-	logrus.Info("Starting Bloom Filter pre-heating (async)...")
-
-	// 先设置一个空的布隆过滤器实例，避免nil指针
+// newIDGenerator 按 ID_GENERATOR 选择订单 ID 生成器：redis（默认）、segment 或 snowflake
+func newIDGenerator() redisx.IDGenerator {
 	client := redis.GetRedisClient()
-	bf := utils.NewBloomFilter(client, "bf:shop", 100000, 0.01)
-	shopLogic.SetBloomFilter(bf)
-
-	// 异步预热，不阻塞服务启动
-	go func() {
-		logrus.Info("Bloom Filter pre-heating started in background...")
-
-		// Query all shops from MySQL
-		var shops []model.Shop
-		err := mysql.GetMysqlDB().Select("id").Find(&shops).Error
+	switch kind := config.GetEnv("ID_GENERATOR", "redis"); kind {
+	case "segment":
+		return redisx.NewSegmentWorker(client, redisx.DEFAULT_SEGMENT_STEP)
+	case "snowflake":
+		worker, err := utils.NewSnowflakeWorker(context.Background(), client)
 		if err != nil {
-			logrus.Errorf("Failed to query shops for Bloom Filter pre-heating: %v", err)
-			return
-		}
-
-		if len(shops) == 0 {
-			logrus.Info("No shops found for Bloom Filter pre-heating")
-			return
+			logrus.Fatalf("init snowflake id generator failed: %v", err)
 		}
-
-		// 真正的批量添加：收集ID，一次性执行Pipeline
-		batchSize := 500 // 增大批次大小，减少Redis往返次数
-		totalCount := 0
-		successCount := 0
-
-		for i := 0; i < len(shops); i += batchSize {
-			end := i + batchSize
-			if end > len(shops) {
-				end = len(shops)
-			}
-
-			// 收集当前批次的ID
-			batchIds := make([]int64, 0, end-i)
-			for j := i; j < end; j++ {
-				batchIds = append(batchIds, shops[j].Id)
-			}
-
-			// 批量添加到布隆过滤器（一次Redis往返）
-			err := bf.AddBatch(batchIds)
-			if err != nil {
-				logrus.Warnf("Failed to add batch [%d-%d] to Bloom Filter: %v", i, end-1, err)
-				// 批量失败时，回退到单个添加（容错处理）
-				for _, id := range batchIds {
-					if err := bf.Add(id); err != nil {
-						logrus.Warnf("Failed to add shop %d to Bloom Filter: %v", id, err)
-					} else {
-						successCount++
-					}
-				}
-			} else {
-				successCount += len(batchIds)
-			}
-
-			totalCount = end
-
-			// 每处理一批后记录进度
-			if totalCount%1000 == 0 || end == len(shops) {
-				logrus.Infof("Bloom Filter pre-heating progress: %d/%d shops (success: %d)", totalCount, len(shops), successCount)
-			}
-		}
-
-		logrus.Infof("Bloom Filter pre-heating completed: %d/%d shops loaded successfully", successCount, len(shops))
-	}()
+		return worker
+	case "redis":
+		return redisx.RedisWork
+	default:
+		logrus.Fatalf("unknown ID_GENERATOR %q", kind)
+		return nil
+	}
 }
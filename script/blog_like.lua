@@ -0,0 +1,16 @@
+-- version: 1
+-- 原子地切换点赞状态，并记录待写回 MySQL 的增量
+-- KEYS[1] blog:like:{id}  KEYS[2] 增量 hash
+-- ARGV[1] userId  ARGV[2] 点赞时间  ARGV[3] blogId
+-- 返回 {是否点赞, 当前点赞数}
+local liked
+if redis.call("zscore", KEYS[1], ARGV[1]) then
+	redis.call("zrem", KEYS[1], ARGV[1])
+	redis.call("hincrby", KEYS[2], ARGV[3], -1)
+	liked = 0
+else
+	redis.call("zadd", KEYS[1], ARGV[2], ARGV[1])
+	redis.call("hincrby", KEYS[2], ARGV[3], 1)
+	liked = 1
+end
+return {liked, redis.call("zcard", KEYS[1])}
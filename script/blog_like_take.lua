@@ -0,0 +1,8 @@
+-- version: 1
+-- 把待写回的点赞增量 hash 改名为本次写回私有的 key，没有增量时返回 0
+-- KEYS[1] 增量 hash  KEYS[2] 写回中的 key
+if redis.call("exists", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("rename", KEYS[1], KEYS[2])
+return 1
@@ -0,0 +1,10 @@
+-- version: 1
+-- 可扩展布隆过滤器增加一层，代与层数已被其他实例修改（已扩容或已重建）时放弃
+-- KEYS[1] 元数据 hash  ARGV[1] 期望的代  ARGV[2] 期望的层数  ARGV[3] 最大层数
+local gen = redis.call("hget", KEYS[1], "gen") or "0"
+local layers = tonumber(redis.call("hget", KEYS[1], "layers") or "1")
+if gen ~= ARGV[1] or layers ~= tonumber(ARGV[2]) or layers >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call("hset", KEYS[1], "gen", gen, "layers", layers + 1)
+return 1
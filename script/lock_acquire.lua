@@ -0,0 +1,29 @@
+-- version: 2
+-- 获取可重入读写锁，互斥锁即写锁。锁为 hash：mode -> read/write，持有者令牌 -> 持有次数
+-- 读锁之间共享；写锁只能由持有者重入，持有写锁时也可以再获取读锁；不支持读锁升级为写锁
+-- 每次新获取写锁时递增 fencing token，读锁与重入返回当前值
+-- KEYS[1] 锁 key  KEYS[2] fencing token 计数器  ARGV[1] 持有者令牌  ARGV[2] 过期毫秒数  ARGV[3] read/write
+-- 获取成功返回 {1, fencing token}，否则返回 {0, 锁的剩余毫秒数}
+local function currentFence()
+	return tonumber(redis.call("get", KEYS[2]) or "0")
+end
+
+local mode = redis.call("hget", KEYS[1], "mode")
+if not mode then
+	redis.call("hset", KEYS[1], "mode", ARGV[3], ARGV[1], 1)
+	redis.call("pexpire", KEYS[1], ARGV[2])
+	if ARGV[3] == "write" then
+		return {1, redis.call("incr", KEYS[2])}
+	end
+	return {1, currentFence()}
+end
+
+local reentrant = mode == "write" and redis.call("hexists", KEYS[1], ARGV[1]) == 1
+if reentrant or (mode == "read" and ARGV[3] == "read") then
+	redis.call("hincrby", KEYS[1], ARGV[1], 1)
+	redis.call("pexpire", KEYS[1], ARGV[2])
+	return {1, currentFence()}
+end
+
+local ttl = redis.call("pttl", KEYS[1])
+return {0, math.max(ttl, 1)}
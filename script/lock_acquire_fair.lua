@@ -0,0 +1,48 @@
+-- version: 2
+-- 获取公平的可重入互斥锁，等待者按到达顺序排队，只有队首能在锁空闲时获取
+-- KEYS[1] 锁 key  KEYS[2] 等待队列 list  KEYS[3] 等待者超时 zset  KEYS[4] fencing token 计数器
+-- ARGV[1] 持有者令牌  ARGV[2] 过期毫秒数  ARGV[3] 排队超时毫秒数  ARGV[4] 当前毫秒时间戳
+-- 获取成功返回 {1, fencing token}，否则返回 {0, 建议等待的毫秒数}
+local now = tonumber(ARGV[4])
+
+-- 移除队首超时未刷新的等待者
+while true do
+	local head = redis.call("lindex", KEYS[2], 0)
+	if not head then
+		break
+	end
+	local deadline = tonumber(redis.call("zscore", KEYS[3], head) or "0")
+	if deadline > now then
+		break
+	end
+	redis.call("lpop", KEYS[2])
+	redis.call("zrem", KEYS[3], head)
+end
+
+local mode = redis.call("hget", KEYS[1], "mode")
+if mode == "write" and redis.call("hexists", KEYS[1], ARGV[1]) == 1 then
+	redis.call("hincrby", KEYS[1], ARGV[1], 1)
+	redis.call("pexpire", KEYS[1], ARGV[2])
+	return {1, tonumber(redis.call("get", KEYS[4]) or "0")}
+end
+
+local head = redis.call("lindex", KEYS[2], 0)
+if not mode and (not head or head == ARGV[1]) then
+	if head then
+		redis.call("lpop", KEYS[2])
+		redis.call("zrem", KEYS[3], head)
+	end
+	redis.call("hset", KEYS[1], "mode", "write", ARGV[1], 1)
+	redis.call("pexpire", KEYS[1], ARGV[2])
+	return {1, redis.call("incr", KEYS[4])}
+end
+
+-- 排队或刷新排队超时
+if not redis.call("zscore", KEYS[3], ARGV[1]) then
+	redis.call("rpush", KEYS[2], ARGV[1])
+end
+redis.call("zadd", KEYS[3], now + tonumber(ARGV[3]), ARGV[1])
+redis.call("pexpire", KEYS[2], ARGV[3])
+redis.call("pexpire", KEYS[3], ARGV[3])
+
+return {0, math.max(redis.call("pttl", KEYS[1]), 1)}
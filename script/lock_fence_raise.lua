@@ -0,0 +1,8 @@
+-- version: 1
+-- 把 fencing token 计数器提升到不小于 ARGV[1]，RedLock 获取成功后让多数节点的计数器对齐
+-- KEYS[1] fencing token 计数器  ARGV[1] fencing token
+local current = tonumber(redis.call("get", KEYS[1]) or "0")
+if current < tonumber(ARGV[1]) then
+	redis.call("set", KEYS[1], ARGV[1])
+end
+return 0
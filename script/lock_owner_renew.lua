@@ -0,0 +1,7 @@
+-- version: 1
+-- 看门狗续期可重入读写锁，只在令牌仍持有锁时续期
+-- KEYS[1] 锁 key  ARGV[1] 持有者令牌  ARGV[2] 过期毫秒数
+if redis.call("hexists", KEYS[1], ARGV[1]) == 1 then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
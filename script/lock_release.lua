@@ -0,0 +1,23 @@
+-- version: 1
+-- 释放一次可重入读写锁，持有者的次数减到 0 时移除；锁上没有持有者时删除并通知等待者
+-- KEYS[1] 锁 key  KEYS[2] 释放通知频道  ARGV[1] 持有者令牌  ARGV[2] 过期毫秒数，不大于 0 时不续期
+-- 返回 -1 表示未持有，0 表示仍持有，1 表示该持有者已完全释放
+if redis.call("hexists", KEYS[1], ARGV[1]) == 0 then
+	return -1
+end
+
+local count = redis.call("hincrby", KEYS[1], ARGV[1], -1)
+if count > 0 then
+	if tonumber(ARGV[2]) > 0 then
+		redis.call("pexpire", KEYS[1], ARGV[2])
+	end
+	return 0
+end
+
+redis.call("hdel", KEYS[1], ARGV[1])
+-- 只剩 mode 字段时锁已空闲
+if redis.call("hlen", KEYS[1]) <= 1 then
+	redis.call("del", KEYS[1])
+	redis.call("publish", KEYS[2], ARGV[1])
+end
+return 1
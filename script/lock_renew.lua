@@ -0,0 +1,8 @@
+-- version: 1
+-- 看门狗续期，只续期令牌匹配的锁
+-- KEYS[1] 锁 key  ARGV[1] 令牌  ARGV[2] 过期秒数
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("EXPIRE", KEYS[1], ARGV[2])
+else
+	return 0
+end
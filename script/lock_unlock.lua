@@ -0,0 +1,8 @@
+-- version: 1
+-- 释放分布式锁，只删除令牌匹配的锁
+-- KEYS[1] 锁 key  ARGV[1] 令牌
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+else
+	return 0
+end
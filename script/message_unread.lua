@@ -0,0 +1,7 @@
+-- version: 1
+-- 只在未读计数已初始化时累加，未初始化的计数在读取时从 MySQL 重建
+-- KEYS[1] dm:unread:{userId}  ARGV[1] 对方 id  ARGV[2] 增量
+if redis.call("exists", KEYS[1]) == 0 then
+	return -1
+end
+return redis.call("hincrby", KEYS[1], ARGV[1], ARGV[2])
@@ -0,0 +1,12 @@
+-- version: 1
+-- 只在计数已初始化时累加，未初始化的计数在读取时从数据库重建
+-- KEYS[1] notify:unread:{userId}  ARGV[1] 类型  ARGV[2] 增量
+if redis.call("exists", KEYS[1]) == 0 then
+	return -1
+end
+local count = redis.call("hincrby", KEYS[1], ARGV[1], ARGV[2])
+if count < 0 then
+	redis.call("hset", KEYS[1], ARGV[1], 0)
+	count = 0
+end
+return count
@@ -0,0 +1,8 @@
+-- version: 1
+-- 切换用户对评价的"有用"标记，返回 1 表示标记、-1 表示取消
+-- KEYS[1] 评价的有用集合  ARGV[1] 用户 id
+if redis.call("srem", KEYS[1], ARGV[1]) == 1 then
+	return -1
+end
+redis.call("sadd", KEYS[1], ARGV[1])
+return 1
@@ -0,0 +1,150 @@
+// Package script 内嵌项目用到的 Lua 脚本并统一注册
+// 每个脚本文件首行以 "-- version: N" 声明版本，修改脚本内容时必须同时提升版本号
+package script
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"local-review-go/src/utils/redisx"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+//go:embed *.lua
+var files embed.FS
+
+var versionPattern = regexp.MustCompile(`^--\s*version:\s*(\d+)`)
+
+// ErrVersionConflict 同一版本号的脚本在 Redis 中登记了不同的 SHA，说明改了脚本却没有提升版本
+var ErrVersionConflict = errors.New("lua script changed without bumping version")
+
+// Script 带名称与版本的 Lua 脚本，Run 优先 EVALSHA，脚本缓存丢失时回退 EVAL
+type Script struct {
+	*redis.Script
+	Name    string
+	Version int
+}
+
+// Key 脚本在注册表中的字段名，形如 voucher_script:v1
+func (s *Script) Key() string {
+	return fmt.Sprintf("%s:v%d", s.Name, s.Version)
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]*Script{}
+)
+
+// 已注册的脚本
+var (
+	Seckill         = mustRegister("voucher_script")
+	SeckillRelease  = mustRegister("seckill_release")
+	LockUnlock      = mustRegister("lock_unlock")
+	LockRenew       = mustRegister("lock_renew")
+	LockAcquire     = mustRegister("lock_acquire")
+	LockAcquireFair = mustRegister("lock_acquire_fair")
+	LockRelease     = mustRegister("lock_release")
+	LockOwnerRenew  = mustRegister("lock_owner_renew")
+	LockFenceRaise  = mustRegister("lock_fence_raise")
+	BloomGrow       = mustRegister("bloom_grow")
+	ReviewHelpful   = mustRegister("review_helpful")
+	BlogLike        = mustRegister("blog_like")
+	BlogLikeTake    = mustRegister("blog_like_take")
+	MessageUnread   = mustRegister("message_unread")
+	NotifyUnread    = mustRegister("notify_unread")
+	SignMakeup      = mustRegister("sign_makeup")
+	SignLongest     = mustRegister("sign_longest")
+	SeckillAdjust   = mustRegister("seckill_adjust_stock")
+)
+
+// mustRegister 从内嵌文件读取 name.lua 并注册，文件缺失或未声明版本时直接 panic
+func mustRegister(name string) *Script {
+	src, err := files.ReadFile(name + ".lua")
+	if err != nil {
+		panic(fmt.Sprintf("read lua script %s: %v", name, err))
+	}
+	match := versionPattern.FindSubmatch(src)
+	if match == nil {
+		panic(fmt.Sprintf("lua script %s missing version header", name))
+	}
+	version, _ := strconv.Atoi(string(match[1]))
+
+	s := &Script{Script: redis.NewScript(string(src)), Name: name, Version: version}
+	mu.Lock()
+	registry[name] = s
+	mu.Unlock()
+	return s
+}
+
+// Get 按名称获取已注册的脚本
+func Get(name string) (*Script, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	s, ok := registry[name]
+	return s, ok
+}
+
+// All 按名称排序返回全部已注册的脚本
+func All() []*Script {
+	mu.RLock()
+	scripts := make([]*Script, 0, len(registry))
+	for _, s := range registry {
+		scripts = append(scripts, s)
+	}
+	mu.RUnlock()
+	sort.Slice(scripts, func(i, j int) bool { return scripts[i].Name < scripts[j].Name })
+	return scripts
+}
+
+// Preload 把全部脚本 SCRIPT LOAD 到 client，用于 RedLock 等不登记注册表的独立节点，
+// 避免节点上首次执行时才因 NOSCRIPT 回退 EVAL
+func Preload(ctx context.Context, client redis.UniversalClient) error {
+	for _, s := range All() {
+		if _, err := s.load(ctx, client); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load SCRIPT LOAD 并校验 Redis 返回的 SHA 与本地计算一致
+func (s *Script) load(ctx context.Context, client redis.UniversalClient) (string, error) {
+	sha, err := s.Load(ctx, client).Result()
+	if err != nil {
+		return "", fmt.Errorf("load lua script %s: %w", s.Key(), err)
+	}
+	if sha != s.Hash() {
+		return "", fmt.Errorf("lua script %s sha mismatch: redis=%s local=%s", s.Key(), sha, s.Hash())
+	}
+	return sha, nil
+}
+
+// LoadAll 启动时 SCRIPT LOAD 全部脚本并校验 Redis 返回的 SHA 与本地计算一致，
+// 再把 name:v{version} -> SHA 登记到注册表。同一版本已登记了不同的 SHA 时返回
+// ErrVersionConflict，避免滚动发布期间新旧实例以同一版本号执行不同的逻辑
+func LoadAll(ctx context.Context, client redis.UniversalClient) error {
+	for _, s := range All() {
+		sha, err := s.load(ctx, client)
+		if err != nil {
+			return err
+		}
+
+		if err := client.HSetNX(ctx, redisx.SCRIPT_REGISTRY_KEY, s.Key(), sha).Err(); err != nil {
+			return fmt.Errorf("register lua script %s: %w", s.Key(), err)
+		}
+		registered, err := client.HGet(ctx, redisx.SCRIPT_REGISTRY_KEY, s.Key()).Result()
+		if err != nil {
+			return fmt.Errorf("get registered lua script %s: %w", s.Key(), err)
+		}
+		if registered != sha {
+			return fmt.Errorf("%w: %s registered=%s local=%s", ErrVersionConflict, s.Key(), registered, sha)
+		}
+	}
+	return nil
+}
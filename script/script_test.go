@@ -0,0 +1,164 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"local-review-go/src/utils/redisx"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadAll(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	if err := LoadAll(ctx, client); err != nil {
+		t.Fatalf("load all: %v", err)
+	}
+	for _, s := range All() {
+		if got := mr.HGet(redisx.SCRIPT_REGISTRY_KEY, s.Key()); got != s.Hash() {
+			t.Fatalf("registered sha of %s = %q, want %q", s.Key(), got, s.Hash())
+		}
+	}
+	// 重复加载同一版本是幂等的
+	if err := LoadAll(ctx, client); err != nil {
+		t.Fatalf("reload all: %v", err)
+	}
+
+	// 另一个实例以相同版本登记了不同内容
+	mr.HSet(redisx.SCRIPT_REGISTRY_KEY, LockUnlock.Key(), "0000000000000000000000000000000000000000")
+	if err := LoadAll(ctx, client); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("load with conflicting sha: err = %v, want ErrVersionConflict", err)
+	}
+}
+
+func TestLockScripts(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	mr.Set("lock:test", "token")
+	if n, err := LockRenew.Run(ctx, client, []string{"lock:test"}, "other", 10).Int(); err != nil || n != 0 {
+		t.Fatalf("renew with wrong token = %d, %v", n, err)
+	}
+	if n, err := LockUnlock.Run(ctx, client, []string{"lock:test"}, "token").Int(); err != nil || n != 1 {
+		t.Fatalf("unlock = %d, %v", n, err)
+	}
+	if mr.Exists("lock:test") {
+		t.Fatal("lock still exists after unlock")
+	}
+}
+
+func TestReviewHelpfulScript(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	for i, want := range []int{1, -1, 1} {
+		n, err := ReviewHelpful.Run(ctx, client, []string{"review:helpful:1"}, 7).Int()
+		if err != nil || n != want {
+			t.Fatalf("toggle #%d = %d, %v, want %d", i, n, err, want)
+		}
+	}
+	if ok, _ := mr.SIsMember("review:helpful:1", "7"); !ok {
+		t.Fatal("user not marked after odd number of toggles")
+	}
+}
+
+func TestBlogLikeTakeScript(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	keys := []string{"delta:blog:like", "delta:blog:like:flushing:1"}
+	if n, err := BlogLikeTake.Run(ctx, client, keys).Int(); err != nil || n != 0 {
+		t.Fatalf("take without deltas = %d, %v", n, err)
+	}
+	mr.HSet(keys[0], "1", "3")
+	if n, err := BlogLikeTake.Run(ctx, client, keys).Int(); err != nil || n != 1 {
+		t.Fatalf("take deltas = %d, %v", n, err)
+	}
+	if mr.Exists(keys[0]) || mr.HGet(keys[1], "1") != "3" {
+		t.Fatal("deltas not moved to the flushing key")
+	}
+}
+
+func TestSeckillLegacyOrderSet(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	mr.HSet("seckill:meta:1", "begin", "0", "end", "9999999999999", "status", "1", "limitPerUser", "1", "shopId", "3")
+	mr.Set("seckill:stock:1", "5")
+	mr.SAdd("seckill:order:1", "7")
+
+	code, err := Seckill.Run(ctx, client, nil, "1", "7", "100", "0", 1000, "20240101").Int()
+	if err != nil || code != 2 {
+		t.Fatalf("seckill by legacy buyer = %d, %v, want user limit", code, err)
+	}
+	if code, err = Seckill.Run(ctx, client, nil, "1", "8", "101", "0", 1000, "20240101").Int(); err != nil || code != 0 {
+		t.Fatalf("seckill by new buyer = %d, %v, want ok", code, err)
+	}
+}
+
+func TestSeckillReleaseScript(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	mr.Set("seckill:stock:1", "5")
+	mr.HSet("seckill:count:1", "7", "1")
+	mr.HSet("seckill:count:1:20240101", "7", "1")
+	mr.HSet("seckill:shop:count:3", "7", "2")
+	mr.SAdd("seckill:order:1", "7")
+	keys := []string{"seckill:released:100", "seckill:stock:1", "seckill:count:1", "seckill:order:1",
+		"seckill:count:1:20240101", "seckill:shop:count:3"}
+
+	for i, want := range []int{1, 0} {
+		n, err := SeckillRelease.Run(ctx, client, keys, 7, 60, 1).Int()
+		if err != nil || n != want {
+			t.Fatalf("release #%d = %d, %v, want %d", i, n, err, want)
+		}
+	}
+	if stock, _ := mr.Get("seckill:stock:1"); stock != "6" {
+		t.Fatalf("stock = %s, want 6", stock)
+	}
+	for key, want := range map[string]string{"seckill:count:1": "0", "seckill:count:1:20240101": "0", "seckill:shop:count:3": "1"} {
+		if got := mr.HGet(key, "7"); got != want {
+			t.Fatalf("%s = %s, want %s", key, got, want)
+		}
+	}
+	if ok, _ := mr.SIsMember("seckill:order:1", "7"); ok {
+		t.Fatal("legacy order set still holds the user")
+	}
+}
+
+func TestSeckillAdjustScript(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	if err := SeckillAdjust.Run(ctx, client, []string{"seckill:stock:1"}, -1).Err(); !errors.Is(err, redis.Nil) {
+		t.Fatalf("adjust unloaded stock: err = %v, want redis.Nil", err)
+	}
+	mr.Set("seckill:stock:1", "3")
+	for i, c := range []struct{ delta, applied int }{{2, 2}, {-8, -5}} {
+		applied, err := SeckillAdjust.Run(ctx, client, []string{"seckill:stock:1"}, c.delta).Int()
+		if err != nil || applied != c.applied {
+			t.Fatalf("adjust #%d by %d = %d, %v, want %d", i, c.delta, applied, err, c.applied)
+		}
+	}
+	if stock, _ := mr.Get("seckill:stock:1"); stock != "0" {
+		t.Fatalf("stock = %s, want 0", stock)
+	}
+}
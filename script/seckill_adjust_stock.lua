@@ -0,0 +1,14 @@
+-- version: 1
+-- 已预热时同步调整 Redis 库存，调整后不低于 0
+-- KEYS[1] seckill:stock:{id}  ARGV[1] 增量
+-- 返回实际调整的数量，库存不足时只扣到 0；未预热时返回 nil
+if redis.call("exists", KEYS[1]) == 0 then
+	return false
+end
+local delta = tonumber(ARGV[1])
+local stock = redis.call("incrby", KEYS[1], delta)
+if stock < 0 then
+	redis.call("set", KEYS[1], 0)
+	return delta - stock
+end
+return delta
@@ -0,0 +1,27 @@
+-- version: 1
+-- 消费端未能创建秒杀订单时归还 Redis 中的扣减，每个订单只归还一次
+-- KEYS[1] 归还标记 seckill:released:{orderId}  KEYS[2] 库存  KEYS[3] 每人计数  KEYS[4] 旧版已购集合
+-- KEYS[5] 每日计数  KEYS[6] 店铺计数（旧版脚本投递的消息没有这两项）
+-- ARGV[1] userId  ARGV[2] 归还标记的过期秒数  ARGV[3] 为 1 时归还库存
+-- 返回 1 表示已归还，0 表示此前已归还过
+if not redis.call("set", KEYS[1], 1, "NX", "EX", ARGV[2]) then
+	return 0
+end
+
+-- 库存 key 不存在说明秒杀已结束或取消，不再重建
+if ARGV[3] == "1" and redis.call("exists", KEYS[2]) == 1 then
+	redis.call("incrby", KEYS[2], 1)
+end
+
+local function release(key)
+	if tonumber(redis.call("hget", key, ARGV[1]) or "0") > 0 then
+		redis.call("hincrby", key, ARGV[1], -1)
+	end
+end
+
+release(KEYS[3])
+redis.call("srem", KEYS[4], ARGV[1])
+for i = 5, #KEYS do
+	release(KEYS[i])
+end
+return 1
@@ -0,0 +1,9 @@
+-- version: 1
+-- 只在更长时更新最长连续签到天数
+-- KEYS[1] sign:stat:{userId}  ARGV[1] 连续天数
+local longest = tonumber(redis.call("hget", KEYS[1], "longest") or "0")
+if tonumber(ARGV[1]) > longest then
+	redis.call("hset", KEYS[1], "longest", ARGV[1])
+	return tonumber(ARGV[1])
+end
+return longest
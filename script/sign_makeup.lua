@@ -0,0 +1,16 @@
+-- version: 1
+-- 原子地检查补签次数并补签
+-- KEYS[1] 签到 bitmap  KEYS[2] 补签次数
+-- ARGV[1] 偏移量  ARGV[2] 每月次数  ARGV[3] 次数过期秒数
+-- 返回已使用次数，-1 表示该日已签到，-2 表示次数已用完
+if redis.call("getbit", KEYS[1], ARGV[1]) == 1 then
+	return -1
+end
+local used = tonumber(redis.call("get", KEYS[2]) or "0")
+if used >= tonumber(ARGV[2]) then
+	return -2
+end
+redis.call("setbit", KEYS[1], ARGV[1], 1)
+redis.call("incr", KEYS[2])
+redis.call("expire", KEYS[2], ARGV[3])
+return used + 1
@@ -1,24 +1,79 @@
+-- version: 2
+-- 秒杀下单：校验时间窗口、状态、库存与购买限制后扣库存并投递订单消息
 -- 1. get the argv
 local voucherId = ARGV[1]
 local userId = ARGV[2]
 local orderId = ARGV[3]
+local payType = ARGV[4] or "0"
+local now = tonumber(ARGV[5])
+local day = ARGV[6] or ""
 
--- 2. get the stock
+-- 返回码，与 voucher_order_logic.go 中的 seckill* 常量一致
+local OK, SOLD_OUT, USER_LIMIT, DAY_LIMIT, SHOP_LIMIT = 0, 1, 2, 3, 4
+local NOT_STARTED, ENDED, CLOSED, NOT_LOADED = 5, 6, 7, 8
+
+-- 2. get the stock and meta
 local stockKey = "seckill:stock:" .. voucherId
-local orderKey = "seckill:order:" .. voucherId
+local metaKey = "seckill:meta:" .. voucherId
 
--- 判断秒杀库存是否足够
-if tonumber(redis.call("get", stockKey)) <= 0 then
-	-- the stock is not enough
-	return 1
+local meta = redis.call("hmget", metaKey, "begin", "end", "status", "limitPerUser", "limitPerDay", "limitPerShop", "shopId")
+if not meta[1] then
+	return NOT_LOADED
 end
 
-if redis.call("sismember", orderKey, userId) == 1 then
-	return 2
+-- 判断秒杀时间与状态
+if now < tonumber(meta[1]) then
+	return NOT_STARTED
+end
+if now > tonumber(meta[2]) then
+	return ENDED
+end
+if tonumber(meta[3]) ~= 1 then
+	return CLOSED
+end
+
+-- 判断秒杀库存是否足够，进行中的秒杀库存尚未加载时由调用方加载后重试
+local stock = redis.call("get", stockKey)
+if not stock then
+	return NOT_LOADED
+end
+if tonumber(stock) <= 0 then
+	return SOLD_OUT
+end
+
+-- 判断购买限制，0 表示不限制
+local limitPerUser = tonumber(meta[4] or "1")
+local limitPerDay = tonumber(meta[5] or "0")
+local limitPerShop = tonumber(meta[6] or "0")
+local shopId = meta[7] or "0"
+
+-- hash: userId -> 已购数量；旧版脚本用 set 记录已购用户，进行中的旧秒杀仍按其判重
+local countKey = "seckill:count:" .. voucherId
+local legacyOrderKey = "seckill:order:" .. voucherId
+local dayCountKey = "seckill:count:" .. voucherId .. ":" .. day
+local shopCountKey = "seckill:shop:count:" .. shopId
+
+local bought = tonumber(redis.call("hget", countKey, userId) or "0")
+if bought == 0 and redis.call("sismember", legacyOrderKey, userId) == 1 then
+	bought = 1
+end
+if limitPerUser > 0 and bought >= limitPerUser then
+	return USER_LIMIT
+end
+if limitPerDay > 0 and tonumber(redis.call("hget", dayCountKey, userId) or "0") >= limitPerDay then
+	return DAY_LIMIT
+end
+if limitPerShop > 0 and tonumber(redis.call("hget", shopCountKey, userId) or "0") >= limitPerShop then
+	return SHOP_LIMIT
 end
 
 -- 3. update the data
 redis.call("incrby", stockKey, -1)
-redis.call("sadd", orderKey, userId)
-redis.call("xadd", "stream.orders", "*", "userId", userId, "voucherId", voucherId, "id", orderId)
-return 0
\ No newline at end of file
+redis.call("hincrby", countKey, userId, 1)
+redis.call("hincrby", dayCountKey, userId, 1)
+redis.call("expire", dayCountKey, 172800)
+redis.call("hincrby", shopCountKey, userId, 1)
+-- shopId、day 与 orderTime 供消费端按同一天、同一店铺检查限购，以及拒绝订单时归还计数
+redis.call("xadd", "stream.orders", "*", "userId", userId, "voucherId", voucherId, "id", orderId, "payType", payType,
+	"shopId", shopId, "day", day, "orderTime", ARGV[5])
+return OK
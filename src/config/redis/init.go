@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -14,7 +15,10 @@ const (
 	DBINDEX int = 0
 )
 
-var _defaultRDB *redis.Client
+var (
+	_defaultRDB *redis.Client
+	_lockRDBs   []*redis.Client // RedLock 使用的独立 Redis 节点
+)
 
 func Init() {
 	addrHost := getEnv("REDIS_ADDR", "127.0.0.1")
@@ -50,12 +54,58 @@ func Init() {
 
 	logrus.Info("Redis connection configured successfully")
 	_defaultRDB = rdb
+
+	initLockClients(password)
+}
+
+// initLockClients 读取 REDLOCK_ADDRS（逗号分隔的 host:port），为 RedLock 连接多个相互独立的 Redis 节点
+func initLockClients(password string) {
+	addrs := getEnv("REDLOCK_ADDRS", "")
+	if addrs == "" {
+		return
+	}
+
+	var clients []*redis.Client
+	for _, addr := range strings.Split(addrs, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		rdb := redis.NewClient(&redis.Options{
+			Addr:         addr,
+			Password:     password,
+			DB:           DBINDEX,
+			PoolSize:     20,
+			DialTimeout:  time.Second,
+			ReadTimeout:  500 * time.Millisecond,
+			WriteTimeout: 500 * time.Millisecond,
+		})
+		// 单个节点不可用时 RedLock 仍能以多数派工作，只记录日志
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if err := rdb.Ping(ctx).Err(); err != nil {
+			logrus.Warnf("Failed to connect to RedLock node %s: %v", addr, err)
+		}
+		cancel()
+		clients = append(clients, rdb)
+	}
+	logrus.Infof("RedLock configured with %d nodes", len(clients))
+	_lockRDBs = clients
 }
 
 func GetRedisClient() *redis.Client {
 	return _defaultRDB
 }
 
+// GetLockClients RedLock 使用的独立 Redis 节点，未配置时为空
+func GetLockClients() []*redis.Client {
+	return _lockRDBs
+}
+
+// SetRedisClient 替换默认客户端，用于测试中注入本地 Redis
+func SetRedisClient(rdb *redis.Client) {
+	_defaultRDB = rdb
+}
+
 // getEnv 获取环境变量，如果不存在则返回默认值（避免循环导入）
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
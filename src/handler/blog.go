@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"local-review-go/src/httpx"
 	"local-review-go/src/logic"
 	"local-review-go/src/middleware"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type BlogHandler struct {
@@ -44,12 +46,120 @@ func (h *BlogHandler) SaveBlog(c *gin.Context) {
 	id, err := h.logic.SaveBlog(ctx, userId, &blog)
 	if err != nil {
 		logrus.Error("[Blog handler] insert data into database failed!")
+		if errors.Is(err, logic.ErrBlogShopNotFound) {
+			c.JSON(http.StatusBadRequest, httpx.Fail[string]("shop not found"))
+			return
+		}
 		c.JSON(http.StatusOK, httpx.Fail[string]("insert failed!"))
 		return
 	}
 	c.JSON(http.StatusOK, httpx.OkWithData(id))
 }
 
+// @Description: edit the blog, only for the author
+// @Router:  /blog/:id [PUT]
+func (h *BlogHandler) UpdateBlog(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("invalid parameter"))
+		return
+	}
+
+	var blog model.Blog
+	if err := httpx.BindJSON(c, &blog); err != nil {
+		return
+	}
+	blog.Id = id
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.logic.UpdateBlog(ctx, user.Id, &blog); err != nil {
+		logrus.Error(err.Error())
+		writeBlogError(c, err, "update blog failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.Ok[string]())
+}
+
+// @Description: delete the blog, it can be restored within the retention window
+// @Router:  /blog/:id [DELETE]
+func (h *BlogHandler) DeleteBlog(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("invalid parameter"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.logic.DeleteBlog(ctx, id, user.Id); err != nil {
+		logrus.Error(err.Error())
+		writeBlogError(c, err, "delete blog failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.Ok[string]())
+}
+
+// @Description: restore the deleted blog
+// @Router:  /blog/restore/:id [PUT]
+func (h *BlogHandler) RestoreBlog(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("invalid parameter"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.logic.RestoreBlog(ctx, id, user.Id); err != nil {
+		logrus.Error(err.Error())
+		writeBlogError(c, err, "restore blog failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.Ok[string]())
+}
+
+// @Description: query my deleted blogs which can still be restored
+// @Router: /blog/of/deleted [GET]
+func (h *BlogHandler) QueryDeletedBlogs(c *gin.Context) {
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	blogs, err := h.logic.QueryDeletedBlogs(ctx, user.Id)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("query deleted blogs failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(blogs))
+}
+
 // @Description: modify the number of linked
 // @Router:  /blog/like/:id  [PUT]
 func (h *BlogHandler) LikeBlog(c *gin.Context) {
@@ -76,14 +186,18 @@ func (h *BlogHandler) LikeBlog(c *gin.Context) {
 	userId := user.Id
 
 	ctx := c.Request.Context()
-	err = h.logic.LikeBlog(ctx, id, userId)
+	result, err := h.logic.LikeBlog(ctx, id, userId)
 
 	if err != nil {
 		logrus.Error(err.Error())
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, httpx.Fail[string]("blog not found"))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("like failed!"))
 		return
 	}
-	c.JSON(http.StatusOK, httpx.Ok[string]())
+	c.JSON(http.StatusOK, httpx.OkWithData(result))
 }
 
 // @Description: get user rank of the blog
@@ -148,28 +262,22 @@ func (h *BlogHandler) QueryMyBlog(c *gin.Context) {
 	c.JSON(http.StatusOK, httpx.OkWithData[[]model.Blog](blogs))
 }
 
-// @Description: query the hot blog
+// @Description: query the hot blog, pass the cursor of the last page to get the next page
 // @Router: /blog/hot [GET]
 func (h *BlogHandler) QueryHotBlog(c *gin.Context) {
-	var currentStr = "1"
-	currentStr = c.Query("current")
-	if currentStr == "" {
-		currentStr = "1"
-	}
-	current, err := strconv.Atoi(currentStr)
-	if err != nil {
-		logrus.Error("transform type failed!")
-		c.JSON(http.StatusOK, httpx.Fail[string]("transform type failed!"))
-		return
-	}
+	cursor := c.Query("cursor")
 	ctx := c.Request.Context()
-	blogs, err := h.logic.QueryHotBlogs(ctx, current)
+	result, err := h.logic.QueryHotBlogs(ctx, cursor, redisx.MAXPAGESIZE)
 	if err != nil {
-		logrus.Error("query hot blogs failed!")
+		logrus.Error(err.Error())
+		if errors.Is(err, redisx.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, httpx.Fail[string]("cursor is invalid"))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("query hot blogs failed!"))
 		return
 	}
-	c.JSON(http.StatusOK, httpx.OkWithData[[]model.Blog](blogs))
+	c.JSON(http.StatusOK, httpx.OkWithData(result))
 }
 
 // @Description: Get Blog by id
@@ -197,28 +305,57 @@ func (h *BlogHandler) GetBlogById(c *gin.Context) {
 	c.JSON(http.StatusOK, httpx.OkWithData(blog))
 }
 
-// @Description: get the blog info of followed people
-// @Router: /blog/of/follow [GET]
-func (h *BlogHandler) QueryBlogOfFollow(c *gin.Context) {
-	lastIdStr := c.Query("lastId")
-	lastId, err := strconv.ParseInt(lastIdStr, 10, 64)
+// @Description: query the blogs of the shop, sortBy = hot | new
+// @Router: /blog/of/shop/:shopId [GET]
+func (h *BlogHandler) QueryBlogOfShop(c *gin.Context) {
+	shopId, err := strconv.ParseInt(c.Param("shopId"), 10, 64)
 	if err != nil {
 		logrus.Error(err.Error())
-		c.JSON(http.StatusBadRequest, httpx.Fail[string]("invalid parameter"))
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("shop id is invalid"))
 		return
 	}
 
-	offsetStr := c.Query("offset")
-	if offsetStr == "" {
-		offsetStr = "1"
+	currentStr := c.Query("current")
+	if currentStr == "" {
+		currentStr = "1"
+	}
+	current, err := strconv.Atoi(currentStr)
+	if err != nil || current < 1 {
+		logrus.Error("current is invalid")
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("current is invalid"))
+		return
 	}
 
-	offset, err := strconv.Atoi(offsetStr)
+	sortBy := c.Query("sortBy")
+	if sortBy == "" {
+		sortBy = model.BLOG_SORT_HOT
+	}
+	if sortBy != model.BLOG_SORT_HOT && sortBy != model.BLOG_SORT_NEW {
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("sortBy is invalid"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
 	if err != nil {
 		logrus.Error(err.Error())
-		c.JSON(http.StatusBadRequest, httpx.Fail[string]("invalid parameter"))
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	blogs, err := h.logic.QueryBlogOfShop(ctx, shopId, sortBy, current, user.Id)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("query blogs of shop failed!"))
 		return
 	}
+	c.JSON(http.StatusOK, httpx.OkWithData(blogs))
+}
+
+// @Description: get the blog info of followed people, cursor is empty for the first page
+// @Router: /blog/of/follow [GET]
+func (h *BlogHandler) QueryBlogOfFollow(c *gin.Context) {
+	cursor := c.Query("cursor")
 
 	user, err := middleware.GetUserInfo(c)
 	if err != nil {
@@ -230,12 +367,29 @@ func (h *BlogHandler) QueryBlogOfFollow(c *gin.Context) {
 	userId := user.Id
 
 	ctx := c.Request.Context()
-	r, err := h.logic.QueryBlogOfFollow(ctx, lastId, offset, userId, redisx.DEFAULTPAGESIZE)
+	r, err := h.logic.QueryBlogOfFollow(ctx, cursor, userId, redisx.DEFAULTPAGESIZE)
 
 	if err != nil {
 		logrus.Error(err.Error())
+		if errors.Is(err, redisx.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, httpx.Fail[string]("cursor is invalid"))
+			return
+		}
 		c.JSON(http.StatusOK, httpx.Fail[string]("failed to get result"))
 		return
 	}
 	c.JSON(http.StatusOK, httpx.OkWithData(r))
 }
+
+func writeBlogError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, logic.ErrBlogForbidden):
+		c.JSON(http.StatusForbidden, httpx.Fail[string](logic.ErrBlogForbidden.Error()))
+	case errors.Is(err, logic.ErrBlogShopNotFound):
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("shop not found"))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, httpx.Fail[string]("blog not found"))
+	default:
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string](fallback))
+	}
+}
@@ -1,6 +1,86 @@
 package handler
 
+import (
+	"errors"
+	"local-review-go/src/httpx"
+	"local-review-go/src/logic"
+	"local-review-go/src/middleware"
+	"local-review-go/src/model"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
 type BlogCommentsHandler struct {
+	logic logic.BlogCommentsLogic
+}
+
+func NewBlogCommentsHandler(blogCommentsLogic logic.BlogCommentsLogic) *BlogCommentsHandler {
+	return &BlogCommentsHandler{logic: blogCommentsLogic}
 }
 
-var blogCommentsHandle *BlogCommentsHandler
+// @Description: comment on the blog
+// @Router: /blog-comments [POST]
+func (h *BlogCommentsHandler) SaveComment(c *gin.Context) {
+	var comment model.BlogComments
+	if err := httpx.BindJSON(c, &comment); err != nil {
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	id, err := h.logic.SaveComment(ctx, user.Id, &comment)
+	if err != nil {
+		logrus.Error(err.Error())
+		switch {
+		case errors.Is(err, logic.ErrCommentInvalid):
+			c.JSON(http.StatusBadRequest, httpx.Fail[string](err.Error()))
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, httpx.Fail[string]("blog not found"))
+		default:
+			c.JSON(http.StatusInternalServerError, httpx.Fail[string]("comment failed!"))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(id))
+}
+
+// @Description: query the comments of the blog
+// @Router: /blog-comments/of/blog/:blogId [GET]
+func (h *BlogCommentsHandler) QueryCommentsOfBlog(c *gin.Context) {
+	blogId, err := strconv.ParseInt(c.Param("blogId"), 10, 64)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("blog id is invalid"))
+		return
+	}
+
+	currentStr := c.Query("current")
+	if currentStr == "" {
+		currentStr = "1"
+	}
+	current, err := strconv.Atoi(currentStr)
+	if err != nil || current < 1 {
+		logrus.Error("current is invalid")
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("current is invalid"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	comments, err := h.logic.QueryCommentsOfBlog(ctx, blogId, current)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("query comments failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(comments))
+}
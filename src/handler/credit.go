@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"local-review-go/src/httpx"
+	"local-review-go/src/logic"
+	"local-review-go/src/middleware"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type CreditHandler struct {
+	logic logic.CreditLogic
+}
+
+func NewCreditHandler(creditLogic logic.CreditLogic) *CreditHandler {
+	return &CreditHandler{logic: creditLogic}
+}
+
+// @Description: get my credits balance
+// @Router: /credits/balance [GET]
+func (h *CreditHandler) Balance(c *gin.Context) {
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	balance, err := h.logic.Balance(ctx, user.Id)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("query credits failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(balance))
+}
+
+// @Description: query my credits history, newest first
+// @Router: /credits/history [GET]
+func (h *CreditHandler) QueryHistory(c *gin.Context) {
+	currentStr := c.Query("current")
+	if currentStr == "" {
+		currentStr = "1"
+	}
+	current, err := strconv.Atoi(currentStr)
+	if err != nil || current < 1 {
+		logrus.Error("current is invalid")
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("current is invalid"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	entries, total, err := h.logic.QueryHistory(ctx, user.Id, current)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("query credits history failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithList(entries, total))
+}
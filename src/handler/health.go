@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"local-review-go/src/httpx"
+	"local-review-go/src/logic"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	blooms *logic.BloomRegistry
+}
+
+func NewHealthHandler(blooms *logic.BloomRegistry) *HealthHandler {
+	return &HealthHandler{blooms: blooms}
+}
+
+// Bloom 上报各布隆过滤器的代、元素数与误判率，任一过滤器无法读取时返回 503
+// @Router /health/bloom [GET]
+func (h *HealthHandler) Bloom(c *gin.Context) {
+	filters, healthy := h.blooms.Health(c.Request.Context())
+	result := httpx.OkWithData(filters)
+	status := http.StatusOK
+	if !healthy {
+		result.Success = false
+		result.ErrorMsg = "bloom filter unavailable"
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, result)
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"errors"
+	"local-review-go/src/httpx"
+	"local-review-go/src/logic"
+	"local-review-go/src/middleware"
+	"local-review-go/src/utils/redisx"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type MessageHandler struct {
+	logic logic.MessageLogic
+}
+
+func NewMessageHandler(messageLogic logic.MessageLogic) *MessageHandler {
+	return &MessageHandler{logic: messageLogic}
+}
+
+type sendMessageReq struct {
+	ToId    int64  `json:"toId" binding:"required"`
+	Content string `json:"content" binding:"required"`
+}
+
+// @Description: send a direct message to a mutual follower
+// @Router: /message [POST]
+func (h *MessageHandler) SendMessage(c *gin.Context) {
+	var req sendMessageReq
+	if err := httpx.BindJSON(c, &req); err != nil {
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	message, err := h.logic.SendMessage(ctx, user.Id, req.ToId, req.Content)
+	if err != nil {
+		logrus.Error(err.Error())
+		writeMessageError(c, err, "send message failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(message))
+}
+
+// @Description: query the message history with the peer, cursor is empty for the latest page
+// @Router: /message/history/:peerId [GET]
+func (h *MessageHandler) QueryHistory(c *gin.Context) {
+	peerId, err := strconv.ParseInt(c.Param("peerId"), 10, 64)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("invalid parameter"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	result, err := h.logic.QueryHistory(ctx, user.Id, peerId, c.Query("cursor"))
+	if err != nil {
+		logrus.Error(err.Error())
+		writeMessageError(c, err, "query history failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(result))
+}
+
+// @Description: sync messages after the cursor, wait (seconds) > 0 enables long polling
+// @Router: /message/sync [GET]
+func (h *MessageHandler) SyncMessages(c *gin.Context) {
+	var wait time.Duration
+	if waitStr := c.Query("wait"); waitStr != "" {
+		seconds, err := strconv.Atoi(waitStr)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, httpx.Fail[string]("wait is invalid"))
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	result, err := h.logic.SyncMessages(ctx, user.Id, c.Query("cursor"), wait)
+	if err != nil {
+		logrus.Error(err.Error())
+		writeMessageError(c, err, "sync messages failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(result))
+}
+
+// @Description: query my conversations
+// @Router: /message/conversations [GET]
+func (h *MessageHandler) QueryConversations(c *gin.Context) {
+	currentStr := c.Query("current")
+	if currentStr == "" {
+		currentStr = "1"
+	}
+	current, err := strconv.Atoi(currentStr)
+	if err != nil || current < 1 {
+		logrus.Error("current is invalid")
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("current is invalid"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	conversations, err := h.logic.QueryConversations(ctx, user.Id, current)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("query conversations failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(conversations))
+}
+
+// @Description: mark the conversation with the peer as read
+// @Router: /message/read/:peerId [PUT]
+func (h *MessageHandler) MarkConversationRead(c *gin.Context) {
+	peerId, err := strconv.ParseInt(c.Param("peerId"), 10, 64)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("invalid parameter"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.logic.MarkConversationRead(ctx, user.Id, peerId); err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("mark read failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, httpx.Ok[string]())
+}
+
+// @Description: get my unread message count
+// @Router: /message/unread [GET]
+func (h *MessageHandler) UnreadCount(c *gin.Context) {
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	count, err := h.logic.UnreadCount(ctx, user.Id)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("query unread count failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(count))
+}
+
+func writeMessageError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, logic.ErrNotMutualFollow):
+		c.JSON(http.StatusForbidden, httpx.Fail[string](logic.ErrNotMutualFollow.Error()))
+	case errors.Is(err, logic.ErrMessageInvalid):
+		c.JSON(http.StatusBadRequest, httpx.Fail[string](logic.ErrMessageInvalid.Error()))
+	case errors.Is(err, redisx.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("cursor is invalid"))
+	default:
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string](fallback))
+	}
+}
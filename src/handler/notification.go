@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"errors"
+	"local-review-go/src/httpx"
+	"local-review-go/src/logic"
+	"local-review-go/src/middleware"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type NotificationHandler struct {
+	logic logic.NotificationLogic
+}
+
+func NewNotificationHandler(notificationLogic logic.NotificationLogic) *NotificationHandler {
+	return &NotificationHandler{logic: notificationLogic}
+}
+
+// @Description: query my notifications, type = like | comment | follow | order, empty for all
+// @Router: /notification/list [GET]
+func (h *NotificationHandler) QueryNotifications(c *gin.Context) {
+	currentStr := c.Query("current")
+	if currentStr == "" {
+		currentStr = "1"
+	}
+	current, err := strconv.Atoi(currentStr)
+	if err != nil || current < 1 {
+		logrus.Error("current is invalid")
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("current is invalid"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	notifications, total, err := h.logic.QueryNotifications(ctx, user.Id, c.Query("type"), current)
+	if err != nil {
+		logrus.Error(err.Error())
+		writeNotificationError(c, err, "query notifications failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithList(notifications, total))
+}
+
+// @Description: get my unread notification count
+// @Router: /notification/unread [GET]
+func (h *NotificationHandler) UnreadCount(c *gin.Context) {
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	count, err := h.logic.UnreadCount(ctx, user.Id)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("query unread count failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(count))
+}
+
+// @Description: mark the notification as read
+// @Router: /notification/read/:id [PUT]
+func (h *NotificationHandler) MarkRead(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("invalid parameter"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.logic.MarkRead(ctx, id, user.Id); err != nil {
+		logrus.Error(err.Error())
+		writeNotificationError(c, err, "mark read failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.Ok[string]())
+}
+
+// @Description: mark all my notifications as read, optionally of one type
+// @Router: /notification/read-all [PUT]
+func (h *NotificationHandler) MarkAllRead(c *gin.Context) {
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.logic.MarkAllRead(ctx, user.Id, c.Query("type")); err != nil {
+		logrus.Error(err.Error())
+		writeNotificationError(c, err, "mark all read failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.Ok[string]())
+}
+
+func writeNotificationError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, logic.ErrNotificationType):
+		c.JSON(http.StatusBadRequest, httpx.Fail[string](logic.ErrNotificationType.Error()))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, httpx.Fail[string]("notification not found"))
+	default:
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string](fallback))
+	}
+}
@@ -17,10 +17,16 @@ type Handlers struct {
 	Follow       *FollowHandler
 	Upload       *UploadHandler
 	Statistics   *StatisticsHandler
+	ShopReview   *ShopReviewHandler
+	BlogComments *BlogCommentsHandler
+	Notification *NotificationHandler
+	Message      *MessageHandler
+	Credit       *CreditHandler
+	Health       *HealthHandler
 }
 
 func ConfigRouter(r *gin.Engine, handlers Handlers) {
-	if handlers.Shop == nil || handlers.User == nil || handlers.ShopType == nil || handlers.Voucher == nil || handlers.VoucherOrder == nil || handlers.Blog == nil || handlers.Follow == nil || handlers.Upload == nil || handlers.Statistics == nil {
+	if handlers.Shop == nil || handlers.User == nil || handlers.ShopType == nil || handlers.Voucher == nil || handlers.VoucherOrder == nil || handlers.Blog == nil || handlers.Follow == nil || handlers.Upload == nil || handlers.Statistics == nil || handlers.ShopReview == nil || handlers.BlogComments == nil || handlers.Notification == nil || handlers.Message == nil || handlers.Credit == nil || handlers.Health == nil {
 		panic("handlers not fully wired: please initialize all handlers before configuring routes")
 	}
 
@@ -45,6 +51,8 @@ func ConfigRouter(r *gin.Engine, handlers Handlers) {
 			userController.GET("/info/:id", handlers.User.Info)
 			userController.GET("/sign", handlers.User.sign)
 			userController.GET("/sign/count", handlers.User.SignCount)
+			userController.GET("/sign/calendar", handlers.User.SignCalendar)
+			userController.POST("/sign/makeup", handlers.User.MakeupSign)
 		}
 
 		shopController := authGroup.Group("/shop")
@@ -57,6 +65,15 @@ func ConfigRouter(r *gin.Engine, handlers Handlers) {
 			shopController.GET("/of/name", handlers.Shop.QueryShopByName)
 		}
 
+		shopReviewController := authGroup.Group("/shop-review")
+
+		{
+			shopReviewController.POST("", handlers.ShopReview.SaveReview)
+			shopReviewController.PUT("", handlers.ShopReview.UpdateReview)
+			shopReviewController.GET("/of/shop/:shopId", handlers.ShopReview.QueryReviewsOfShop)
+			shopReviewController.PUT("/helpful/:id", handlers.ShopReview.HelpfulReview)
+		}
+
 		voucherController := authGroup.Group("/voucher")
 
 		{
@@ -65,10 +82,23 @@ func ConfigRouter(r *gin.Engine, handlers Handlers) {
 			voucherController.GET("/list/:shopId", handlers.Voucher.QueryVoucherOfShop)
 		}
 
+		// 秒杀运营接口只对管理员开放
+		seckillAdminController := voucherController.Group("/seckill/:id", middleware.AdminRequired())
+
+		{
+			seckillAdminController.PUT("/stock", handlers.Voucher.AdjustSeckillStock)
+			seckillAdminController.PUT("/window", handlers.Voucher.UpdateSeckillWindow)
+			seckillAdminController.PUT("/pause", handlers.Voucher.PauseSeckill)
+			seckillAdminController.PUT("/resume", handlers.Voucher.ResumeSeckill)
+			seckillAdminController.PUT("/cancel", handlers.Voucher.CancelSeckill)
+			seckillAdminController.GET("/check", handlers.Voucher.CheckSeckillStock)
+		}
+
 		voucherOrderController := authGroup.Group("/voucher-order")
 
 		{
 			voucherOrderController.POST("/seckill/:id", handlers.VoucherOrder.SeckillVoucher)
+			voucherOrderController.POST("/credits/:id", handlers.VoucherOrder.PurchaseWithCredits)
 		}
 
 		blogController := authGroup.Group("/blog")
@@ -80,6 +110,18 @@ func ConfigRouter(r *gin.Engine, handlers Handlers) {
 			blogController.GET("/:id", handlers.Blog.GetBlogById)
 			blogController.GET("/likes/:id", handlers.Blog.QueryUserLiked)
 			blogController.GET("/of/follow", handlers.Blog.QueryBlogOfFollow)
+			blogController.GET("/of/shop/:shopId", handlers.Blog.QueryBlogOfShop)
+			blogController.GET("/of/deleted", handlers.Blog.QueryDeletedBlogs)
+			blogController.PUT("/:id", handlers.Blog.UpdateBlog)
+			blogController.DELETE("/:id", handlers.Blog.DeleteBlog)
+			blogController.PUT("/restore/:id", handlers.Blog.RestoreBlog)
+		}
+
+		blogCommentsController := authGroup.Group("/blog-comments")
+
+		{
+			blogCommentsController.POST("", handlers.BlogComments.SaveComment)
+			blogCommentsController.GET("/of/blog/:blogId", handlers.BlogComments.QueryCommentsOfBlog)
 		}
 
 		followContoller := authGroup.Group("/follow")
@@ -90,6 +132,33 @@ func ConfigRouter(r *gin.Engine, handlers Handlers) {
 			followContoller.GET("/or/not/:id", handlers.Follow.IsFollow)
 		}
 
+		notificationController := authGroup.Group("/notification")
+
+		{
+			notificationController.GET("/list", handlers.Notification.QueryNotifications)
+			notificationController.GET("/unread", handlers.Notification.UnreadCount)
+			notificationController.PUT("/read/:id", handlers.Notification.MarkRead)
+			notificationController.PUT("/read-all", handlers.Notification.MarkAllRead)
+		}
+
+		messageController := authGroup.Group("/message")
+
+		{
+			messageController.POST("", handlers.Message.SendMessage)
+			messageController.GET("/history/:peerId", handlers.Message.QueryHistory)
+			messageController.GET("/sync", handlers.Message.SyncMessages)
+			messageController.GET("/conversations", handlers.Message.QueryConversations)
+			messageController.PUT("/read/:peerId", handlers.Message.MarkConversationRead)
+			messageController.GET("/unread", handlers.Message.UnreadCount)
+		}
+
+		creditController := authGroup.Group("/credits")
+
+		{
+			creditController.GET("/balance", handlers.Credit.Balance)
+			creditController.GET("/history", handlers.Credit.QueryHistory)
+		}
+
 		uploadController := authGroup.Group("/upload")
 
 		{
@@ -127,4 +196,9 @@ func ConfigRouter(r *gin.Engine, handlers Handlers) {
 		statisticsGroup.GET("/uv/current", handlers.Statistics.QueryCurrentUV)
 	}
 
+	healthGroup := r.Group("/health")
+	{
+		healthGroup.GET("/bloom", handlers.Health.Bloom)
+	}
+
 }
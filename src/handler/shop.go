@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"local-review-go/src/httpx"
 	"local-review-go/src/logic"
@@ -44,7 +45,7 @@ func (h *ShopHandler) QueryShopById(c *gin.Context) {
 	if err != nil {
 		logrus.Error("query failed!")
 		// 根据错误类型判断状态码
-		if err.Error() == "shop not found (blocked by Bloom Filter)" {
+		if errors.Is(err, logic.ErrShopBlocked) {
 			c.JSON(http.StatusNotFound, httpx.Fail[string]("shop not found"))
 		} else {
 			c.JSON(http.StatusInternalServerError, httpx.Fail[string]("query failed!"))
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"errors"
+	"local-review-go/src/httpx"
+	"local-review-go/src/logic"
+	"local-review-go/src/middleware"
+	"local-review-go/src/model"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type ShopReviewHandler struct {
+	logic logic.ShopReviewLogic
+}
+
+func NewShopReviewHandler(shopReviewLogic logic.ShopReviewLogic) *ShopReviewHandler {
+	return &ShopReviewHandler{logic: shopReviewLogic}
+}
+
+// @Description: post a review of the shop
+// @Router: /shop-review [POST]
+func (h *ShopReviewHandler) SaveReview(c *gin.Context) {
+	var review model.ShopReview
+	if err := httpx.BindJSON(c, &review); err != nil {
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	id, err := h.logic.SaveReview(ctx, user.Id, &review)
+	if err != nil {
+		logrus.Error(err.Error())
+		writeReviewError(c, err, "save review failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(id))
+}
+
+// @Description: edit my review of the shop
+// @Router: /shop-review [PUT]
+func (h *ShopReviewHandler) UpdateReview(c *gin.Context) {
+	var review model.ShopReview
+	if err := httpx.BindJSON(c, &review); err != nil {
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.logic.UpdateReview(ctx, user.Id, &review); err != nil {
+		logrus.Error(err.Error())
+		writeReviewError(c, err, "update review failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.Ok[string]())
+}
+
+// @Description: query the reviews of the shop, sortBy = new | helpful
+// @Router: /shop-review/of/shop/:shopId [GET]
+func (h *ShopReviewHandler) QueryReviewsOfShop(c *gin.Context) {
+	shopId, err := strconv.ParseInt(c.Param("shopId"), 10, 64)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("shop id is invalid"))
+		return
+	}
+
+	currentStr := c.Query("current")
+	if currentStr == "" {
+		currentStr = "1"
+	}
+	current, err := strconv.Atoi(currentStr)
+	if err != nil || current < 1 {
+		logrus.Error("current is invalid")
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("current is invalid"))
+		return
+	}
+
+	sortBy := c.Query("sortBy")
+	if sortBy == "" {
+		sortBy = model.REVIEW_SORT_NEW
+	}
+	if sortBy != model.REVIEW_SORT_NEW && sortBy != model.REVIEW_SORT_HELPFUL {
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("sortBy is invalid"))
+		return
+	}
+
+	var userId int64
+	if user, err := middleware.GetUserInfo(c); err == nil {
+		userId = user.Id
+	}
+
+	ctx := c.Request.Context()
+	reviews, total, err := h.logic.QueryReviewsOfShop(ctx, shopId, sortBy, current, userId)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("query reviews failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithList(reviews, total))
+}
+
+// @Description: mark or unmark the review as helpful
+// @Router: /shop-review/helpful/:id [PUT]
+func (h *ShopReviewHandler) HelpfulReview(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("invalid parameter"))
+		return
+	}
+
+	user, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.logic.HelpfulReview(ctx, id, user.Id); err != nil {
+		logrus.Error(err.Error())
+		writeReviewError(c, err, "mark helpful failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.Ok[string]())
+}
+
+func writeReviewError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, model.ErrDuplicateReview):
+		c.JSON(http.StatusConflict, httpx.Fail[string](model.ErrDuplicateReview.Error()))
+	case errors.Is(err, model.ErrInvalidScore),
+		errors.Is(err, logic.ErrReviewOrderInvalid),
+		errors.Is(err, logic.ErrReviewImageInvalid),
+		errors.Is(err, logic.ErrReviewShopInvalid),
+		errors.Is(err, logic.ErrReviewSelfHelpful):
+		c.JSON(http.StatusBadRequest, httpx.Fail[string](err.Error()))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, httpx.Fail[string]("review or shop not found"))
+	default:
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string](fallback))
+	}
+}
@@ -1,7 +1,7 @@
 package handler
 
 import (
-	"fmt"
+	"errors"
 	"local-review-go/src/httpx"
 	"local-review-go/src/logic"
 	"local-review-go/src/middleware"
@@ -79,15 +79,21 @@ func (*UserHandler) Logout(c *gin.Context) {
 
 // @Description: get the info of me
 // @Router: /user/me [GET]
-func (*UserHandler) Me(c *gin.Context) {
-	// TODO 获取当前登录的用户
+func (h *UserHandler) Me(c *gin.Context) {
 	userDTO, err := middleware.GetUserInfo(c)
 	if err != nil {
 		logrus.Error("the user info is empty!")
 		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
 		return
 	}
-	c.JSON(http.StatusOK, httpx.OkWithData(userDTO))
+	ctx := c.Request.Context()
+	profile, err := h.logic.GetProfile(ctx, userDTO)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("get user info failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(profile))
 }
 
 // @Description: get the info of user by user Id
@@ -117,7 +123,7 @@ func (h *UserHandler) Info(c *gin.Context) {
 	c.JSON(http.StatusOK, httpx.OkWithData(userInfo))
 }
 
-// @Description: sign
+// @Description: sign, signing twice a day is a no-op
 // @Router /user/sign [GET]
 func (h *UserHandler) sign(c *gin.Context) {
 	userInfo, err := middleware.GetUserInfo(c)
@@ -127,16 +133,16 @@ func (h *UserHandler) sign(c *gin.Context) {
 		return
 	}
 	ctx := c.Request.Context()
-	err = h.logic.Sign(ctx, userInfo.Id)
+	result, err := h.logic.Sign(ctx, userInfo.Id)
 	if err != nil {
-		logrus.Error("sign user failed!")
+		logrus.Error(err.Error())
 		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("sign failed!"))
 		return
 	}
-	c.JSON(http.StatusOK, httpx.OkWithData[string]("签到成功!"))
+	c.JSON(http.StatusOK, httpx.OkWithData(result))
 }
 
-// @Description: 获取当月连续签到的次数
+// @Description: 获取当前连续签到的天数（可跨月）与最长连续天数
 // @Router /user/sign/count
 func (h *UserHandler) SignCount(c *gin.Context) {
 	userInfo, err := middleware.GetUserInfo(c)
@@ -146,12 +152,80 @@ func (h *UserHandler) SignCount(c *gin.Context) {
 		return
 	}
 	ctx := c.Request.Context()
-	count, err := h.logic.GetSignCount(ctx, userInfo.Id)
+	streak, err := h.logic.GetSignCount(ctx, userInfo.Id)
 	if err != nil {
-		logrus.Error("get user sign count failed!")
+		logrus.Error(err.Error())
 		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("get sign count failed!"))
 		return
 	}
-	c.JSON(http.StatusOK, httpx.OkWithData[string](fmt.Sprintf("get user sign count is %d", count)))
+	c.JSON(http.StatusOK, httpx.OkWithData(streak))
+}
+
+// @Description: get the sign calendar of the month (yyyy-MM), default is the current month
+// @Router /user/sign/calendar [GET]
+func (h *UserHandler) SignCalendar(c *gin.Context) {
+	month := time.Now()
+	if monthStr := c.Query("month"); monthStr != "" {
+		parsed, err := time.ParseInLocation("2006-01", monthStr, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpx.Fail[string]("month is invalid"))
+			return
+		}
+		month = parsed
+	}
 
+	userInfo, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error("get user info failed!")
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+	ctx := c.Request.Context()
+	calendar, err := h.logic.GetSignCalendar(ctx, userInfo.Id, month)
+	if err != nil {
+		logrus.Error(err.Error())
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("get sign calendar failed!"))
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(calendar))
+}
+
+type makeupSignReq struct {
+	Date string `json:"date" binding:"required"`
+}
+
+// @Description: make up a missed sign-in (yyyy-MM-dd) within the monthly quota
+// @Router /user/sign/makeup [POST]
+func (h *UserHandler) MakeupSign(c *gin.Context) {
+	var req makeupSignReq
+	if err := httpx.BindJSON(c, &req); err != nil {
+		return
+	}
+	date, err := time.ParseInLocation(time.DateOnly, req.Date, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("date is invalid"))
+		return
+	}
+
+	userInfo, err := middleware.GetUserInfo(c)
+	if err != nil {
+		logrus.Error("get user info failed!")
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+	ctx := c.Request.Context()
+	result, err := h.logic.MakeupSign(ctx, userInfo.Id, date)
+	if err != nil {
+		logrus.Error(err.Error())
+		switch {
+		case errors.Is(err, logic.ErrSignDateInvalid), errors.Is(err, logic.ErrSignAlreadySigned):
+			c.JSON(http.StatusBadRequest, httpx.Fail[string](err.Error()))
+		case errors.Is(err, logic.ErrSignMakeupQuota):
+			c.JSON(http.StatusForbidden, httpx.Fail[string](err.Error()))
+		default:
+			c.JSON(http.StatusInternalServerError, httpx.Fail[string]("makeup sign failed!"))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(result))
 }
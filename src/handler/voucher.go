@@ -1,14 +1,18 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"local-review-go/src/httpx"
 	"local-review-go/src/logic"
 	"local-review-go/src/model"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type VoucherHandler struct {
@@ -79,8 +83,135 @@ func (h *VoucherHandler) QueryVoucherOfShop(c *gin.Context) {
 
 	if err != nil {
 		logrus.Error("get voucher failed!")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, httpx.Fail[string]("shop not found"))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, httpx.Fail[string]("get voucher failed!"))
 		return
 	}
 	c.JSON(http.StatusOK, httpx.OkWithData(vouchers))
 }
+
+type adjustStockReq struct {
+	Delta int `json:"delta" binding:"required"`
+}
+
+// @Description: adjust the stock of the seckill voucher, delta < 0 to reduce
+// @Router: /voucher/seckill/:id/stock [PUT]
+func (h *VoucherHandler) AdjustSeckillStock(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("voucher id is invalid"))
+		return
+	}
+	var req adjustStockReq
+	if err := httpx.BindJSON(c, &req); err != nil {
+		return
+	}
+
+	ctx := c.Request.Context()
+	applied, err := h.logic.AdjustSeckillStock(ctx, id, req.Delta)
+	if err != nil {
+		logrus.Error(err.Error())
+		writeSeckillError(c, err, "adjust stock failed!")
+		return
+	}
+	// Redis 剩余库存不足以扣减时只扣到 0，返回实际调整的数量
+	c.JSON(http.StatusOK, httpx.OkWithData(applied))
+}
+
+type seckillWindowReq struct {
+	BeginTime time.Time `json:"beginTime" binding:"required"`
+	EndTime   time.Time `json:"endTime" binding:"required"`
+}
+
+// @Description: change the begin and end time of the seckill voucher
+// @Router: /voucher/seckill/:id/window [PUT]
+func (h *VoucherHandler) UpdateSeckillWindow(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("voucher id is invalid"))
+		return
+	}
+	var req seckillWindowReq
+	if err := httpx.BindJSON(c, &req); err != nil {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.logic.UpdateSeckillWindow(ctx, id, req.BeginTime, req.EndTime); err != nil {
+		logrus.Error(err.Error())
+		writeSeckillError(c, err, "update seckill time failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.Ok[string]())
+}
+
+// @Description: pause the seckill voucher
+// @Router: /voucher/seckill/:id/pause [PUT]
+func (h *VoucherHandler) PauseSeckill(c *gin.Context) {
+	h.changeSeckillStatus(c, h.logic.PauseSeckill, "pause seckill failed!")
+}
+
+// @Description: resume the paused seckill voucher
+// @Router: /voucher/seckill/:id/resume [PUT]
+func (h *VoucherHandler) ResumeSeckill(c *gin.Context) {
+	h.changeSeckillStatus(c, h.logic.ResumeSeckill, "resume seckill failed!")
+}
+
+// @Description: cancel the seckill voucher, it can not be resumed
+// @Router: /voucher/seckill/:id/cancel [PUT]
+func (h *VoucherHandler) CancelSeckill(c *gin.Context) {
+	h.changeSeckillStatus(c, h.logic.CancelSeckill, "cancel seckill failed!")
+}
+
+func (h *VoucherHandler) changeSeckillStatus(c *gin.Context, change func(context.Context, int64) error, fallback string) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("voucher id is invalid"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := change(ctx, id); err != nil {
+		logrus.Error(err.Error())
+		writeSeckillError(c, err, fallback)
+		return
+	}
+	c.JSON(http.StatusOK, httpx.Ok[string]())
+}
+
+// @Description: compare the stock and orders of the seckill voucher in redis and mysql
+// @Router: /voucher/seckill/:id/check [GET]
+func (h *VoucherHandler) CheckSeckillStock(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("voucher id is invalid"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	report, err := h.logic.CheckSeckillStock(ctx, id)
+	if err != nil {
+		logrus.Error(err.Error())
+		writeSeckillError(c, err, "check seckill stock failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(report))
+}
+
+func writeSeckillError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, httpx.Fail[string]("seckill voucher not found"))
+	case errors.Is(err, model.ErrStockNotEnough):
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("stock can not be negative"))
+	case errors.Is(err, model.ErrSeckillStatus):
+		c.JSON(http.StatusConflict, httpx.Fail[string](model.ErrSeckillStatus.Error()))
+	case errors.Is(err, logic.ErrSeckillWindowInvalid):
+		c.JSON(http.StatusBadRequest, httpx.Fail[string](logic.ErrSeckillWindowInvalid.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, httpx.Fail[string](fallback))
+	}
+}
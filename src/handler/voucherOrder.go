@@ -1,13 +1,17 @@
 package handler
 
 import (
+	"errors"
 	"local-review-go/src/httpx"
 	"local-review-go/src/logic"
 	"local-review-go/src/middleware"
+	"local-review-go/src/model"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type VoucherOrderHandler struct {
@@ -18,7 +22,7 @@ func NewVoucherOrderHandler(voucherOrderLogic logic.VoucherOrderLogic) *VoucherO
 	return &VoucherOrderHandler{logic: voucherOrderLogic}
 }
 
-// @Description: get the voucher id
+// @Description: seckill the voucher, payType=1 pays with credits
 // @Router: /voucher-order/seckill/:id
 func (h *VoucherOrderHandler) SeckillVoucher(c *gin.Context) {
 
@@ -35,6 +39,15 @@ func (h *VoucherOrderHandler) SeckillVoucher(c *gin.Context) {
 		return
 	}
 
+	var payType int
+	if payTypeStr := c.Query("payType"); payTypeStr != "" {
+		payType, err = strconv.Atoi(payTypeStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpx.Fail[string]("pay type is invalid"))
+			return
+		}
+	}
+
 	userInfo, err := middleware.GetUserInfo(c)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
@@ -43,20 +56,70 @@ func (h *VoucherOrderHandler) SeckillVoucher(c *gin.Context) {
 
 	userId := userInfo.Id
 	ctx := c.Request.Context()
-	err = h.logic.SeckillVoucher(ctx, id, userId)
+	err = h.logic.SeckillVoucher(ctx, id, userId, payType)
 
 	if err != nil {
-		// 根据错误类型判断状态码
-		errorMsg := err.Error()
-		if errorMsg == "秒杀尚未开始" || errorMsg == "秒杀已结束" {
-			c.JSON(http.StatusBadRequest, httpx.Fail[string](errorMsg))
-		} else if errorMsg == "the condition is not meet" {
-			c.JSON(http.StatusConflict, httpx.Fail[string]("seckill failed: stock insufficient or already purchased"))
-		} else {
-			c.JSON(http.StatusInternalServerError, httpx.Fail[string](errorMsg))
-		}
+		logrus.Error(err.Error())
+		writeOrderError(c, err, "seckill failed!")
 		return
 	}
 
 	c.JSON(http.StatusOK, httpx.Ok[string]())
 }
+
+// @Description: buy the voucher with credits
+// @Router: /voucher-order/credits/:id [POST]
+func (h *VoucherOrderHandler) PurchaseWithCredits(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpx.Fail[string]("voucher id is invalid"))
+		return
+	}
+
+	userInfo, err := middleware.GetUserInfo(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, httpx.Fail[string]("unauthorized"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	order, err := h.logic.PurchaseWithCredits(ctx, id, userInfo.Id)
+	if err != nil {
+		logrus.Error(err.Error())
+		writeOrderError(c, err, "purchase voucher failed!")
+		return
+	}
+	c.JSON(http.StatusOK, httpx.OkWithData(order))
+}
+
+// orderErrors 下单失败时返回给用户的错误及对应的状态码
+var orderErrors = []struct {
+	err    error
+	status int
+}{
+	{logic.ErrSeckillNotStarted, http.StatusBadRequest},
+	{logic.ErrSeckillEnded, http.StatusBadRequest},
+	{logic.ErrSeckillClosed, http.StatusBadRequest},
+	{logic.ErrVoucherNotForCredits, http.StatusBadRequest},
+	{logic.ErrSeckillVoucherForCredits, http.StatusBadRequest},
+	{model.ErrCreditsNotEnough, http.StatusBadRequest},
+	{logic.ErrVoucherLevelTooLow, http.StatusForbidden},
+	{model.ErrStockNotEnough, http.StatusConflict},
+	{model.ErrDuplicateOrder, http.StatusConflict},
+	{model.ErrDailyLimit, http.StatusConflict},
+	{model.ErrShopLimit, http.StatusConflict},
+}
+
+func writeOrderError(c *gin.Context, err error, fallback string) {
+	for _, e := range orderErrors {
+		if errors.Is(err, e.err) {
+			c.JSON(e.status, httpx.Fail[string](e.err.Error()))
+			return
+		}
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, httpx.Fail[string]("voucher not found"))
+		return
+	}
+	c.JSON(http.StatusInternalServerError, httpx.Fail[string](fallback))
+}
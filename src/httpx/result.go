@@ -59,6 +59,13 @@ type ScrollResult[T any] struct {
 	Offset  int   `json:"offset"`
 }
 
+// CursorResult 游标分页结果，Cursor 为下一页的请求参数
+type CursorResult[T any] struct {
+	Data    []T    `json:"list"`
+	Cursor  string `json:"cursor"`
+	HasMore bool   `json:"hasMore"`
+}
+
 // BindJSON 统一的 JSON 绑定和错误处理辅助函数
 func BindJSON(c *gin.Context, obj interface{}) error {
 	if err := c.ShouldBindJSON(obj); err != nil {
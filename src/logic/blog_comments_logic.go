@@ -0,0 +1,124 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/model"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrCommentInvalid 评论内容或回复目标无效
+var ErrCommentInvalid = errors.New("评论内容或回复对象无效")
+
+type BlogCommentsLogic interface {
+	SaveComment(ctx context.Context, userID int64, comment *model.BlogComments) (int64, error)
+	QueryCommentsOfBlog(ctx context.Context, blogID int64, current int) ([]model.BlogComments, error)
+}
+
+type blogCommentsLogic struct {
+	notify NotificationLogic
+}
+
+func NewBlogCommentsLogic(notificationLogic NotificationLogic) BlogCommentsLogic {
+	return &blogCommentsLogic{notify: notificationLogic}
+}
+
+// SaveComment 发表评论，同时累加博客评论数并刷新热度
+func (l *blogCommentsLogic) SaveComment(ctx context.Context, userID int64, comment *model.BlogComments) (int64, error) {
+	comment.Content = strings.TrimSpace(comment.Content)
+	if comment.Content == "" {
+		return 0, ErrCommentInvalid
+	}
+
+	var blog model.Blog
+	if err := blog.GetBlogById(comment.BlogId); err != nil {
+		return 0, fmt.Errorf("db get blog %d: %w", comment.BlogId, err)
+	}
+
+	// 回复评论时，父评论必须属于同一篇博客
+	var parent model.BlogComments
+	if comment.ParentId > 0 {
+		if err := parent.GetCommentById(comment.ParentId); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return 0, ErrCommentInvalid
+			}
+			return 0, fmt.Errorf("db get comment %d: %w", comment.ParentId, err)
+		}
+		if parent.BlogId != comment.BlogId {
+			return 0, ErrCommentInvalid
+		}
+	}
+
+	now := time.Now()
+	comment.Id = 0
+	comment.UserId = userID
+	comment.Liked = 0
+	comment.Status = model.NORMAL
+	comment.CreateTime = now
+	comment.UpdateTime = now
+
+	err := mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := comment.SaveComment(tx); err != nil {
+			return fmt.Errorf("db save comment blog=%d user=%d: %w", comment.BlogId, userID, err)
+		}
+		if err := blog.IncrComments(tx, 1); err != nil {
+			return fmt.Errorf("db incr comments of blog %d: %w", blog.Id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	refreshHotScore(ctx, blog.Id)
+
+	// 通知博客作者；回复时同时通知被回复的评论作者
+	event := NotifyEvent{
+		UserId:   blog.UserId,
+		ActorId:  userID,
+		Type:     model.NOTIFY_COMMENT,
+		TargetId: blog.Id,
+		Content:  comment.Content,
+	}
+	l.notify.Notify(ctx, event)
+	if parent.Id > 0 && parent.UserId != blog.UserId {
+		event.UserId = parent.UserId
+		l.notify.Notify(ctx, event)
+	}
+	return comment.Id, nil
+}
+
+func (l *blogCommentsLogic) QueryCommentsOfBlog(ctx context.Context, blogID int64, current int) ([]model.BlogComments, error) {
+	comments, err := new(model.BlogComments).QueryCommentsOfBlog(blogID, current)
+	if err != nil {
+		return nil, fmt.Errorf("db query comments of blog %d page=%d: %w", blogID, current, err)
+	}
+	if len(comments) == 0 {
+		return []model.BlogComments{}, nil
+	}
+
+	ids := make([]int64, 0, len(comments))
+	for i := range comments {
+		ids = append(ids, comments[i].UserId)
+	}
+	users, err := new(model.User).GetUsersByIds(ids)
+	if err != nil {
+		return nil, fmt.Errorf("db get users by ids %v: %w", ids, err)
+	}
+	userMap := make(map[int64]model.User, len(users))
+	for _, u := range users {
+		userMap[u.Id] = u
+	}
+	for i := range comments {
+		if u, ok := userMap[comments[i].UserId]; ok {
+			comments[i].Name = u.NickName
+			comments[i].Icon = u.Icon
+		}
+	}
+	return comments, nil
+}
@@ -0,0 +1,432 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/config/redis"
+	"local-review-go/src/model"
+	"local-review-go/src/utils/redisx"
+	"sort"
+	"strconv"
+	"time"
+
+	redisConfig "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// feed 采用推拉结合：
+//   - 普通作者发布后由后台 worker 分批推送到活跃粉丝的收件箱 feed:{userId}
+//   - 粉丝数超过阈值的大V只写自己的发件箱 feed:outbox:{authorId}，粉丝读 feed 时拉取
+//   - 不活跃的粉丝不推送，回归时从关注作者的发件箱补齐
+const (
+	feedCelebrityThreshold = 5000
+	feedMaxLength          = 1000 // 收件箱、发件箱只保留最新的博客
+	feedActiveWindow       = 7 * 24 * time.Hour
+	feedFanoutBatchSize    = 1000
+	feedBackfillPerAuthor  = 20
+	feedWorkerCount        = 4
+	feedTaskBuffer         = 1024 // 每个 worker 的队列长度
+	feedPendingInterval    = 10 * time.Second
+	feedPendingBatchSize   = 100
+)
+
+type feedOp int
+
+const (
+	feedPush feedOp = iota
+	feedRemove
+	feedSync // 队列满时暂存的任务，执行时按 MySQL 中博客的当前状态推送或移除
+)
+
+type feedTask struct {
+	op         feedOp
+	blogId     int64
+	authorId   int64
+	createTime time.Time
+}
+
+// enqueueFeedTask 按作者分片投递，同一博客的推送与移除由同一个 worker 按顺序执行，不阻塞发布请求
+// 队列已满时只把博客记入 Redis 待补做集合，由后台按博客最终状态补做，不能另起 goroutine 乱序执行
+func (l *blogLogic) enqueueFeedTask(task feedTask) {
+	select {
+	case l.feedShard(task.authorId) <- task:
+	default:
+		member := fmt.Sprintf("%d:%d", task.authorId, task.blogId)
+		if err := redis.GetRedisClient().SAdd(context.Background(), redisx.FEED_SYNC_BLOG_KEY, member).Err(); err != nil {
+			logrus.Errorf("feed task queue full and save pending failed, op=%d blog=%d: %v", task.op, task.blogId, err)
+		}
+	}
+}
+
+func (l *blogLogic) feedShard(authorId int64) chan feedTask {
+	return l.feedTasks[authorId%int64(len(l.feedTasks))]
+}
+
+func (l *blogLogic) runFeedWorker(tasks chan feedTask) {
+	for task := range tasks {
+		l.handleFeedTask(task)
+	}
+}
+
+// drainPendingFeedTasks 定期取出待补做的博客，投递到作者所在的分片
+// 后台 goroutine 可以阻塞等待队列空闲，不会丢弃任务
+func (l *blogLogic) drainPendingFeedTasks() {
+	ticker := time.NewTicker(feedPendingInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx := context.Background()
+		for {
+			members, err := redis.GetRedisClient().SPopN(ctx, redisx.FEED_SYNC_BLOG_KEY, feedPendingBatchSize).Result()
+			if err != nil {
+				logrus.Warnf("spop pending feed tasks failed: %v", err)
+				break
+			}
+			for _, member := range members {
+				var authorId, blogId int64
+				if _, err := fmt.Sscanf(member, "%d:%d", &authorId, &blogId); err != nil {
+					logrus.Warnf("skip invalid pending feed task %s", member)
+					continue
+				}
+				l.feedShard(authorId) <- feedTask{op: feedSync, blogId: blogId, authorId: authorId}
+			}
+			if len(members) < feedPendingBatchSize {
+				break
+			}
+		}
+	}
+}
+
+func (l *blogLogic) handleFeedTask(task feedTask) {
+	ctx := context.Background()
+	var err error
+	switch task.op {
+	case feedPush:
+		err = pushBlogToFeeds(ctx, task)
+	case feedRemove:
+		err = removeBlogFromFeeds(ctx, task)
+	case feedSync:
+		err = syncBlogToFeeds(ctx, task)
+	}
+	if err != nil {
+		logrus.Warnf("feed task op=%d blog=%d failed: %v", task.op, task.blogId, err)
+	}
+}
+
+// syncBlogToFeeds 博客存在时推送，已软删除时移除，已物理删除时由 purgeBlog 清理
+func syncBlogToFeeds(ctx context.Context, task feedTask) error {
+	var blog model.Blog
+	err := blog.GetBlogById(task.blogId)
+	if err == nil {
+		task.createTime = blog.CreateTime
+		return pushBlogToFeeds(ctx, task)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("db get blog %d: %w", task.blogId, err)
+	}
+
+	err = blog.GetDeletedBlogById(mysql.GetMysqlDB(), task.blogId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("db get deleted blog %d: %w", task.blogId, err)
+	}
+	return removeBlogFromFeeds(ctx, task)
+}
+
+// pushBlogToFeeds 写入作者发件箱，普通作者再推送到活跃粉丝的收件箱
+func pushBlogToFeeds(ctx context.Context, task feedTask) error {
+	client := redis.GetRedisClient()
+	outboxKey := redisx.FEED_OUTBOX_KEY + strconv.FormatInt(task.authorId, 10)
+	members := []redisConfig.Z{{
+		Score:  float64(task.createTime.Unix()),
+		Member: task.blogId,
+	}}
+	pipe := client.Pipeline()
+	pipe.ZAdd(ctx, outboxKey, members...)
+	trimFeed(ctx, pipe, outboxKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("zadd outbox of user %d: %w", task.authorId, err)
+	}
+
+	followers, err := new(model.Follow).CountFollowers(task.authorId)
+	if err != nil {
+		return fmt.Errorf("db count followers of user %d: %w", task.authorId, err)
+	}
+	if followers >= feedCelebrityThreshold {
+		return client.SAdd(ctx, redisx.FEED_CELEBRITY_KEY, task.authorId).Err()
+	}
+
+	demoted, err := client.SRem(ctx, redisx.FEED_CELEBRITY_KEY, task.authorId).Result()
+	if err != nil {
+		return fmt.Errorf("srem celebrity %d: %w", task.authorId, err)
+	}
+	if demoted > 0 {
+		// 刚从大V降级，粉丝不再拉取其发件箱，把近期博客一并推送
+		recent, err := client.ZRevRangeWithScores(ctx, outboxKey, 0, feedBackfillPerAuthor-1).Result()
+		if err != nil {
+			return fmt.Errorf("zrevrange outbox of user %d: %w", task.authorId, err)
+		}
+		members = recent
+	}
+	return fanoutToActiveFollowers(ctx, task.authorId, members)
+}
+
+// fanoutToActiveFollowers 分批读取粉丝，用 pipeline 推送给最近活跃的粉丝
+func fanoutToActiveFollowers(ctx context.Context, authorId int64, members []redisConfig.Z) error {
+	client := redis.GetRedisClient()
+	activeSince := float64(time.Now().Add(-feedActiveWindow).Unix())
+
+	var (
+		f      model.Follow
+		lastId int64
+	)
+	for {
+		follows, err := f.QueryFollowersAfter(authorId, lastId, feedFanoutBatchSize)
+		if err != nil {
+			return fmt.Errorf("db query followers of user %d after %d: %w", authorId, lastId, err)
+		}
+		if len(follows) == 0 {
+			return nil
+		}
+
+		userIds := make([]string, len(follows))
+		for i := range follows {
+			userIds[i] = strconv.FormatInt(follows[i].UserId, 10)
+		}
+		// 不存在的成员返回 0，视为不活跃
+		lastActive, err := client.ZMScore(ctx, redisx.FEED_ACTIVE_KEY, userIds...).Result()
+		if err != nil {
+			return fmt.Errorf("zmscore active followers: %w", err)
+		}
+
+		pipe := client.Pipeline()
+		for i, userId := range userIds {
+			if lastActive[i] < activeSince {
+				continue
+			}
+			pipe.ZAdd(ctx, redisx.FEED_KEY+userId, members...)
+			trimFeed(ctx, pipe, redisx.FEED_KEY+userId)
+		}
+		if pipe.Len() > 0 {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return fmt.Errorf("push to feeds of followers of user %d: %w", authorId, err)
+			}
+		}
+
+		lastId = follows[len(follows)-1].Id
+		if len(follows) < feedFanoutBatchSize {
+			return nil
+		}
+	}
+}
+
+// removeBlogFromFeeds 从发件箱和所有粉丝的收件箱中移除博客
+func removeBlogFromFeeds(ctx context.Context, task feedTask) error {
+	client := redis.GetRedisClient()
+	outboxKey := redisx.FEED_OUTBOX_KEY + strconv.FormatInt(task.authorId, 10)
+	if err := client.ZRem(ctx, outboxKey, task.blogId).Err(); err != nil {
+		return fmt.Errorf("zrem blog %d from outbox: %w", task.blogId, err)
+	}
+
+	var (
+		f      model.Follow
+		lastId int64
+	)
+	for {
+		follows, err := f.QueryFollowersAfter(task.authorId, lastId, feedFanoutBatchSize)
+		if err != nil {
+			return fmt.Errorf("db query followers of user %d after %d: %w", task.authorId, lastId, err)
+		}
+		if len(follows) == 0 {
+			return nil
+		}
+
+		pipe := client.Pipeline()
+		for i := range follows {
+			pipe.ZRem(ctx, redisx.FEED_KEY+strconv.FormatInt(follows[i].UserId, 10), task.blogId)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("zrem blog %d from feeds: %w", task.blogId, err)
+		}
+
+		lastId = follows[len(follows)-1].Id
+		if len(follows) < feedFanoutBatchSize {
+			return nil
+		}
+	}
+}
+
+// touchFeedActive 记录读 feed 的时间，不活跃的用户回归时补齐收件箱
+func touchFeedActive(ctx context.Context, userID int64) {
+	client := redis.GetRedisClient()
+	member := strconv.FormatInt(userID, 10)
+	now := time.Now()
+
+	lastActive, err := client.ZScore(ctx, redisx.FEED_ACTIVE_KEY, member).Result()
+	if err != nil && !errors.Is(err, redisConfig.Nil) {
+		logrus.Warnf("get feed active time of user %d failed: %v", userID, err)
+		return
+	}
+	if err := client.ZAdd(ctx, redisx.FEED_ACTIVE_KEY, redisConfig.Z{
+		Score:  float64(now.Unix()),
+		Member: member,
+	}).Err(); err != nil {
+		logrus.Warnf("set feed active time of user %d failed: %v", userID, err)
+		return
+	}
+
+	if lastActive < float64(now.Add(-feedActiveWindow).Unix()) {
+		if err := backfillFeed(ctx, userID); err != nil {
+			logrus.Warnf("backfill feed of user %d failed: %v", userID, err)
+		}
+	}
+}
+
+// backfillFeed 从关注的普通作者的发件箱拉取近期博客写入收件箱，大V的博客读时拉取
+func backfillFeed(ctx context.Context, userID int64) error {
+	client := redis.GetRedisClient()
+	followKey := redisx.FOLLOW_USER_KEY + strconv.FormatInt(userID, 10)
+
+	authorIds, err := client.SDiff(ctx, followKey, redisx.FEED_CELEBRITY_KEY).Result()
+	if err != nil {
+		return fmt.Errorf("sdiff followees of user %d: %w", userID, err)
+	}
+	if len(authorIds) == 0 {
+		return nil
+	}
+
+	pipe := client.Pipeline()
+	cmds := make([]*redisConfig.ZSliceCmd, len(authorIds))
+	for i, authorId := range authorIds {
+		cmds[i] = pipe.ZRevRangeWithScores(ctx, redisx.FEED_OUTBOX_KEY+authorId, 0, feedBackfillPerAuthor-1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redisConfig.Nil) {
+		return fmt.Errorf("read outboxes of followees of user %d: %w", userID, err)
+	}
+
+	var members []redisConfig.Z
+	for _, cmd := range cmds {
+		members = append(members, cmd.Val()...)
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	feedKey := redisx.FEED_KEY + strconv.FormatInt(userID, 10)
+	pipe = client.Pipeline()
+	pipe.ZAdd(ctx, feedKey, members...)
+	trimFeed(ctx, pipe, feedKey)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// trimFeed 按排名删除超出长度上限的最旧的博客
+func trimFeed(ctx context.Context, pipe redisConfig.Pipeliner, key string) {
+	pipe.ZRemRangeByRank(ctx, key, 0, -feedMaxLength-1)
+}
+
+// readFeed 读取收件箱与关注的大V发件箱中 score <= cur.Score 的前 offset+count 条并归并，
+// 再跳过 cur.Offset 条，与单个 ZSET 上 ZREVRANGEBYSCORE ... LIMIT offset count 的语义一致
+func readFeed(ctx context.Context, userID int64, cur redisx.ScoreCursor, count int) ([]redisConfig.Z, error) {
+	client := redis.GetRedisClient()
+	followKey := redisx.FOLLOW_USER_KEY + strconv.FormatInt(userID, 10)
+
+	celebrities, err := client.SInter(ctx, followKey, redisx.FEED_CELEBRITY_KEY).Result()
+	if err != nil {
+		return nil, fmt.Errorf("sinter celebrities followed by user %d: %w", userID, err)
+	}
+
+	keys := make([]string, 0, len(celebrities)+1)
+	keys = append(keys, redisx.FEED_KEY+strconv.FormatInt(userID, 10))
+	for _, authorId := range celebrities {
+		keys = append(keys, redisx.FEED_OUTBOX_KEY+authorId)
+	}
+
+	limit := cur.Offset + count
+	pipe := client.Pipeline()
+	cmds := make([]*redisConfig.ZSliceCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.ZRevRangeByScoreWithScores(ctx, key, &redisConfig.ZRangeBy{
+			Min:   "-inf",
+			Max:   cur.Max(),
+			Count: int64(limit),
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redisConfig.Nil) {
+		return nil, fmt.Errorf("zrevrangebyscore feeds of user %d: %w", userID, err)
+	}
+
+	pages := make([][]redisConfig.Z, len(cmds))
+	for i, cmd := range cmds {
+		pages[i] = cmd.Val()
+	}
+	merged := mergeFeedPages(pages, limit)
+	if cur.Offset >= len(merged) {
+		return nil, nil
+	}
+	return merged[cur.Offset:], nil
+}
+
+// feedPage 一页 feed：raw 为归并后的原始结果，用于计算下一页游标；blogs 为其中仍存在的博客
+type feedPage struct {
+	raw   []redisConfig.Z
+	blogs []model.Blog
+}
+
+// readFeedBlogs 读取一页 feed 并加载博客。已删除的博客只在本页跳过，不从收件箱中移除：
+// 游标是 score+offset，翻页途中删掉同分的条目会让下一页跳过有效的博客。
+// 残留的条目由删除时的 feedRemove 任务与 purgeBlog 清理
+func readFeedBlogs(ctx context.Context, userID int64, cur redisx.ScoreCursor, count int,
+	load func(ids []int64) ([]model.Blog, error)) (feedPage, error) {
+	raw, err := readFeed(ctx, userID, cur, count)
+	if err != nil {
+		return feedPage{}, err
+	}
+	if len(raw) == 0 {
+		return feedPage{}, nil
+	}
+
+	ids, err := parseZSetIds(raw)
+	if err != nil {
+		return feedPage{}, err
+	}
+	// 已删除的博客不会被查出
+	blogs, err := load(ids)
+	if err != nil {
+		return feedPage{}, fmt.Errorf("db get blogs by ids %v: %w", ids, err)
+	}
+	return feedPage{raw: raw, blogs: blogs}, nil
+}
+
+// mergeFeedPages 按 score 降序归并并去重，score 相同时按成员字典序降序，与 ZREVRANGE 的顺序一致
+func mergeFeedPages(pages [][]redisConfig.Z, limit int) []redisConfig.Z {
+	seen := make(map[string]struct{})
+	var merged []redisConfig.Z
+	for _, page := range pages {
+		for _, z := range page {
+			member, ok := z.Member.(string)
+			if !ok {
+				continue
+			}
+			if _, dup := seen[member]; dup {
+				continue
+			}
+			seen[member] = struct{}{}
+			merged = append(merged, z)
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Score != merged[j].Score {
+			return merged[i].Score > merged[j].Score
+		}
+		return merged[i].Member.(string) > merged[j].Member.(string)
+	})
+	if len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged
+}
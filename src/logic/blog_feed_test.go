@@ -0,0 +1,241 @@
+package logic
+
+import (
+	"context"
+	"local-review-go/src/config/redis"
+	"local-review-go/src/model"
+	"local-review-go/src/utils/redisx"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	redisConfig "github.com/redis/go-redis/v9"
+)
+
+func setupFeedRedis(t *testing.T) *redisConfig.Client {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redisConfig.NewClient(&redisConfig.Options{Addr: mr.Addr()})
+	prev := redis.GetRedisClient()
+	redis.SetRedisClient(client)
+	t.Cleanup(func() {
+		redis.SetRedisClient(prev)
+		client.Close()
+	})
+	return client
+}
+
+// scrollFeed 按游标翻完整个 feed，每页都经过游标的编码与解码
+func scrollFeed(t *testing.T, userID int64, pageSize int) []int64 {
+	t.Helper()
+	ctx := context.Background()
+	var (
+		ids    []int64
+		cursor string
+	)
+	for page := 0; page < 100; page++ {
+		cur, err := redisx.DecodeScoreCursor(cursor)
+		if err != nil {
+			t.Fatalf("decode cursor %q: %v", cursor, err)
+		}
+		result, err := readFeed(ctx, userID, cur, pageSize)
+		if err != nil {
+			t.Fatalf("read feed: %v", err)
+		}
+		pageIds, err := parseZSetIds(result)
+		if err != nil {
+			t.Fatalf("parse ids: %v", err)
+		}
+		ids = append(ids, pageIds...)
+		if len(result) < pageSize {
+			return ids
+		}
+		cursor = redisx.NextScoreCursor(cur, result).Encode()
+	}
+	t.Fatal("feed did not terminate")
+	return nil
+}
+
+func assertIds(t *testing.T, got, want []int64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestReadFeedPagesThroughTies(t *testing.T) {
+	client := setupFeedRedis(t)
+	ctx := context.Background()
+
+	// 同一秒发布的多篇博客分数相同，且同分成员跨越多页
+	client.ZAdd(ctx, redisx.FEED_KEY+"1",
+		redisConfig.Z{Score: 100, Member: 11},
+		redisConfig.Z{Score: 100, Member: 12},
+		redisConfig.Z{Score: 100, Member: 13},
+		redisConfig.Z{Score: 100, Member: 14},
+		redisConfig.Z{Score: 100, Member: 15},
+		redisConfig.Z{Score: 90, Member: 16},
+		redisConfig.Z{Score: 90, Member: 17},
+		redisConfig.Z{Score: 80, Member: 18},
+	)
+
+	for _, pageSize := range []int{1, 2, 3, 5, 8, 10} {
+		got := scrollFeed(t, 1, pageSize)
+		assertIds(t, got, []int64{15, 14, 13, 12, 11, 17, 16, 18})
+	}
+}
+
+func TestReadFeedMergesCelebrityOutbox(t *testing.T) {
+	client := setupFeedRedis(t)
+	ctx := context.Background()
+
+	// 用户 1 关注了普通作者 3 和大V 2
+	client.SAdd(ctx, redisx.FOLLOW_USER_KEY+"1", 2, 3)
+	client.SAdd(ctx, redisx.FEED_CELEBRITY_KEY, 2, 9)
+	client.ZAdd(ctx, redisx.FEED_KEY+"1",
+		redisConfig.Z{Score: 100, Member: 31},
+		redisConfig.Z{Score: 90, Member: 32},
+		redisConfig.Z{Score: 90, Member: 33},
+		// 作者 2 成为大V之前推送过来的博客，发件箱中也有
+		redisConfig.Z{Score: 70, Member: 23},
+	)
+	client.ZAdd(ctx, redisx.FEED_OUTBOX_KEY+"2",
+		redisConfig.Z{Score: 100, Member: 21},
+		redisConfig.Z{Score: 90, Member: 22},
+		redisConfig.Z{Score: 70, Member: 23},
+	)
+	// 未关注的大V不应出现
+	client.ZAdd(ctx, redisx.FEED_OUTBOX_KEY+"9", redisConfig.Z{Score: 95, Member: 91})
+
+	want := []int64{31, 21, 33, 32, 22, 23}
+	for _, pageSize := range []int{1, 2, 4, 6, 10} {
+		assertIds(t, scrollFeed(t, 1, pageSize), want)
+	}
+}
+
+func TestReadFeedBelowCursor(t *testing.T) {
+	client := setupFeedRedis(t)
+	ctx := context.Background()
+
+	client.ZAdd(ctx, redisx.FEED_KEY+"1",
+		redisConfig.Z{Score: 100, Member: 11},
+		redisConfig.Z{Score: 90, Member: 12},
+		redisConfig.Z{Score: 90, Member: 13},
+	)
+
+	result, err := readFeed(ctx, 1, redisx.ScoreCursor{Score: 90, Offset: 1}, 10)
+	if err != nil {
+		t.Fatalf("read feed: %v", err)
+	}
+	ids, err := parseZSetIds(result)
+	if err != nil {
+		t.Fatalf("parse ids: %v", err)
+	}
+	assertIds(t, ids, []int64{12})
+
+	result, err = readFeed(ctx, 1, redisx.ScoreCursor{Score: 90, Offset: 5}, 10)
+	if err != nil {
+		t.Fatalf("read feed: %v", err)
+	}
+	if len(result) != 0 {
+		t.Fatalf("expected empty page, got %v", result)
+	}
+}
+
+func TestReadFeedBlogsSkipsDeletedAcrossTies(t *testing.T) {
+	client := setupFeedRedis(t)
+	ctx := context.Background()
+
+	// 同分的博客跨越分页边界，读完第一页后删除其中一篇
+	client.ZAdd(ctx, redisx.FEED_KEY+"1",
+		redisConfig.Z{Score: 100, Member: 11},
+		redisConfig.Z{Score: 100, Member: 12},
+		redisConfig.Z{Score: 100, Member: 13},
+		redisConfig.Z{Score: 100, Member: 14},
+		redisConfig.Z{Score: 90, Member: 15},
+	)
+	deleted := map[int64]bool{}
+	load := func(ids []int64) ([]model.Blog, error) {
+		blogs := make([]model.Blog, 0, len(ids))
+		for _, id := range ids {
+			if !deleted[id] {
+				blogs = append(blogs, model.Blog{Id: id})
+			}
+		}
+		return blogs, nil
+	}
+
+	var (
+		got []int64
+		cur = redisx.FirstScoreCursor()
+	)
+	for page := 0; page < 10; page++ {
+		result, err := readFeedBlogs(ctx, 1, cur, 2, load)
+		if err != nil {
+			t.Fatalf("read feed blogs: %v", err)
+		}
+		for _, blog := range result.blogs {
+			got = append(got, blog.Id)
+		}
+		if page == 0 {
+			deleted[14] = true
+			deleted[12] = true
+		}
+		if len(result.raw) < 2 {
+			break
+		}
+		cur, err = redisx.DecodeScoreCursor(redisx.NextScoreCursor(cur, result.raw).Encode())
+		if err != nil {
+			t.Fatalf("decode cursor: %v", err)
+		}
+	}
+	assertIds(t, got, []int64{14, 13, 11, 15})
+	if n := client.ZCard(ctx, redisx.FEED_KEY+"1").Val(); n != 5 {
+		t.Fatalf("feed changed while paging: %d entries", n)
+	}
+}
+
+func TestEnqueueFeedTaskShardsAndSavesPending(t *testing.T) {
+	client := setupFeedRedis(t)
+	ctx := context.Background()
+	l := &blogLogic{feedTasks: []chan feedTask{make(chan feedTask, 1), make(chan feedTask, 1)}}
+
+	// 同一作者的任务进入同一个分片，分片满后记入待补做集合而不是另起 goroutine
+	l.enqueueFeedTask(feedTask{op: feedPush, blogId: 10, authorId: 3})
+	l.enqueueFeedTask(feedTask{op: feedRemove, blogId: 10, authorId: 3})
+	l.enqueueFeedTask(feedTask{op: feedPush, blogId: 20, authorId: 4})
+
+	if task := <-l.feedTasks[1]; task.blogId != 10 || task.op != feedPush {
+		t.Fatalf("shard of author 3 got %+v", task)
+	}
+	if task := <-l.feedTasks[0]; task.blogId != 20 {
+		t.Fatalf("shard of author 4 got %+v", task)
+	}
+	pending := client.SMembers(ctx, redisx.FEED_SYNC_BLOG_KEY).Val()
+	if len(pending) != 1 || pending[0] != "3:10" {
+		t.Fatalf("pending feed tasks = %v", pending)
+	}
+}
+
+func TestEnqueueFollowFeedTaskSavesPending(t *testing.T) {
+	client := setupFeedRedis(t)
+	ctx := context.Background()
+	l := &followLogic{feedTasks: []chan followFeedTask{make(chan followFeedTask, 1)}}
+
+	// 队列满时立即返回，关注关系记入待补做集合
+	l.enqueueFeedTask(followFeedTask{follow: true, userId: 1, authorId: 2})
+	l.enqueueFeedTask(followFeedTask{follow: false, userId: 1, authorId: 2})
+	l.enqueueFeedTask(followFeedTask{follow: true, userId: 1, authorId: 3})
+
+	if task := <-l.feedTasks[0]; !task.follow || task.authorId != 2 {
+		t.Fatalf("queued task = %+v", task)
+	}
+	pending := client.SMembers(ctx, redisx.FEED_SYNC_FOLLOW_KEY).Val()
+	if len(pending) != 2 {
+		t.Fatalf("pending follow feed tasks = %v", pending)
+	}
+}
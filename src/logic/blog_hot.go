@@ -0,0 +1,179 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/src/config/redis"
+	"local-review-go/src/model"
+	"local-review-go/src/utils"
+	"local-review-go/src/utils/redisx"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	redisConfig "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	hotBlogWindow            = 7 * 24 * time.Hour // 只有该时间窗口内的博客参与热榜
+	hotBlogRecomputeInterval = 10 * time.Minute
+	hotBlogHalfLife          = 12 * time.Hour // 晚发布这么久的博客需要 10 倍互动量才能持平
+	hotBlogCommentWeight     = 2
+	hotBlogBatchSize         = 500
+)
+
+// hotBlogEpoch 热度中发布时间项的起点，修改后需要全量重建热榜
+var hotBlogEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+
+// hotScore 热度 = log10(点赞 + 2*评论 + 1) + (发布时间 - epoch) / 12h
+// 分数只取决于互动量与发布时间，不随计算时刻变化，不同时间写入的分数可以直接比较；
+// 新博客的时间项更大，相当于旧博客的分数随时间衰减
+func hotScore(liked, comments int, createTime time.Time) float64 {
+	points := float64(liked + hotBlogCommentWeight*comments + 1)
+	if points < 1 {
+		points = 1
+	}
+	age := createTime.Sub(hotBlogEpoch).Seconds() / hotBlogHalfLife.Seconds()
+	return math.Log10(points) + age
+}
+
+// hotScoreExpr 与 hotScore 相同公式的 SQL 表达式，用于数据库侧按热度排序
+func hotScoreExpr() string {
+	return fmt.Sprintf("(LOG10(GREATEST(liked + %d * comments + 1, 1)) + "+
+		"TIMESTAMPDIFF(SECOND, '%s', create_time) / %d)",
+		hotBlogCommentWeight, hotBlogEpoch.Format(time.DateTime), int64(hotBlogHalfLife.Seconds()))
+}
+
+// updateHotScore 点赞/评论/发布后更新博客在热榜中的分数
+func updateHotScore(ctx context.Context, blog *model.Blog) {
+	if time.Since(blog.CreateTime) > hotBlogWindow {
+		removeHotScore(ctx, blog.Id)
+		return
+	}
+	score := hotScore(blog.Liked, blog.Comments, blog.CreateTime)
+	if err := redis.GetRedisClient().ZAdd(ctx, redisx.BLOG_HOT_KEY, redisConfig.Z{
+		Score:  score,
+		Member: blog.Id,
+	}).Err(); err != nil {
+		logrus.Warnf("update hot score of blog %d failed: %v", blog.Id, err)
+	}
+}
+
+// refreshHotScore 从数据库读取最新的点赞/评论数后更新热度
+func refreshHotScore(ctx context.Context, id int64) {
+	var blog model.Blog
+	if err := blog.GetBlogById(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			removeHotScore(ctx, id)
+			return
+		}
+		logrus.Warnf("get blog %d for hot score failed: %v", id, err)
+		return
+	}
+	updateHotScore(ctx, &blog)
+}
+
+func removeHotScore(ctx context.Context, id int64) {
+	if err := redis.GetRedisClient().ZRem(ctx, redisx.BLOG_HOT_KEY, id).Err(); err != nil {
+		logrus.Warnf("remove blog %d from hot rank failed: %v", id, err)
+	}
+}
+
+// recomputeHotBlogs 定期全量重算热度，剔除窗口外的博客并修正漏掉的增量更新
+func (l *blogLogic) recomputeHotBlogs() {
+	l.rebuildHotBlogsWithLock()
+
+	ticker := time.NewTicker(hotBlogRecomputeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.rebuildHotBlogsWithLock()
+	}
+}
+
+func (l *blogLogic) rebuildHotBlogsWithLock() {
+	ctx := context.Background()
+	lock, acquired, err := utils.NewLocker().
+		LockWithWatchDog(ctx, redisx.BLOG_HOT_LOCK_KEY, 30*time.Second)
+	if err != nil || !acquired {
+		return
+	}
+	defer lock.Unlock(ctx)
+
+	// 锁丢失时中断重建，避免与新的持有者交替写热榜
+	lockCtx, cancel := lock.Context(ctx)
+	defer cancel()
+	if err := rebuildHotBlogs(lockCtx); err != nil {
+		logrus.Errorf("rebuild hot blogs failed: %v", err)
+	}
+}
+
+// rebuildHotBlogs 写入临时 key 后 RENAME 原子替换热榜
+func rebuildHotBlogs(ctx context.Context) error {
+	client := redis.GetRedisClient()
+	tmpKey := redisx.BLOG_HOT_KEY + ":tmp:" + uuid.New().String()
+	since := time.Now().Add(-hotBlogWindow)
+
+	var (
+		lastId int64
+		total  int
+	)
+	for {
+		blogs, err := new(model.Blog).QueryBlogsSince(since, lastId, hotBlogBatchSize)
+		if err != nil {
+			client.Del(ctx, tmpKey)
+			return fmt.Errorf("db query blogs since %v: %w", since, err)
+		}
+		if len(blogs) == 0 {
+			break
+		}
+
+		members := make([]redisConfig.Z, 0, len(blogs))
+		for i := range blogs {
+			members = append(members, redisConfig.Z{
+				Score:  hotScore(blogs[i].Liked, blogs[i].Comments, blogs[i].CreateTime),
+				Member: blogs[i].Id,
+			})
+		}
+		if err := client.ZAdd(ctx, tmpKey, members...).Err(); err != nil {
+			client.Del(ctx, tmpKey)
+			return fmt.Errorf("zadd hot blogs: %w", err)
+		}
+
+		total += len(blogs)
+		lastId = blogs[len(blogs)-1].Id
+		if len(blogs) < hotBlogBatchSize {
+			break
+		}
+	}
+
+	if total == 0 {
+		return client.Del(ctx, redisx.BLOG_HOT_KEY).Err()
+	}
+	if err := client.Rename(ctx, tmpKey, redisx.BLOG_HOT_KEY).Err(); err != nil {
+		client.Del(ctx, tmpKey)
+		return fmt.Errorf("rename hot blogs: %w", err)
+	}
+	logrus.Infof("hot blogs rebuilt: %d blogs", total)
+	return nil
+}
+
+// parseZSetIds 解析 ZSET 成员为 id，Redis 返回的成员是字符串
+func parseZSetIds(zs []redisConfig.Z) ([]int64, error) {
+	ids := make([]int64, 0, len(zs))
+	for _, z := range zs {
+		member, ok := z.Member.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected zset member %v", z.Member)
+		}
+		id, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse zset member %s: %w", member, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,282 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/script"
+	"local-review-go/src/config/redis"
+	"local-review-go/src/model"
+	"local-review-go/src/utils"
+	"local-review-go/src/utils/redisx"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	redisConfig "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	likeFlushInterval     = 5 * time.Second
+	likeReconcileInterval = time.Hour
+	likeFlushBatchSize    = 500
+	likeScanCount         = 200
+)
+
+// LikeResult 点赞切换后的状态
+type LikeResult struct {
+	IsLike bool  `json:"isLike"`
+	Liked  int64 `json:"liked"`
+}
+
+func toggleBlogLike(ctx context.Context, id, userID int64) (LikeResult, error) {
+	keys := []string{
+		redisx.BLOG_LIKE_KEY + strconv.FormatInt(id, 10),
+		redisx.BLOG_LIKE_DELTA_KEY,
+	}
+	values := []interface{}{
+		strconv.FormatInt(userID, 10),
+		time.Now().Unix(),
+		strconv.FormatInt(id, 10),
+	}
+
+	res, err := script.BlogLike.Run(ctx, redis.GetRedisClient(), keys, values...).Int64Slice()
+	if err != nil {
+		return LikeResult{}, err
+	}
+	if len(res) != 2 {
+		return LikeResult{}, fmt.Errorf("unexpected like script result %v", res)
+	}
+	return LikeResult{IsLike: res[0] == 1, Liked: res[1]}, nil
+}
+
+// flushLikeDeltas 定期把点赞增量批量写回 MySQL
+func (l *blogLogic) flushLikeDeltas() {
+	ticker := time.NewTicker(likeFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.withLikeLock(func(ctx context.Context, fence model.Fence) {
+			if err := flushLikeDeltas(ctx, fence); err != nil {
+				logrus.Errorf("flush blog like deltas failed: %v", err)
+			}
+		})
+	}
+}
+
+// reconcileLikes 定期以点赞 ZSET 为准校准 tb_blog.liked
+func (l *blogLogic) reconcileLikes() {
+	ticker := time.NewTicker(likeReconcileInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.withLikeLock(func(ctx context.Context, fence model.Fence) {
+			// 先写回已有增量，缩小校准期间的待写回窗口
+			if err := flushLikeDeltas(ctx, fence); err != nil {
+				logrus.Errorf("flush blog like deltas before reconcile failed: %v", err)
+				return
+			}
+			if err := reconcileLikes(ctx, fence); err != nil {
+				logrus.Errorf("reconcile blog likes failed: %v", err)
+			}
+		})
+	}
+}
+
+// withLikeLock 写回与校准互斥，且多实例下只有一个实例执行
+// 锁丢失时 ctx 被取消，写回 MySQL 时带上 fencing token 防止过期的持有者重复累加
+func (l *blogLogic) withLikeLock(fn func(ctx context.Context, fence model.Fence)) {
+	ctx := context.Background()
+	lock, acquired, err := utils.NewLocker().
+		LockWithWatchDog(ctx, redisx.BLOG_LIKE_LOCK_KEY, 30*time.Second)
+	if err != nil || !acquired {
+		return
+	}
+	defer lock.Unlock(ctx)
+
+	lockCtx, cancel := lock.Context(ctx)
+	defer cancel()
+	fn(lockCtx, lockFence(lock))
+}
+
+// flushLikeDeltas 将增量 hash RENAME 为本实例私有的 key 后再写回，
+// 写回期间新产生的增量进入新的 hash，互不影响；写回失败时把增量合并回去
+func flushLikeDeltas(ctx context.Context, fence model.Fence) error {
+	client := redis.GetRedisClient()
+	processingKey := redisx.BLOG_LIKE_DELTA_KEY + ":flushing:" + uuid.New().String()
+
+	taken, err := script.BlogLikeTake.Run(ctx, client, []string{redisx.BLOG_LIKE_DELTA_KEY, processingKey}).Int()
+	if err != nil {
+		return fmt.Errorf("take like delta: %w", err)
+	}
+	if taken == 0 {
+		return nil
+	}
+
+	values, err := client.HGetAll(ctx, processingKey).Result()
+	if err != nil {
+		restoreLikeDeltas(ctx, processingKey, nil)
+		return fmt.Errorf("hgetall like delta: %w", err)
+	}
+
+	deltas := make(map[int64]int64, len(values))
+	for field, value := range values {
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			logrus.Warnf("skip invalid like delta field %s", field)
+			continue
+		}
+		delta, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			logrus.Warnf("skip invalid like delta %s=%s", field, value)
+			continue
+		}
+		deltas[id] = delta
+	}
+
+	batch := make(map[int64]int64, likeFlushBatchSize)
+	var failed map[int64]int64
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := new(model.Blog).ApplyLikeDeltas(fence, batch); err != nil {
+			logrus.Warnf("db apply %d like deltas failed: %v", len(batch), err)
+			if failed == nil {
+				failed = make(map[int64]int64)
+			}
+			for id, delta := range batch {
+				failed[id] = delta
+			}
+		}
+		batch = make(map[int64]int64, likeFlushBatchSize)
+	}
+	for id, delta := range deltas {
+		batch[id] = delta
+		if len(batch) >= likeFlushBatchSize {
+			flush()
+		}
+	}
+	flush()
+
+	restoreLikeDeltas(ctx, processingKey, failed)
+	if len(failed) > 0 {
+		return fmt.Errorf("%d like deltas failed to flush", len(failed))
+	}
+	return nil
+}
+
+// restoreLikeDeltas 合并写回失败的增量并删除处理中的 key
+// failed 为 nil 时表示整体未写回，合并全部增量
+func restoreLikeDeltas(ctx context.Context, processingKey string, failed map[int64]int64) {
+	client := redis.GetRedisClient()
+	if failed == nil {
+		values, err := client.HGetAll(ctx, processingKey).Result()
+		if err != nil {
+			logrus.Errorf("like deltas in %s kept for manual recovery: %v", processingKey, err)
+			return
+		}
+		failed = make(map[int64]int64, len(values))
+		for field, value := range values {
+			id, _ := strconv.ParseInt(field, 10, 64)
+			delta, _ := strconv.ParseInt(value, 10, 64)
+			failed[id] = delta
+		}
+	}
+
+	pipe := client.TxPipeline()
+	for id, delta := range failed {
+		pipe.HIncrBy(ctx, redisx.BLOG_LIKE_DELTA_KEY, strconv.FormatInt(id, 10), delta)
+	}
+	pipe.Del(ctx, processingKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logrus.Errorf("restore like deltas from %s failed: %v", processingKey, err)
+	}
+}
+
+// reconcileLikes 遍历所有点赞集合，liked = ZCARD - 尚未写回的增量；
+// 点赞全部取消后集合被删除，再从 MySQL 找出仍有点赞数但没有集合的博客一并校准
+func reconcileLikes(ctx context.Context, fence model.Fence) error {
+	client := redis.GetRedisClient()
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, redisx.BLOG_LIKE_KEY+"*", likeScanCount).Result()
+		if err != nil {
+			return fmt.Errorf("scan like keys: %w", err)
+		}
+		for _, key := range keys {
+			idStr := strings.TrimPrefix(key, redisx.BLOG_LIKE_KEY)
+			id, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				continue
+			}
+			if err := reconcileBlogLike(ctx, fence, id, key); err != nil {
+				if errors.Is(err, model.ErrStaleFence) {
+					return err
+				}
+				logrus.Warnf("reconcile likes of blog %d failed: %v", id, err)
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	return reconcileEmptyLikes(ctx, fence)
+}
+
+// reconcileEmptyLikes 按 id 游标遍历 liked > 0 的博客，校准点赞集合已不存在的
+func reconcileEmptyLikes(ctx context.Context, fence model.Fence) error {
+	client := redis.GetRedisClient()
+	var lastId int64
+	for {
+		ids, err := new(model.Blog).QueryLikedBlogIdsAfter(lastId, likeFlushBatchSize)
+		if err != nil {
+			return fmt.Errorf("db query liked blogs after %d: %w", lastId, err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		pipe := client.Pipeline()
+		cmds := make([]*redisConfig.IntCmd, len(ids))
+		for i, id := range ids {
+			cmds[i] = pipe.Exists(ctx, redisx.BLOG_LIKE_KEY+strconv.FormatInt(id, 10))
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("check like keys: %w", err)
+		}
+		for i, id := range ids {
+			if cmds[i].Val() > 0 {
+				continue
+			}
+			if err := reconcileBlogLike(ctx, fence, id, redisx.BLOG_LIKE_KEY+strconv.FormatInt(id, 10)); err != nil {
+				if errors.Is(err, model.ErrStaleFence) {
+					return err
+				}
+				logrus.Warnf("reconcile likes of blog %d failed: %v", id, err)
+			}
+		}
+		lastId = ids[len(ids)-1]
+	}
+}
+
+func reconcileBlogLike(ctx context.Context, fence model.Fence, id int64, key string) error {
+	pipe := redis.GetRedisClient().TxPipeline()
+	cardCmd := pipe.ZCard(ctx, key)
+	deltaCmd := pipe.HGet(ctx, redisx.BLOG_LIKE_DELTA_KEY, strconv.FormatInt(id, 10))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redisConfig.Nil) {
+		return fmt.Errorf("read like state: %w", err)
+	}
+
+	pending, err := deltaCmd.Int64()
+	if err != nil && !errors.Is(err, redisConfig.Nil) {
+		return fmt.Errorf("parse pending like delta: %w", err)
+	}
+
+	blog := model.Blog{Id: id}
+	if err := blog.SetLiked(ctx, fence, cardCmd.Val()-pending); err != nil {
+		return fmt.Errorf("db set liked: %w", err)
+	}
+	return nil
+}
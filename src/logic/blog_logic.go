@@ -4,102 +4,144 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"local-review-go/src/config/mysql"
 	"local-review-go/src/config/redis"
 	"local-review-go/src/httpx"
 	"local-review-go/src/model"
+	"local-review-go/src/utils"
 	"local-review-go/src/utils/redisx"
 	"strconv"
-	"sync"
 	"time"
 
 	redisConfig "github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type BlogLogic interface {
 	SaveBlog(ctx context.Context, userID int64, blog *model.Blog) (int64, error)
-	LikeBlog(ctx context.Context, id, userID int64) error
+	LikeBlog(ctx context.Context, id, userID int64) (LikeResult, error)
 	QueryUserLike(ctx context.Context, id int64) ([]UserBrief, error)
 	QueryMyBlog(ctx context.Context, userID int64, current int) ([]model.Blog, error)
-	QueryHotBlogs(ctx context.Context, current int) ([]model.Blog, error)
+	QueryHotBlogs(ctx context.Context, cursor string, pageSize int) (httpx.CursorResult[model.Blog], error)
 	GetBlogById(ctx context.Context, id int64) (model.Blog, error)
-	QueryBlogOfFollow(ctx context.Context, maxTime int64, offset int, userID int64, pageSize int) (httpx.ScrollResult[model.Blog], error)
+	QueryBlogOfFollow(ctx context.Context, cursor string, userID int64, pageSize int) (httpx.CursorResult[model.Blog], error)
+	QueryBlogOfShop(ctx context.Context, shopID int64, sortBy string, current int, userID int64) ([]model.Blog, error)
+	UpdateBlog(ctx context.Context, userID int64, blog *model.Blog) error
+	DeleteBlog(ctx context.Context, id, userID int64) error
+	RestoreBlog(ctx context.Context, id, userID int64) error
+	QueryDeletedBlogs(ctx context.Context, userID int64) ([]model.Blog, error)
+	StartWorkers()
 }
 
-type blogLogic struct{}
+const (
+	blogDeleteRetention = 7 * 24 * time.Hour // 软删除保留期
+	blogPurgeInterval   = time.Hour
+	blogPurgeBatchSize  = 100
+)
 
-func NewBlogLogic() BlogLogic {
-	return &blogLogic{}
-}
+var (
+	// ErrBlogShopNotFound 博客关联的店铺不存在
+	ErrBlogShopNotFound = errors.New("关联的店铺不存在")
+	// ErrBlogForbidden 非作者操作博客
+	ErrBlogForbidden = errors.New("无权操作该博客")
+)
 
-func (l *blogLogic) SaveBlog(ctx context.Context, userID int64, blog *model.Blog) (res int64, err error) {
-	blog.CreateTime = time.Now()
-	blog.UpdateTime = time.Now()
+type blogLogic struct {
+	shopLogic   ShopLogic
+	uploadLogic UploadLogic
+	notify      NotificationLogic
+	blooms      *BloomRegistry
+	feedTasks   []chan feedTask
+}
 
-	id, err := blog.SaveBlog()
-	if err != nil {
-		logrus.Error("[Blog Service] failed to insert data!")
-		return 0, fmt.Errorf("db save blog user=%d: %w", userID, err)
+func NewBlogLogic(shopLogic ShopLogic, uploadLogic UploadLogic, notificationLogic NotificationLogic, blooms *BloomRegistry) BlogLogic {
+	tasks := make([]chan feedTask, feedWorkerCount)
+	for i := range tasks {
+		tasks[i] = make(chan feedTask, feedTaskBuffer)
 	}
-	var f model.Follow
-	follows, err := f.GetFollowsByFollowId(userID)
-	if err != nil {
-		return 0, fmt.Errorf("query followers of user %d: %w", userID, err)
+	return &blogLogic{
+		shopLogic:   shopLogic,
+		uploadLogic: uploadLogic,
+		notify:      notificationLogic,
+		blooms:      blooms,
+		feedTasks:   tasks,
 	}
+}
 
-	if len(follows) == 0 {
-		return
+func (l *blogLogic) StartWorkers() {
+	go l.purgeDeletedBlogs()
+	go l.recomputeHotBlogs()
+	go l.flushLikeDeltas()
+	go l.reconcileLikes()
+	for _, tasks := range l.feedTasks {
+		go l.runFeedWorker(tasks)
 	}
+	go l.drainPendingFeedTasks()
+}
 
-	for _, value := range follows {
-		followUserId := value.UserId
+func (l *blogLogic) SaveBlog(ctx context.Context, userID int64, blog *model.Blog) (res int64, err error) {
+	blog.UserId = userID
+	if blog.ShopId > 0 {
+		if _, err := l.queryShop(ctx, blog.ShopId); err != nil {
+			return 0, err
+		}
+	}
 
-		redisKey := redisx.FEED_KEY + strconv.FormatInt(followUserId, 10)
-		if err := redis.GetRedisClient().ZAdd(ctx, redisKey, redisConfig.Z{
-			Member: blog.Id,
-			Score:  float64(time.Now().Unix()),
-		}).Err(); err != nil {
-			logrus.Warnf("push blog %d to feed %d failed: %v", blog.Id, followUserId, err)
+	blog.CreateTime = time.Now()
+	blog.UpdateTime = time.Now()
+
+	var id int64
+	err = mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var saveErr error
+		id, saveErr = blog.SaveBlog(tx)
+		if saveErr != nil {
+			return fmt.Errorf("db save blog user=%d: %w", userID, saveErr)
 		}
+		_, _, err := postCredits(tx, CreditPosting{
+			UserId:  userID,
+			BizType: model.CREDIT_BIZ_BLOG,
+			BizKey:  blogBizKey(id),
+			Amount:  blogCredits,
+		})
+		return err
+	})
+	if err != nil {
+		logrus.Error("[Blog Service] failed to insert data!")
+		return 0, err
 	}
+	l.blooms.Add(BloomBlog, id)
+	updateHotScore(ctx, blog)
+	l.enqueueFeedTask(feedTask{op: feedPush, blogId: id, authorId: userID, createTime: blog.CreateTime})
 
 	res = id
 	return
 }
 
-func (l *blogLogic) LikeBlog(ctx context.Context, id, userID int64) (err error) {
-	userStr := strconv.FormatInt(userID, 10)
-	redisKey := redisx.BLOG_LIKE_KEY + strconv.FormatInt(id, 10)
-	_, err = redis.GetRedisClient().ZScore(ctx, redisKey, userStr).Result()
-
-	flag := false
+// LikeBlog 点赞/取消点赞，由 Lua 脚本保证切换的原子性，点赞数异步批量写回 MySQL
+func (l *blogLogic) LikeBlog(ctx context.Context, id, userID int64) (LikeResult, error) {
+	var blog model.Blog
+	if err := blog.GetBlogById(id); err != nil {
+		return LikeResult{}, fmt.Errorf("db get blog %d: %w", id, err)
+	}
 
+	result, err := toggleBlogLike(ctx, id, userID)
 	if err != nil {
-		if err == redisConfig.Nil {
-			flag = true
-		} else {
-			return fmt.Errorf("zscore blog like cache blog=%d user=%d: %w", id, userID, err)
-		}
+		return LikeResult{}, fmt.Errorf("toggle blog like blog=%d user=%d: %w", id, userID, err)
 	}
 
-	var blog model.Blog
-	blog.Id = id
-
-	if flag {
-		blog.IncrLike()
-		err = redis.GetRedisClient().ZAdd(ctx, redisKey,
-			redisConfig.Z{
-				Score:  float64(time.Now().Unix()),
-				Member: userStr,
-			}).Err()
-	} else {
-		blog.DecrLike()
-		err = redis.GetRedisClient().ZRem(ctx, redisKey, userStr).Err()
+	blog.Liked = int(result.Liked)
+	updateHotScore(ctx, &blog)
+	if result.IsLike {
+		l.notify.Notify(ctx, NotifyEvent{
+			UserId:   blog.UserId,
+			ActorId:  userID,
+			Type:     model.NOTIFY_LIKE,
+			TargetId: blog.Id,
+			Content:  blog.Title,
+		})
 	}
-	if err != nil {
-		return fmt.Errorf("update blog like cache blog=%d user=%d: %w", id, userID, err)
-	}
-	return nil
+	return result, nil
 }
 
 func (l *blogLogic) QueryMyBlog(ctx context.Context, userID int64, current int) ([]model.Blog, error) {
@@ -112,27 +154,89 @@ func (l *blogLogic) QueryMyBlog(ctx context.Context, userID int64, current int)
 	return blogs, nil
 }
 
-func (l *blogLogic) QueryHotBlogs(ctx context.Context, current int) ([]model.Blog, error) {
-	var blogUtils model.Blog
-	blogs, err := blogUtils.QueryHots(current)
+// QueryHotBlogs 基于热榜 ZSET 的游标分页，作者信息批量填充
+func (l *blogLogic) QueryHotBlogs(ctx context.Context, cursor string, pageSize int) (httpx.CursorResult[model.Blog], error) {
+	cur, err := redisx.DecodeScoreCursor(cursor)
 	if err != nil {
-		return nil, fmt.Errorf("db query hot blogs page=%d: %w", current, err)
+		return httpx.CursorResult[model.Blog]{}, err
 	}
-	for i := range blogs {
-		id := blogs[i].UserId
-		user, err := new(model.User).GetUserById(id)
+
+	result, err := redis.GetRedisClient().ZRevRangeByScoreWithScores(ctx, redisx.BLOG_HOT_KEY,
+		&redisConfig.ZRangeBy{
+			Min:    "-inf",
+			Max:    cur.Max(),
+			Offset: int64(cur.Offset),
+			Count:  int64(pageSize),
+		}).Result()
+	if err != nil {
+		return httpx.CursorResult[model.Blog]{}, fmt.Errorf("zrevrangebyscore hot blogs: %w", err)
+	}
+	if len(result) == 0 {
+		exists, err := redis.GetRedisClient().Exists(ctx, redisx.BLOG_HOT_KEY).Result()
 		if err != nil {
-			logrus.Errorf("get user %d for blog %d failed: %v", id, blogs[i].Id, err)
-			continue
+			return httpx.CursorResult[model.Blog]{}, fmt.Errorf("exists hot blogs: %w", err)
 		}
-		blogs[i].Icon = user.Icon
-		blogs[i].Name = user.NickName
+		if exists == 0 {
+			// 热榜尚未构建时回退到数据库，游标格式与热榜一致，重建完成后可以继续翻页
+			return l.queryHotBlogsFromDB(ctx, cur, pageSize)
+		}
+		return httpx.CursorResult[model.Blog]{Data: []model.Blog{}}, nil
 	}
 
-	return blogs, nil
+	ids, err := parseZSetIds(result)
+	if err != nil {
+		return httpx.CursorResult[model.Blog]{}, err
+	}
+	blogs, err := new(model.Blog).QueryBlogByIds(ids)
+	if err != nil {
+		return httpx.CursorResult[model.Blog]{}, fmt.Errorf("db get blogs by ids %v: %w", ids, err)
+	}
+	if err := fillBlogUsers(blogs); err != nil {
+		return httpx.CursorResult[model.Blog]{}, err
+	}
+	if err := l.fillBlogShops(ctx, blogs); err != nil {
+		logrus.Warnf("fill shops for hot blogs failed: %v", err)
+	}
+
+	return httpx.CursorResult[model.Blog]{
+		Data:    blogs,
+		Cursor:  redisx.NextScoreCursor(cur, result).Encode(),
+		HasMore: len(result) == pageSize,
+	}, nil
+}
+
+// queryHotBlogsFromDB 在数据库中按与热榜相同的热度公式和窗口分页
+func (l *blogLogic) queryHotBlogsFromDB(ctx context.Context, cur redisx.ScoreCursor, pageSize int) (httpx.CursorResult[model.Blog], error) {
+	since := time.Now().Add(-hotBlogWindow)
+	blogs, scores, err := new(model.Blog).QueryHotsByScore(hotScoreExpr(), since, cur.Score, cur.Offset, pageSize)
+	if err != nil {
+		return httpx.CursorResult[model.Blog]{}, fmt.Errorf("db query hot blogs: %w", err)
+	}
+	if len(blogs) == 0 {
+		return httpx.CursorResult[model.Blog]{Data: []model.Blog{}}, nil
+	}
+	if err := fillBlogUsers(blogs); err != nil {
+		return httpx.CursorResult[model.Blog]{}, err
+	}
+	if err := l.fillBlogShops(ctx, blogs); err != nil {
+		logrus.Warnf("fill shops for hot blogs failed: %v", err)
+	}
+
+	page := make([]redisConfig.Z, len(blogs))
+	for i := range blogs {
+		page[i] = redisConfig.Z{Score: scores[i], Member: blogs[i].Id}
+	}
+	return httpx.CursorResult[model.Blog]{
+		Data:    blogs,
+		Cursor:  redisx.NextScoreCursor(cur, page).Encode(),
+		HasMore: len(blogs) == pageSize,
+	}, nil
 }
 
 func (l *blogLogic) GetBlogById(ctx context.Context, id int64) (model.Blog, error) {
+	if err := l.blooms.Check(BloomBlog, id); err != nil {
+		return model.Blog{}, err
+	}
 	var blog model.Blog
 	if err := blog.GetBlogById(id); err != nil {
 		return model.Blog{}, fmt.Errorf("db get blog %d: %w", id, err)
@@ -147,9 +251,250 @@ func (l *blogLogic) GetBlogById(ctx context.Context, id int64) (model.Blog, erro
 	blog.Name = user.NickName
 	blog.Icon = user.Icon
 
+	if blog.ShopId > 0 {
+		shop, err := l.queryShop(ctx, blog.ShopId)
+		if err != nil {
+			logrus.Warnf("get shop %d for blog %d failed: %v", blog.ShopId, id, err)
+		} else {
+			blog.Shop = shop.Brief()
+		}
+	}
+
 	return blog, nil
 }
 
+// QueryBlogOfShop 分页查询店铺关联的博客，支持按热度/最新排序
+func (l *blogLogic) QueryBlogOfShop(ctx context.Context, shopID int64, sortBy string, current int, userID int64) ([]model.Blog, error) {
+	order := "id desc"
+	if sortBy == model.BLOG_SORT_HOT {
+		order = hotScoreExpr() + " desc, id desc"
+	}
+	blogs, err := new(model.Blog).QueryBlogsOfShop(shopID, order, current)
+	if err != nil {
+		return nil, fmt.Errorf("db query blogs of shop %d page=%d: %w", shopID, current, err)
+	}
+	if len(blogs) == 0 {
+		return []model.Blog{}, nil
+	}
+
+	if err := fillBlogUsers(blogs); err != nil {
+		return nil, err
+	}
+	fillBlogLiked(ctx, userID, blogs)
+	return blogs, nil
+}
+
+// UpdateBlog 作者编辑博客
+func (l *blogLogic) UpdateBlog(ctx context.Context, userID int64, blog *model.Blog) error {
+	if blog.ShopId > 0 {
+		if _, err := l.queryShop(ctx, blog.ShopId); err != nil {
+			return err
+		}
+	}
+
+	var removedImages []string
+	err := mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing model.Blog
+		if err := tx.Where("id = ?", blog.Id).First(&existing).Error; err != nil {
+			return fmt.Errorf("db get blog %d: %w", blog.Id, err)
+		}
+		if existing.UserId != userID {
+			return ErrBlogForbidden
+		}
+
+		blog.UserId = userID
+		blog.UpdateTime = time.Now()
+		if err := blog.UpdateBlog(tx); err != nil {
+			return fmt.Errorf("db update blog %d: %w", blog.Id, err)
+		}
+
+		removedImages = diffImages(existing.Images, blog.Images)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range removedImages {
+		if err := l.uploadLogic.DeleteBlogImage(name); err != nil {
+			logrus.Warnf("delete blog %d image %s failed: %v", blog.Id, name, err)
+		}
+	}
+	return nil
+}
+
+// DeleteBlog 软删除博客：立即从粉丝 feed 与热榜中移除，并冲销发帖奖励，
+// 点赞、评论和图片在保留期过后由 purgeDeletedBlogs 清理，保留期内可恢复
+func (l *blogLogic) DeleteBlog(ctx context.Context, id, userID int64) error {
+	var blog model.Blog
+	err := mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", id).First(&blog).Error; err != nil {
+			return fmt.Errorf("db get blog %d: %w", id, err)
+		}
+		if blog.UserId != userID {
+			return ErrBlogForbidden
+		}
+		if err := blog.DeleteBlog(tx); err != nil {
+			return fmt.Errorf("db delete blog %d: %w", id, err)
+		}
+		// 冲销只记一次，恢复后不再重新发放，反复发帖删帖无法刷积分
+		_, _, err := postCredits(tx, CreditPosting{
+			UserId:   blog.UserId,
+			BizType:  model.CREDIT_BIZ_BLOG,
+			BizKey:   blogBizKey(id) + ":revoke",
+			Amount:   -blogCredits,
+			Reversal: true,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	removeHotScore(ctx, id)
+	l.enqueueFeedTask(feedTask{op: feedRemove, blogId: id, authorId: blog.UserId})
+	return nil
+}
+
+// RestoreBlog 恢复保留期内删除的博客，重新推送到粉丝 feed，删除时冲销的发帖奖励不再发放
+func (l *blogLogic) RestoreBlog(ctx context.Context, id, userID int64) error {
+	var blog model.Blog
+	err := mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := blog.GetDeletedBlogById(tx, id); err != nil {
+			return fmt.Errorf("db get deleted blog %d: %w", id, err)
+		}
+		if blog.UserId != userID {
+			return ErrBlogForbidden
+		}
+		if time.Since(blog.DeleteTime.Time) > blogDeleteRetention {
+			return fmt.Errorf("blog %d retention expired: %w", id, gorm.ErrRecordNotFound)
+		}
+		if err := blog.RestoreBlog(tx); err != nil {
+			return fmt.Errorf("db restore blog %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 删除期间的重建不会加载已删除的博客，恢复后重新加入布隆过滤器
+	l.blooms.Add(BloomBlog, id)
+	updateHotScore(ctx, &blog)
+	l.enqueueFeedTask(feedTask{op: feedPush, blogId: id, authorId: blog.UserId, createTime: blog.CreateTime})
+	return nil
+}
+
+// blogBizKey 发帖奖励的账本幂等键
+func blogBizKey(blogID int64) string {
+	return fmt.Sprintf("%s:%d", model.CREDIT_BIZ_BLOG, blogID)
+}
+
+// QueryDeletedBlogs 查询保留期内可恢复的博客
+func (l *blogLogic) QueryDeletedBlogs(ctx context.Context, userID int64) ([]model.Blog, error) {
+	blogs, err := new(model.Blog).QueryDeletedBlogs(userID, time.Now().Add(-blogDeleteRetention))
+	if err != nil {
+		return nil, fmt.Errorf("db query deleted blogs user=%d: %w", userID, err)
+	}
+	return blogs, nil
+}
+
+// purgeDeletedBlogs 定期物理清理超过保留期的博客及其点赞、评论和图片
+func (l *blogLogic) purgeDeletedBlogs() {
+	ticker := time.NewTicker(blogPurgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		lock, acquired, err := utils.NewLocker().
+			LockWithWatchDog(ctx, redisx.BLOG_PURGE_LOCK_KEY, 30*time.Second)
+		if err != nil || !acquired {
+			// 其它实例正在清理
+			continue
+		}
+
+		fence := lockFence(lock)
+		before := time.Now().Add(-blogDeleteRetention)
+		for {
+			blogs, err := new(model.Blog).QueryExpiredDeletedBlogs(before, blogPurgeBatchSize)
+			if err != nil {
+				logrus.Errorf("query expired deleted blogs failed: %v", err)
+				break
+			}
+			stale := false
+			for i := range blogs {
+				if err := l.purgeBlog(ctx, fence, &blogs[i]); err != nil {
+					logrus.Warnf("purge blog %d failed: %v", blogs[i].Id, err)
+					// 锁已被其它实例接管，交给新的持有者继续清理
+					if stale = errors.Is(err, model.ErrStaleFence); stale {
+						break
+					}
+				}
+			}
+			if stale || len(blogs) < blogPurgeBatchSize {
+				break
+			}
+		}
+
+		if err := lock.Unlock(ctx); err != nil {
+			logrus.Warnf("unlock blog purge failed: %v", err)
+		}
+	}
+}
+
+func (l *blogLogic) purgeBlog(ctx context.Context, fence model.Fence, blog *model.Blog) error {
+	err := mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := fence.Check(tx); err != nil {
+			return err
+		}
+		if err := new(model.BlogComments).DeleteCommentsOfBlog(tx, blog.Id); err != nil {
+			return fmt.Errorf("db delete comments of blog %d: %w", blog.Id, err)
+		}
+		if err := blog.PurgeBlog(tx); err != nil {
+			return fmt.Errorf("db purge blog %d: %w", blog.Id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 删除时的 feedRemove 任务可能失败或被丢弃，物理删除前再从 feed 中清理一次
+	if err := removeBlogFromFeeds(ctx, feedTask{op: feedRemove, blogId: blog.Id, authorId: blog.UserId}); err != nil {
+		logrus.Warnf("remove purged blog %d from feeds failed: %v", blog.Id, err)
+	}
+
+	redisKey := redisx.BLOG_LIKE_KEY + strconv.FormatInt(blog.Id, 10)
+	pipe := redis.GetRedisClient().TxPipeline()
+	pipe.Del(ctx, redisKey)
+	pipe.HDel(ctx, redisx.BLOG_LIKE_DELTA_KEY, strconv.FormatInt(blog.Id, 10))
+	if _, err := pipe.Exec(ctx); err != nil {
+		logrus.Warnf("del blog like cache %d failed: %v", blog.Id, err)
+	}
+	for _, name := range splitImages(blog.Images) {
+		if err := l.uploadLogic.DeleteBlogImage(name); err != nil {
+			logrus.Warnf("delete blog %d image %s failed: %v", blog.Id, name, err)
+		}
+	}
+	return nil
+}
+
+// queryShop 经布隆过滤器、缓存和数据库校验店铺是否存在
+func (l *blogLogic) queryShop(ctx context.Context, shopID int64) (model.Shop, error) {
+	shop, err := l.shopLogic.QueryShopByIdWithCacheNull(ctx, shopID)
+	if err != nil {
+		if errors.Is(err, ErrShopBlocked) {
+			return model.Shop{}, ErrBlogShopNotFound
+		}
+		return model.Shop{}, fmt.Errorf("query shop %d: %w", shopID, err)
+	}
+	// 空缓存/数据库不存在时返回零值
+	if shop.Id == 0 {
+		return model.Shop{}, ErrBlogShopNotFound
+	}
+	return shop, nil
+}
+
 // QueryUserLike 查询点赞该博客最早的5个用户
 func (l *blogLogic) QueryUserLike(ctx context.Context, id int64) ([]UserBrief, error) {
 	redisKey := redisx.BLOG_LIKE_KEY + strconv.FormatInt(id, 10)
@@ -186,83 +531,125 @@ func (l *blogLogic) QueryUserLike(ctx context.Context, id int64) ([]UserBrief, e
 	return userDTOS, nil
 }
 
-func (l *blogLogic) QueryBlogOfFollow(ctx context.Context, maxTime int64, offset int, userID int64, pageSize int) (httpx.ScrollResult[model.Blog], error) {
-	redisKey := redisx.FEED_KEY + strconv.FormatInt(userID, 10)
+// QueryBlogOfFollow 按游标滚动查询关注的人的博客，收件箱与大V发件箱在读时归并
+func (l *blogLogic) QueryBlogOfFollow(ctx context.Context, cursor string, userID int64, pageSize int) (httpx.CursorResult[model.Blog], error) {
+	cur, err := redisx.DecodeScoreCursor(cursor)
+	if err != nil {
+		return httpx.CursorResult[model.Blog]{}, err
+	}
+	if cursor == "" {
+		touchFeedActive(ctx, userID)
+	}
 
-	result, err := redis.GetRedisClient().ZRevRangeByScoreWithScores(ctx, redisKey,
-		&redisConfig.ZRangeBy{
-			Min:    "0",
-			Max:    strconv.FormatInt(maxTime, 10),
-			Offset: int64(offset),
-			Count:  int64(pageSize),
-		}).Result()
-	if err != nil || len(result) == 0 {
-		if err != nil {
-			return httpx.ScrollResult[model.Blog]{}, fmt.Errorf("zrevrangebyscore feed %d: %w", userID, err)
-		}
-		return httpx.ScrollResult[model.Blog]{}, nil
+	page, err := readFeedBlogs(ctx, userID, cur, pageSize, new(model.Blog).QueryBlogByIds)
+	if err != nil {
+		return httpx.CursorResult[model.Blog]{}, err
+	}
+	if len(page.raw) == 0 {
+		return httpx.CursorResult[model.Blog]{Data: []model.Blog{}}, nil
 	}
+	blogs := page.blogs
 
-	var (
-		ids     []int64
-		minTime = int64(0)
-		os      = 0
-	)
-	for _, value := range result {
-		id := value.Member.(int64)
-		ids = append(ids, id)
+	if err := fillBlogUsers(blogs); err != nil {
+		return httpx.CursorResult[model.Blog]{}, err
+	}
+	fillBlogLiked(ctx, userID, blogs)
+	if err := l.fillBlogShops(ctx, blogs); err != nil {
+		logrus.Warnf("fill shops for feed of user %d failed: %v", userID, err)
+	}
 
-		score := int64(value.Score)
-		if score == minTime {
-			os++
-		} else {
-			minTime = score
-			os = 1
+	return httpx.CursorResult[model.Blog]{
+		Data:    blogs,
+		Cursor:  redisx.NextScoreCursor(cur, page.raw).Encode(),
+		HasMore: len(page.raw) == pageSize,
+	}, nil
+}
+
+// fillBlogUsers 批量填充博客作者信息
+func fillBlogUsers(blogs []model.Blog) error {
+	ids := make([]int64, 0, len(blogs))
+	seen := make(map[int64]struct{}, len(blogs))
+	for i := range blogs {
+		if _, ok := seen[blogs[i].UserId]; ok {
+			continue
 		}
+		seen[blogs[i].UserId] = struct{}{}
+		ids = append(ids, blogs[i].UserId)
+	}
+	if len(ids) == 0 {
+		return nil
 	}
 
-	blogs, err := new(model.Blog).QueryBlogByIds(ids)
+	users, err := new(model.User).GetUsersByIds(ids)
 	if err != nil {
-		return httpx.ScrollResult[model.Blog]{}, fmt.Errorf("db get blogs by ids %v: %w", ids, err)
+		return fmt.Errorf("db get users by ids %v: %w", ids, err)
+	}
+	userMap := make(map[int64]model.User, len(users))
+	for _, u := range users {
+		userMap[u.Id] = u
 	}
-
-	var wg sync.WaitGroup
 	for i := range blogs {
-		wg.Add(2)
-		go func(b *model.Blog) {
-			defer wg.Done()
-			if err := createBlogUser(b); err != nil {
-				logrus.Warnf("Fill user failed for blog %d: %v", b.Id, err)
-			}
-		}(&blogs[i])
-
-		go func(b *model.Blog) {
-			defer wg.Done()
-			isBlogLiked(ctx, userID, b)
-		}(&blogs[i])
+		if u, ok := userMap[blogs[i].UserId]; ok {
+			blogs[i].Name = u.NickName
+			blogs[i].Icon = u.Icon
+		}
 	}
-	wg.Wait()
-
-	return httpx.ScrollResult[model.Blog]{
-		Data:    blogs,
-		MinTime: minTime,
-		Offset:  os,
-	}, nil
+	return nil
 }
 
-func createBlogUser(blog *model.Blog) error {
-	userId := blog.UserId
-	user, err := new(model.User).GetUserById(userId)
+// fillBlogShops 批量填充博客关联的店铺简要信息
+func (l *blogLogic) fillBlogShops(ctx context.Context, blogs []model.Blog) error {
+	ids := make([]int64, 0, len(blogs))
+	seen := make(map[int64]struct{}, len(blogs))
+	for i := range blogs {
+		shopId := blogs[i].ShopId
+		if shopId <= 0 {
+			continue
+		}
+		if _, ok := seen[shopId]; ok {
+			continue
+		}
+		seen[shopId] = struct{}{}
+		ids = append(ids, shopId)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	shops, err := l.shopLogic.QueryShopsByIds(ctx, ids)
 	if err != nil {
-		return fmt.Errorf("failed to get user %d: %w", blog.UserId, err)
+		return err
+	}
+	shopMap := make(map[int64]*model.ShopBrief, len(shops))
+	for i := range shops {
+		shopMap[shops[i].Id] = shops[i].Brief()
+	}
+	for i := range blogs {
+		if brief, ok := shopMap[blogs[i].ShopId]; ok {
+			blogs[i].Shop = brief
+		}
 	}
-	blog.Name = user.NickName
-	blog.Icon = user.Icon
 	return nil
 }
 
-func isBlogLiked(ctx context.Context, userID int64, blog *model.Blog) {
-	redisKey := redisx.BLOG_LIKE_KEY + strconv.FormatInt(blog.Id, 10)
-	err := redis.GetRedisClient().ZScore(ctx, redisKey, strconv.FormatInt(userID, 10)).Err()
-	blog.IsLike = !errors.Is(err, redisConfig.Nil)
+// fillBlogLiked 通过 Pipeline 批量判断当前用户是否点赞
+func fillBlogLiked(ctx context.Context, userID int64, blogs []model.Blog) {
+	if userID <= 0 || len(blogs) == 0 {
+		return
+	}
+	member := strconv.FormatInt(userID, 10)
+	pipe := redis.GetRedisClient().Pipeline()
+	cmds := make([]*redisConfig.FloatCmd, len(blogs))
+	for i := range blogs {
+		redisKey := redisx.BLOG_LIKE_KEY + strconv.FormatInt(blogs[i].Id, 10)
+		cmds[i] = pipe.ZScore(ctx, redisKey, member)
+	}
+	// ZScore 未命中会返回 redis.Nil，逐条判断即可
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redisConfig.Nil) {
+		logrus.Warnf("query like state for user %d failed: %v", userID, err)
+		return
+	}
+	for i := range blogs {
+		blogs[i].IsLike = cmds[i].Err() == nil
+	}
 }
@@ -0,0 +1,212 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/src/model"
+	"local-review-go/src/utils"
+	"local-review-go/src/utils/redisx"
+	"time"
+
+	redisv9 "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 已注册的布隆过滤器名称，Redis key 为 redisx.BLOOM_KEY + 名称
+const (
+	BloomShop    = "shop"
+	BloomUser    = "user"
+	BloomBlog    = "blog"
+	BloomVoucher = "voucher"
+)
+
+const (
+	bloomRebuildInterval = 24 * time.Hour // 布隆过滤器的重建周期，淘汰已删除的数据
+	bloomCheckInterval   = time.Hour      // 检查是否需要重建并上报统计的周期
+	bloomLoadBatchSize   = 500
+	bloomFalsePositive   = 0.01
+)
+
+// ErrBloomBlocked 布隆过滤器判定数据不存在，同时包装 gorm.ErrRecordNotFound，沿用各接口的 404 处理
+var ErrBloomBlocked = errors.New("blocked by Bloom Filter")
+
+// bloomIdLoader 按 id 游标分批查询某张表的 id
+type bloomIdLoader func(lastId int64, limit int) ([]int64, error)
+
+type bloomEntry struct {
+	name   string
+	filter utils.BloomFilter
+	load   bloomIdLoader
+}
+
+// BloomRegistry 按名称管理防缓存穿透的布隆过滤器，负责启动时预热、定期重建与健康上报
+// 方法对 nil 接收者安全：未注册或查询失败时一律放行，由数据库给出最终结果
+type BloomRegistry struct {
+	locker  utils.Locker
+	entries []*bloomEntry
+	byName  map[string]*bloomEntry
+}
+
+// NewBloomRegistry 创建并注册店铺、用户、博客与优惠券的布隆过滤器
+func NewBloomRegistry(client *redisv9.Client, locker utils.Locker) *BloomRegistry {
+	r := &BloomRegistry{locker: locker, byName: make(map[string]*bloomEntry)}
+	r.register(client, BloomShop, 100000, new(model.Shop).QueryShopIdsAfter)
+	r.register(client, BloomUser, 1000000, new(model.User).QueryUserIdsAfter)
+	r.register(client, BloomBlog, 1000000, new(model.Blog).QueryBlogIdsAfter)
+	r.register(client, BloomVoucher, 100000, new(model.Voucher).QueryVoucherIdsAfter)
+	return r
+}
+
+func (r *BloomRegistry) register(client *redisv9.Client, name string, capacity uint64, load bloomIdLoader) {
+	entry := &bloomEntry{
+		name:   name,
+		filter: utils.NewBloomFilter(client, redisx.BLOOM_KEY+name, capacity, bloomFalsePositive),
+		load:   load,
+	}
+	logrus.Infof("Bloom Filter %s initialized: %s", name, entry.filter.DebugInfo())
+	r.entries = append(r.entries, entry)
+	r.byName[name] = entry
+}
+
+// Filter 按名称获取布隆过滤器，未注册时返回 nil
+func (r *BloomRegistry) Filter(name string) utils.BloomFilter {
+	if r == nil {
+		return nil
+	}
+	if entry, ok := r.byName[name]; ok {
+		return entry.filter
+	}
+	return nil
+}
+
+// Check 布隆过滤器判定 id 肯定不存在时返回 ErrBloomBlocked，过滤器不可用时放行
+func (r *BloomRegistry) Check(name string, id int64) error {
+	filter := r.Filter(name)
+	if filter == nil {
+		return nil
+	}
+	exists, err := filter.Contains(id)
+	if err != nil {
+		logrus.Warnf("Bloom Filter %s check failed for %d: %v", name, id, err)
+		return nil
+	}
+	if !exists {
+		return fmt.Errorf("%s %d %w: %w", name, id, ErrBloomBlocked, gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// Add 新建数据后写入布隆过滤器，失败只记录日志，由定期重建补齐
+func (r *BloomRegistry) Add(name string, id int64) {
+	filter := r.Filter(name)
+	if filter == nil || id <= 0 {
+		return
+	}
+	if err := filter.Add(id); err != nil {
+		logrus.Warnf("Failed to add %s %d to Bloom Filter: %v", name, id, err)
+	}
+}
+
+// StartWorkers 启动布隆过滤器的维护任务，从未构建或超过重建周期时从 MySQL 全量重建，
+// 已预热且未过期的过滤器直接跳过，上次中断的重建从检查点继续
+func (r *BloomRegistry) StartWorkers() {
+	if r == nil {
+		return
+	}
+	go r.maintain()
+}
+
+func (r *BloomRegistry) maintain() {
+	r.rebuildStale()
+
+	ticker := time.NewTicker(bloomCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.rebuildStale()
+	}
+}
+
+func (r *BloomRegistry) rebuildStale() {
+	for _, entry := range r.entries {
+		r.rebuildWithLock(entry)
+	}
+}
+
+func (r *BloomRegistry) rebuildWithLock(entry *bloomEntry) {
+	ctx := context.Background()
+	stats, err := entry.filter.Stats(ctx)
+	if err != nil {
+		logrus.Warnf("stats %s bloom filter failed: %v", entry.name, err)
+		return
+	}
+	logrus.Infof("%s bloom filter: backend=%s generation=%d layers=%d items=%d estimated=%.0f fpRate=%.5f",
+		entry.name, stats.Backend, stats.Generation, len(stats.Layers), stats.Items, stats.EstimatedItems, stats.FalsePositiveRate)
+	if time.Since(stats.BuiltAt) < bloomRebuildInterval {
+		return
+	}
+
+	lock, acquired, err := r.locker.LockWithWatchDog(ctx, redisx.BLOOM_LOCK_KEY+entry.name, 30*time.Second)
+	if err != nil || !acquired {
+		return
+	}
+	defer lock.Unlock(ctx)
+
+	lockCtx, cancel := lock.Context(ctx)
+	defer cancel()
+	start := time.Now()
+	if err := entry.filter.Rebuild(lockCtx, entry.loadIds); err != nil {
+		if !errors.Is(err, utils.ErrBloomRebuilding) {
+			logrus.Errorf("rebuild %s bloom filter failed: %v", entry.name, err)
+		}
+		return
+	}
+	logrus.Infof("%s bloom filter rebuilt in %v", entry.name, time.Since(start))
+}
+
+// loadIds 从 after 之后按 id 游标分批读取数据，重建中断后从检查点继续
+func (e *bloomEntry) loadIds(after int64, add func(ids []int64) error) error {
+	lastId := after
+	for {
+		ids, err := e.load(lastId, bloomLoadBatchSize)
+		if err != nil {
+			return fmt.Errorf("db query %s ids after %d: %w", e.name, lastId, err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := add(ids); err != nil {
+			return err
+		}
+		lastId = ids[len(ids)-1]
+	}
+}
+
+// BloomHealth 单个布隆过滤器的健康状态
+type BloomHealth struct {
+	Name  string            `json:"name"`
+	Stats *utils.BloomStats `json:"stats,omitempty"`
+	Error string            `json:"error,omitempty"`
+}
+
+// Health 汇总所有布隆过滤器的统计信息，任一过滤器无法读取时 ok 为 false
+func (r *BloomRegistry) Health(ctx context.Context) ([]BloomHealth, bool) {
+	if r == nil {
+		return []BloomHealth{}, true
+	}
+	healthy := true
+	result := make([]BloomHealth, 0, len(r.entries))
+	for _, entry := range r.entries {
+		h := BloomHealth{Name: entry.name}
+		stats, err := entry.filter.Stats(ctx)
+		if err != nil {
+			healthy = false
+			h.Error = err.Error()
+		} else {
+			h.Stats = &stats
+		}
+		result = append(result, h)
+	}
+	return result, healthy
+}
@@ -0,0 +1,50 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"local-review-go/src/utils"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestBloomRegistryCheck(t *testing.T) {
+	client := setupFeedRedis(t)
+	blooms := NewBloomRegistry(client, utils.NewDistributedLock(client))
+	ctx := context.Background()
+
+	// 预热完成前一律放行
+	if err := blooms.Check(BloomBlog, 42); err != nil {
+		t.Fatalf("check before warm-up: %v", err)
+	}
+	warmUp := func(after int64, add func(ids []int64) error) error { return nil }
+	for _, name := range []string{BloomBlog, BloomUser} {
+		if err := blooms.Filter(name).Rebuild(ctx, warmUp); err != nil {
+			t.Fatalf("warm up %s: %v", name, err)
+		}
+	}
+
+	err := blooms.Check(BloomBlog, 42)
+	if !errors.Is(err, ErrBloomBlocked) || !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("check unknown blog: err = %v", err)
+	}
+	blooms.Add(BloomBlog, 42)
+	if err := blooms.Check(BloomBlog, 42); err != nil {
+		t.Fatalf("check added blog: %v", err)
+	}
+	// 各过滤器互不影响
+	if err := blooms.Check(BloomUser, 42); !errors.Is(err, ErrBloomBlocked) {
+		t.Fatalf("check user with blog id: err = %v", err)
+	}
+
+	// 未注册的过滤器与 nil 注册表都放行
+	if err := blooms.Check("unknown", 1); err != nil {
+		t.Fatalf("check unregistered filter: %v", err)
+	}
+	var none *BloomRegistry
+	if err := none.Check(BloomBlog, 1); err != nil {
+		t.Fatalf("check nil registry: %v", err)
+	}
+	none.Add(BloomBlog, 1)
+}
@@ -0,0 +1,129 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 各业务获得的积分
+const (
+	reviewCredits = 10
+	blogCredits   = 5
+)
+
+var ErrCreditsAmount = errors.New("积分数额无效")
+
+// CreditPosting 一次记账请求，Amount 为正表示用户获得，为负表示用户消费
+// Reversal 表示冲销此前发放的奖励：Amount 为负，对方账户仍为发放账户，余额不足时允许扣为负数
+type CreditPosting struct {
+	UserId   int64
+	BizType  string // model.CREDIT_BIZ_*
+	BizKey   string // 幂等键，同一事件只记账一次
+	Amount   int
+	Reversal bool
+}
+
+// CreditBalance 积分余额
+type CreditBalance struct {
+	Credits int `json:"credits"`
+}
+
+// CreditLogic 积分账户：余额与流水查询；记账通过 postCredits 在业务事务中完成
+type CreditLogic interface {
+	Balance(ctx context.Context, userID int64) (CreditBalance, error)
+	QueryHistory(ctx context.Context, userID int64, current int) ([]model.CreditEntry, int64, error)
+}
+
+type creditLogic struct{}
+
+func NewCreditLogic() CreditLogic {
+	return &creditLogic{}
+}
+
+func (l *creditLogic) Balance(ctx context.Context, userID int64) (CreditBalance, error) {
+	var userInfoUtils model.UserInfo
+	credits, err := userInfoUtils.GetCredits(mysql.GetMysqlDB().WithContext(ctx), userID)
+	if err != nil {
+		return CreditBalance{}, fmt.Errorf("db get credits of user %d: %w", userID, err)
+	}
+	return CreditBalance{Credits: credits}, nil
+}
+
+// QueryHistory 分页查询用户的积分流水，每条流水附带记账后的余额
+func (l *creditLogic) QueryHistory(ctx context.Context, userID int64, current int) ([]model.CreditEntry, int64, error) {
+	entries, total, err := new(model.CreditEntry).QueryUserEntries(userID, current)
+	if err != nil {
+		return nil, 0, fmt.Errorf("db query credit entries user=%d page=%d: %w", userID, current, err)
+	}
+	return entries, total, nil
+}
+
+// postCredits 在事务 tx 中记账：写入业务记录、变更用户余额并写入借贷两条分录
+// 幂等键已存在时不重复记账，返回已有记录且 created 为 false；消费时余额不足返回 model.ErrCreditsNotEnough
+func postCredits(tx *gorm.DB, posting CreditPosting) (txn model.CreditTxn, created bool, err error) {
+	if posting.Amount == 0 || posting.BizKey == "" || (posting.Reversal && posting.Amount > 0) {
+		return model.CreditTxn{}, false, ErrCreditsAmount
+	}
+
+	now := time.Now()
+	txn = model.CreditTxn{
+		BizKey:     posting.BizKey,
+		BizType:    posting.BizType,
+		UserId:     posting.UserId,
+		Amount:     posting.Amount,
+		CreateTime: now,
+	}
+	created, err = txn.CreateIfAbsent(tx)
+	if err != nil {
+		return model.CreditTxn{}, false, fmt.Errorf("db create credit txn %s: %w", posting.BizKey, err)
+	}
+	if !created {
+		return txn, false, nil
+	}
+
+	var userInfoUtils model.UserInfo
+	counterAccount := model.CREDIT_ACCOUNT_REWARD
+	if posting.Amount > 0 || posting.Reversal {
+		err = userInfoUtils.AddCredits(tx, posting.UserId, posting.Amount)
+	} else {
+		counterAccount = model.CREDIT_ACCOUNT_SPEND
+		err = userInfoUtils.DeductCredits(tx, posting.UserId, -posting.Amount)
+	}
+	if err != nil {
+		return model.CreditTxn{}, false, fmt.Errorf("db change credits of user %d by %d: %w", posting.UserId, posting.Amount, err)
+	}
+
+	balance, err := userInfoUtils.GetCredits(tx, posting.UserId)
+	if err != nil {
+		return model.CreditTxn{}, false, fmt.Errorf("db get credits of user %d: %w", posting.UserId, err)
+	}
+	entries := []model.CreditEntry{
+		{
+			TxnId:      txn.Id,
+			Account:    model.CREDIT_ACCOUNT_USER,
+			UserId:     posting.UserId,
+			BizType:    posting.BizType,
+			Amount:     posting.Amount,
+			Balance:    balance,
+			CreateTime: now,
+		},
+		{
+			TxnId:      txn.Id,
+			Account:    counterAccount,
+			UserId:     posting.UserId,
+			BizType:    posting.BizType,
+			Amount:     -posting.Amount,
+			CreateTime: now,
+		},
+	}
+	if err := new(model.CreditEntry).CreateEntries(tx, entries); err != nil {
+		return model.CreditTxn{}, false, fmt.Errorf("db create credit entries of txn %d: %w", txn.Id, err)
+	}
+	return txn, true, nil
+}
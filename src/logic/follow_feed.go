@@ -0,0 +1,180 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"local-review-go/src/config/redis"
+	"local-review-go/src/model"
+	"local-review-go/src/utils/redisx"
+	"strconv"
+	"time"
+
+	redisConfig "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	followFeedWorkerCount = 4
+	followFeedTaskBuffer  = 1024
+	followBackfillSize    = 20 // 关注后补齐对方最近的博客数
+)
+
+type followFeedTask struct {
+	follow   bool
+	sync     bool // 队列满时暂存的任务，执行时按 MySQL 中的关注关系补齐或清理
+	userId   int64
+	authorId int64
+}
+
+// enqueueFeedTask 按用户分片投递，同一用户的关注/取关按顺序执行，不阻塞关注请求
+// 队列已满时只把关注关系记入 Redis 待补做集合，由后台按最终的关注关系补做；
+// 不能另起 goroutine 执行，否则取关可能先于关注的补齐完成
+func (l *followLogic) enqueueFeedTask(task followFeedTask) {
+	select {
+	case l.feedShard(task.userId) <- task:
+	default:
+		member := fmt.Sprintf("%d:%d", task.userId, task.authorId)
+		if err := redis.GetRedisClient().SAdd(context.Background(), redisx.FEED_SYNC_FOLLOW_KEY, member).Err(); err != nil {
+			logrus.Errorf("feed task queue full and save pending failed, follow=%v user=%d author=%d: %v", task.follow, task.userId, task.authorId, err)
+		}
+	}
+}
+
+func (l *followLogic) feedShard(userId int64) chan followFeedTask {
+	return l.feedTasks[userId%int64(len(l.feedTasks))]
+}
+
+func (l *followLogic) runFeedWorker(tasks chan followFeedTask) {
+	for task := range tasks {
+		l.handleFeedTask(task)
+	}
+}
+
+// drainPendingFeedTasks 定期取出待补做的关注关系，投递到用户所在的分片
+// 后台 goroutine 可以阻塞等待队列空闲，不会丢弃任务
+func (l *followLogic) drainPendingFeedTasks() {
+	ticker := time.NewTicker(feedPendingInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx := context.Background()
+		for {
+			members, err := redis.GetRedisClient().SPopN(ctx, redisx.FEED_SYNC_FOLLOW_KEY, feedPendingBatchSize).Result()
+			if err != nil {
+				logrus.Warnf("spop pending follow feed tasks failed: %v", err)
+				break
+			}
+			for _, member := range members {
+				var userId, authorId int64
+				if _, err := fmt.Sscanf(member, "%d:%d", &userId, &authorId); err != nil {
+					logrus.Warnf("skip invalid pending follow feed task %s", member)
+					continue
+				}
+				l.feedShard(userId) <- followFeedTask{sync: true, userId: userId, authorId: authorId}
+			}
+			if len(members) < feedPendingBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// handleFeedTask 执行前以 MySQL 中的关注关系为准，关系已被后续操作改变时跳过，
+// 交给同一用户之后的任务处理最终状态
+func (l *followLogic) handleFeedTask(task followFeedTask) {
+	ctx := context.Background()
+	f := model.Follow{UserId: task.userId, FollowUserId: task.authorId}
+	count, err := f.IsFollowing()
+	if err != nil {
+		logrus.Warnf("feed task follow=%v user=%d author=%d: db check follow failed: %v", task.follow, task.userId, task.authorId, err)
+		return
+	}
+	if task.sync {
+		task.follow = count > 0
+	} else if (count > 0) != task.follow {
+		return
+	}
+
+	if task.follow {
+		err = backfillFollowee(ctx, task.userId, task.authorId)
+	} else {
+		err = purgeFollowee(ctx, task.userId, task.authorId)
+	}
+	if err != nil {
+		logrus.Warnf("feed task follow=%v user=%d author=%d failed: %v", task.follow, task.userId, task.authorId, err)
+	}
+}
+
+// backfillFollowee 把新关注的作者最近的博客写入收件箱，大V的博客读时拉取，无需补齐
+func backfillFollowee(ctx context.Context, userID, authorID int64) error {
+	client := redis.GetRedisClient()
+	celebrity, err := client.SIsMember(ctx, redisx.FEED_CELEBRITY_KEY, authorID).Result()
+	if err != nil {
+		return fmt.Errorf("sismember celebrity %d: %w", authorID, err)
+	}
+	if celebrity {
+		return nil
+	}
+
+	blogs, err := new(model.Blog).QueryLatestBlogsOfUser(authorID, followBackfillSize)
+	if err != nil {
+		return fmt.Errorf("db query latest blogs of user %d: %w", authorID, err)
+	}
+	if len(blogs) == 0 {
+		return nil
+	}
+
+	members := make([]redisConfig.Z, len(blogs))
+	for i := range blogs {
+		members[i] = redisConfig.Z{
+			Score:  float64(blogs[i].CreateTime.Unix()),
+			Member: blogs[i].Id,
+		}
+	}
+	feedKey := redisx.FEED_KEY + strconv.FormatInt(userID, 10)
+	pipe := client.Pipeline()
+	pipe.ZAdd(ctx, feedKey, members...)
+	trimFeed(ctx, pipe, feedKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("backfill feed of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// purgeFollowee 从收件箱中移除取关作者的博客，收件箱有长度上限，直接全量比对
+func purgeFollowee(ctx context.Context, userID, authorID int64) error {
+	client := redis.GetRedisClient()
+	feedKey := redisx.FEED_KEY + strconv.FormatInt(userID, 10)
+
+	members, err := client.ZRange(ctx, feedKey, 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("zrange feed of user %d: %w", userID, err)
+	}
+	if len(members) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	authorBlogIds, err := new(model.Blog).QueryBlogIdsOfUser(authorID, ids)
+	if err != nil {
+		return fmt.Errorf("db filter blogs of user %d: %w", authorID, err)
+	}
+	if len(authorBlogIds) == 0 {
+		return nil
+	}
+
+	removed := make([]interface{}, len(authorBlogIds))
+	for i, id := range authorBlogIds {
+		removed[i] = id
+	}
+	if err := client.ZRem(ctx, feedKey, removed...).Err(); err != nil {
+		return fmt.Errorf("zrem blogs of user %d from feed of user %d: %w", authorID, userID, err)
+	}
+	return nil
+}
@@ -16,12 +16,31 @@ type FollowLogic interface {
 	Follow(ctx context.Context, id, userID int64, isFollow bool) error
 	FollowCommons(ctx context.Context, id, userID int64) ([]UserBrief, error)
 	IsFollow(ctx context.Context, id, userID int64) (bool, error)
+	StartWorkers()
 }
 
-type followLogic struct{}
+type followLogic struct {
+	notify    NotificationLogic
+	feedTasks []chan followFeedTask
+}
+
+func NewFollowLogic(notificationLogic NotificationLogic) FollowLogic {
+	tasks := make([]chan followFeedTask, followFeedWorkerCount)
+	for i := range tasks {
+		tasks[i] = make(chan followFeedTask, followFeedTaskBuffer)
+	}
+	return &followLogic{
+		notify:    notificationLogic,
+		feedTasks: tasks,
+	}
+}
 
-func NewFollowLogic() FollowLogic {
-	return &followLogic{}
+// StartWorkers 启动关注/取关后异步维护 feed 的 worker
+func (l *followLogic) StartWorkers() {
+	for _, tasks := range l.feedTasks {
+		go l.runFeedWorker(tasks)
+	}
+	go l.drainPendingFeedTasks()
 }
 
 func (l *followLogic) Follow(ctx context.Context, id, userID int64, isFollow bool) error {
@@ -35,6 +54,7 @@ func (l *followLogic) Follow(ctx context.Context, id, userID int64, isFollow boo
 		if _, err := redis.GetRedisClient().SRem(ctx, redisKey, id).Result(); err != nil {
 			logrus.Errorf("Redis SRem failed: %v", err)
 		}
+		l.enqueueFeedTask(followFeedTask{follow: false, userId: userID, authorId: id})
 	} else {
 		var f model.Follow
 		f.UserId = userID
@@ -46,6 +66,12 @@ func (l *followLogic) Follow(ctx context.Context, id, userID int64, isFollow boo
 		if _, err := redis.GetRedisClient().SAdd(ctx, redisKey, id).Result(); err != nil {
 			logrus.Errorf("Redis SAdd failed: %v", err)
 		}
+		l.enqueueFeedTask(followFeedTask{follow: true, userId: userID, authorId: id})
+		l.notify.Notify(ctx, NotifyEvent{
+			UserId:  id,
+			ActorId: userID,
+			Type:    model.NOTIFY_FOLLOW,
+		})
 	}
 	return nil
 }
@@ -0,0 +1,375 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/script"
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/config/redis"
+	"local-review-go/src/httpx"
+	"local-review-go/src/model"
+	"local-review-go/src/utils/redisx"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	messageMaxRune     = 500
+	messageHistorySize = 20
+	messageSyncSize    = 50
+	messageSyncOverlap = 10 * time.Second // 晚于该时间仍未提交的消息视为不存在
+	messageSyncMaxSeen = 200
+	MessageMaxWait     = 25 * time.Second // 长轮询最长等待时间
+)
+
+// messageUnreadInitField 未读计数已从 MySQL 初始化的标记字段，全部已读后 hash 也不会消失
+const messageUnreadInitField = "0"
+
+var (
+	ErrMessageInvalid  = errors.New("私信内容无效")
+	ErrNotMutualFollow = errors.New("只能给互相关注的用户发私信")
+)
+
+// MessageLogic 互相关注的用户之间的私信
+// 客户端用 SyncMessages 增量同步：wait 为 0 时是普通轮询，大于 0 时没有新消息会挂起等待（长轮询）
+type MessageLogic interface {
+	SendMessage(ctx context.Context, fromID, toID int64, content string) (model.Message, error)
+	QueryHistory(ctx context.Context, userID, peerID int64, cursor string) (httpx.CursorResult[model.Message], error)
+	SyncMessages(ctx context.Context, userID int64, cursor string, wait time.Duration) (httpx.CursorResult[model.Message], error)
+	QueryConversations(ctx context.Context, userID int64, current int) ([]model.Conversation, error)
+	MarkConversationRead(ctx context.Context, userID, peerID int64) error
+	UnreadCount(ctx context.Context, userID int64) (int64, error)
+}
+
+type messageLogic struct{}
+
+func NewMessageLogic() MessageLogic {
+	return &messageLogic{}
+}
+
+// SendMessage 发送私信，写入历史并更新双方会话，再累加接收方未读数并唤醒其长轮询
+func (l *messageLogic) SendMessage(ctx context.Context, fromID, toID int64, content string) (model.Message, error) {
+	content = strings.TrimSpace(content)
+	if content == "" || len([]rune(content)) > messageMaxRune || toID <= 0 || toID == fromID {
+		return model.Message{}, ErrMessageInvalid
+	}
+	if err := l.checkMutualFollow(ctx, fromID, toID); err != nil {
+		return model.Message{}, err
+	}
+
+	now := time.Now()
+	var message model.Message
+	message.SetPeers(fromID, toID)
+	message.Content = content
+	message.CreateTime = now
+
+	err := mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := message.CreateMessage(tx); err != nil {
+			return fmt.Errorf("db create message from=%d to=%d: %w", fromID, toID, err)
+		}
+		for _, pair := range [][2]int64{{fromID, toID}, {toID, fromID}} {
+			conversation := model.Conversation{
+				UserId:        pair[0],
+				PeerId:        pair[1],
+				LastMessageId: message.Id,
+				LastContent:   content,
+				UpdateTime:    now,
+			}
+			if pair[0] == toID {
+				conversation.Unread = 1
+			}
+			if err := conversation.UpsertConversation(tx); err != nil {
+				return fmt.Errorf("db upsert conversation user=%d peer=%d: %w", pair[0], pair[1], err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return model.Message{}, err
+	}
+
+	client := redis.GetRedisClient()
+	pipe := client.Pipeline()
+	script.MessageUnread.Eval(ctx, pipe, []string{redisx.DM_UNREAD_KEY + strconv.FormatInt(toID, 10)}, fromID, 1)
+	// 发送方的其他设备也需要同步
+	pipe.Publish(ctx, redisx.DM_CHANNEL_KEY+strconv.FormatInt(toID, 10), message.Id)
+	pipe.Publish(ctx, redisx.DM_CHANNEL_KEY+strconv.FormatInt(fromID, 10), message.Id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logrus.Warnf("update unread and publish message %d failed: %v", message.Id, err)
+	}
+	return message, nil
+}
+
+// checkMutualFollow 通过 follow:{id} 集合判断双方是否互相关注
+func (l *messageLogic) checkMutualFollow(ctx context.Context, userID, peerID int64) error {
+	pipe := redis.GetRedisClient().Pipeline()
+	following := pipe.SIsMember(ctx, redisx.FOLLOW_USER_KEY+strconv.FormatInt(userID, 10), peerID)
+	followed := pipe.SIsMember(ctx, redisx.FOLLOW_USER_KEY+strconv.FormatInt(peerID, 10), userID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("check mutual follow user=%d peer=%d: %w", userID, peerID, err)
+	}
+	if !following.Val() || !followed.Val() {
+		return ErrNotMutualFollow
+	}
+	return nil
+}
+
+// QueryHistory 倒序分页查询会话历史，cursor 为上一页最早一条消息的 id，为空时从最新开始
+func (l *messageLogic) QueryHistory(ctx context.Context, userID, peerID int64, cursor string) (httpx.CursorResult[model.Message], error) {
+	beforeID, err := parseMessageCursor(cursor)
+	if err != nil {
+		return httpx.CursorResult[model.Message]{}, err
+	}
+
+	messages, err := new(model.Message).QueryHistory(userID, peerID, beforeID, messageHistorySize)
+	if err != nil {
+		return httpx.CursorResult[model.Message]{}, fmt.Errorf("db query history user=%d peer=%d: %w", userID, peerID, err)
+	}
+	if len(messages) == 0 {
+		return httpx.CursorResult[model.Message]{Data: []model.Message{}, Cursor: cursor}, nil
+	}
+	return httpx.CursorResult[model.Message]{
+		Data:    messages,
+		Cursor:  strconv.FormatInt(messages[len(messages)-1].Id, 10),
+		HasMore: len(messages) == messageHistorySize,
+	}, nil
+}
+
+// SyncMessages 增量同步 cursor 之后收发的消息，cursor 由上一次同步返回
+// cursor 为空时从当前最新位置开始，只返回游标；历史消息通过 QueryHistory 获取
+func (l *messageLogic) SyncMessages(ctx context.Context, userID int64, cursor string, wait time.Duration) (httpx.CursorResult[model.Message], error) {
+	if cursor == "" {
+		latest, err := new(model.Message).QueryLatestMessageIdBefore(userID, time.Now().Add(-messageSyncOverlap))
+		if err != nil {
+			return httpx.CursorResult[model.Message]{}, fmt.Errorf("db query latest message of user %d: %w", userID, err)
+		}
+		// 窗口内的消息记为已同步，只返回游标
+		result, err := l.syncAfter(userID, messageSyncCursor{settled: latest})
+		if err != nil {
+			return httpx.CursorResult[model.Message]{}, err
+		}
+		return httpx.CursorResult[model.Message]{Data: []model.Message{}, Cursor: result.Cursor}, nil
+	}
+
+	cur, err := parseMessageSyncCursor(cursor)
+	if err != nil {
+		return httpx.CursorResult[model.Message]{}, err
+	}
+	if wait > MessageMaxWait {
+		wait = MessageMaxWait
+	}
+
+	result, err := l.syncAfter(userID, cur)
+	if err != nil || len(result.Data) > 0 || wait <= 0 {
+		return result, err
+	}
+
+	// 先订阅再查询一次，避免查询与订阅之间到达的消息被错过
+	sub := redis.GetRedisClient().Subscribe(ctx, redisx.DM_CHANNEL_KEY+strconv.FormatInt(userID, 10))
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return httpx.CursorResult[model.Message]{}, fmt.Errorf("subscribe messages of user %d: %w", userID, err)
+	}
+	if result, err = l.syncAfter(userID, cur); err != nil || len(result.Data) > 0 {
+		return result, err
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-sub.Channel():
+		return l.syncAfter(userID, cur)
+	case <-timer.C:
+		return result, nil
+	case <-ctx.Done():
+		return result, nil
+	}
+}
+
+func (l *messageLogic) syncAfter(userID int64, cur messageSyncCursor) (httpx.CursorResult[model.Message], error) {
+	rows, err := new(model.Message).QueryMessagesAfter(userID, cur.settled, messageSyncSize+len(cur.seen))
+	if err != nil {
+		return httpx.CursorResult[model.Message]{}, fmt.Errorf("db query messages of user %d after %d: %w", userID, cur.settled, err)
+	}
+	messages, next := cur.next(rows, time.Now())
+	return httpx.CursorResult[model.Message]{
+		Data:    messages,
+		Cursor:  next.encode(),
+		HasMore: len(messages) == messageSyncSize,
+	}, nil
+}
+
+// messageSyncCursor 增量同步的游标。自增 id 按分配顺序而不是提交顺序可见，较小 id 的消息可能晚于较大 id 提交，
+// 因此游标不能直接跳到已返回的最大 id：settled 及之前的消息视为全部可见，
+// settled 之后已返回的消息 id 记在 seen 中，下次从 settled 之后重新查询并跳过 seen，晚提交的消息不会被越过
+type messageSyncCursor struct {
+	settled int64
+	seen    []int64
+}
+
+// next 从 settled 之后按 id 升序的 rows 中取出未返回过的消息，并推进游标：
+// 创建时间早于 overlap 窗口的已返回消息连续地并入 settled，其余记入 seen
+func (c messageSyncCursor) next(rows []model.Message, now time.Time) ([]model.Message, messageSyncCursor) {
+	seen := make(map[int64]bool, len(c.seen))
+	for _, id := range c.seen {
+		seen[id] = true
+	}
+
+	messages := []model.Message{}
+	var delivered []model.Message
+	for _, row := range rows {
+		if !seen[row.Id] {
+			if len(messages) == messageSyncSize {
+				break
+			}
+			messages = append(messages, row)
+		}
+		delivered = append(delivered, row)
+	}
+
+	next := messageSyncCursor{settled: c.settled}
+	bound := now.Add(-messageSyncOverlap)
+	i := 0
+	for ; i < len(delivered) && delivered[i].CreateTime.Before(bound); i++ {
+		next.settled = delivered[i].Id
+	}
+	// 窗口内消息过多时放弃更早的，保持游标长度有界
+	if pending := delivered[i:]; len(pending) > messageSyncMaxSeen {
+		next.settled = pending[len(pending)-messageSyncMaxSeen-1].Id
+		delivered = pending[len(pending)-messageSyncMaxSeen:]
+		i = 0
+	}
+	for _, row := range delivered[i:] {
+		next.seen = append(next.seen, row.Id)
+	}
+	return messages, next
+}
+
+// encode 编码为 "settled" 或 "settled:id,id,..."
+func (c messageSyncCursor) encode() string {
+	token := strconv.FormatInt(c.settled, 10)
+	if len(c.seen) == 0 {
+		return token
+	}
+	ids := make([]string, len(c.seen))
+	for i, id := range c.seen {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	return token + ":" + strings.Join(ids, ",")
+}
+
+func parseMessageSyncCursor(token string) (messageSyncCursor, error) {
+	settledStr, seenStr, hasSeen := strings.Cut(token, ":")
+	settled, err := parseMessageCursor(settledStr)
+	if err != nil {
+		return messageSyncCursor{}, err
+	}
+	cur := messageSyncCursor{settled: settled}
+	if !hasSeen {
+		return cur, nil
+	}
+	for _, s := range strings.Split(seenStr, ",") {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || id <= settled || len(cur.seen) >= messageSyncMaxSeen {
+			return messageSyncCursor{}, redisx.ErrInvalidCursor
+		}
+		cur.seen = append(cur.seen, id)
+	}
+	return cur, nil
+}
+
+// QueryConversations 会话列表，附带对方信息与未读数
+func (l *messageLogic) QueryConversations(ctx context.Context, userID int64, current int) ([]model.Conversation, error) {
+	conversations, err := new(model.Conversation).QueryConversations(userID, current)
+	if err != nil {
+		return nil, fmt.Errorf("db query conversations user=%d page=%d: %w", userID, current, err)
+	}
+	if len(conversations) == 0 {
+		return []model.Conversation{}, nil
+	}
+
+	peerIds := make([]int64, len(conversations))
+	for i := range conversations {
+		peerIds[i] = conversations[i].PeerId
+	}
+
+	users, err := new(model.User).GetUsersByIds(peerIds)
+	if err != nil {
+		return nil, fmt.Errorf("db get users by ids %v: %w", peerIds, err)
+	}
+	userMap := make(map[int64]model.User, len(users))
+	for _, u := range users {
+		userMap[u.Id] = u
+	}
+	for i := range conversations {
+		if u, ok := userMap[conversations[i].PeerId]; ok {
+			conversations[i].PeerName = u.NickName
+			conversations[i].PeerIcon = u.Icon
+		}
+	}
+	return conversations, nil
+}
+
+func (l *messageLogic) MarkConversationRead(ctx context.Context, userID, peerID int64) error {
+	if err := new(model.Conversation).ClearUnread(userID, peerID); err != nil {
+		return fmt.Errorf("db clear unread messages user=%d peer=%d: %w", userID, peerID, err)
+	}
+	redisKey := redisx.DM_UNREAD_KEY + strconv.FormatInt(userID, 10)
+	if err := redis.GetRedisClient().HDel(ctx, redisKey, strconv.FormatInt(peerID, 10)).Err(); err != nil {
+		return fmt.Errorf("hdel unread messages user=%d peer=%d: %w", userID, peerID, err)
+	}
+	return nil
+}
+
+// UnreadCount 所有会话的未读私信总数，Redis 中的计数不存在时从会话表重建
+func (l *messageLogic) UnreadCount(ctx context.Context, userID int64) (int64, error) {
+	client := redis.GetRedisClient()
+	redisKey := redisx.DM_UNREAD_KEY + strconv.FormatInt(userID, 10)
+	values, err := client.HGetAll(ctx, redisKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("hgetall unread messages of user %d: %w", userID, err)
+	}
+
+	if len(values) == 0 {
+		conversations, err := new(model.Conversation).QueryUnreadConversations(userID)
+		if err != nil {
+			return 0, fmt.Errorf("db query unread conversations of user %d: %w", userID, err)
+		}
+		fields := map[string]interface{}{messageUnreadInitField: 0}
+		var total int64
+		for _, c := range conversations {
+			fields[strconv.FormatInt(c.PeerId, 10)] = c.Unread
+			total += c.Unread
+		}
+		if err := client.HSet(ctx, redisKey, fields).Err(); err != nil {
+			logrus.Warnf("rebuild unread messages of user %d failed: %v", userID, err)
+		}
+		return total, nil
+	}
+
+	var total int64
+	for _, value := range values {
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		total += count
+	}
+	return total, nil
+}
+
+func parseMessageCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || id < 0 {
+		return 0, redisx.ErrInvalidCursor
+	}
+	return id, nil
+}
@@ -0,0 +1,51 @@
+package logic
+
+import (
+	"local-review-go/src/model"
+	"testing"
+	"time"
+)
+
+func TestMessageSyncCursorSkipsNothingCommittedLate(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-time.Minute)
+	recent := now.Add(-time.Second)
+	msg := func(id int64, createTime time.Time) model.Message {
+		return model.Message{Id: id, CreateTime: createTime}
+	}
+
+	// 第一次同步时 3 尚未提交，只看到 1、2、4
+	cur := messageSyncCursor{}
+	got, cur := cur.next([]model.Message{msg(1, old), msg(2, old), msg(4, recent)}, now)
+	assertMessageIds(t, got, 1, 2, 4)
+	if cur.settled != 2 || len(cur.seen) != 1 || cur.seen[0] != 4 {
+		t.Fatalf("cursor after first sync = %+v", cur)
+	}
+
+	// 3 提交后，下次同步返回 3 而不重复返回 4
+	decoded, err := parseMessageSyncCursor(cur.encode())
+	if err != nil {
+		t.Fatalf("parse cursor %q: %v", cur.encode(), err)
+	}
+	got, cur = decoded.next([]model.Message{msg(3, recent), msg(4, recent), msg(5, recent)}, now)
+	assertMessageIds(t, got, 3, 5)
+	if cur.settled != 2 || len(cur.seen) != 3 {
+		t.Fatalf("cursor after second sync = %+v", cur)
+	}
+
+	// 窗口过去后并入 settled
+	got, cur = cur.next([]model.Message{msg(3, recent), msg(4, recent), msg(5, recent)}, now.Add(time.Minute))
+	assertMessageIds(t, got)
+	if cur.settled != 5 || len(cur.seen) != 0 || cur.encode() != "5" {
+		t.Fatalf("cursor after window = %+v", cur)
+	}
+}
+
+func assertMessageIds(t *testing.T, messages []model.Message, want ...int64) {
+	t.Helper()
+	ids := make([]int64, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].Id
+	}
+	assertIds(t, ids, want)
+}
@@ -0,0 +1,322 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/script"
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/config/redis"
+	"local-review-go/src/model"
+	"local-review-go/src/utils/redisx"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	notifyWorkerCount    = 2
+	notifyEventBuffer    = 4096
+	notifyCreateRetries  = 3
+	notifyActorsTTL      = 30 * 24 * time.Hour
+	notifyUnreadTTL      = 7 * 24 * time.Hour
+	notifyContentMaxRune = 100
+)
+
+// ErrNotificationType 通知类型无效
+var ErrNotificationType = errors.New("通知类型无效")
+
+// NotifyEvent 通知事件，由点赞、评论、关注、订单等业务产生
+type NotifyEvent struct {
+	UserId   int64  // 接收者
+	ActorId  int64  // 触发者，系统通知为 0
+	Type     string // model.NOTIFY_*
+	TargetId int64
+	Content  string
+}
+
+// UnreadCount 未读数，Total 为各类型之和
+type UnreadCount struct {
+	Total  int64            `json:"total"`
+	ByType map[string]int64 `json:"byType"`
+}
+
+type NotificationLogic interface {
+	Notify(ctx context.Context, event NotifyEvent)
+	StartWorkers()
+	QueryNotifications(ctx context.Context, userID int64, typ string, current int) ([]model.Notification, int64, error)
+	UnreadCount(ctx context.Context, userID int64) (UnreadCount, error)
+	MarkRead(ctx context.Context, id, userID int64) error
+	MarkAllRead(ctx context.Context, userID int64, typ string) error
+}
+
+type notificationLogic struct {
+	events chan NotifyEvent
+}
+
+func NewNotificationLogic() NotificationLogic {
+	return &notificationLogic{events: make(chan NotifyEvent, notifyEventBuffer)}
+}
+
+// StartWorkers 启动异步写入通知的 worker
+func (l *notificationLogic) StartWorkers() {
+	for i := 0; i < notifyWorkerCount; i++ {
+		go l.runWorker()
+	}
+}
+
+func (l *notificationLogic) runWorker() {
+	for event := range l.events {
+		if err := l.notify(context.Background(), event); err != nil {
+			logrus.Warnf("notify type=%s user=%d target=%d failed: %v", event.Type, event.UserId, event.TargetId, err)
+		}
+	}
+}
+
+// Notify 投递通知事件，由 worker 异步写入，同一目标的未读通知聚合为一条（"A 等 N 人赞了你的笔记"）
+// 通知是附带功能，不在触发它的业务事务与行锁内执行，队列满时丢弃并记录日志
+func (l *notificationLogic) Notify(ctx context.Context, event NotifyEvent) {
+	if event.UserId <= 0 || event.UserId == event.ActorId {
+		return
+	}
+	select {
+	case l.events <- event:
+	default:
+		logrus.Warnf("notify queue full, dropped type=%s user=%d target=%d", event.Type, event.UserId, event.TargetId)
+	}
+}
+
+// notify 聚合到已有的未读通知或新建一条；并发的首次聚合由唯一索引裁决，落败的一方重试并入胜者
+func (l *notificationLogic) notify(ctx context.Context, event NotifyEvent) error {
+	if content := []rune(event.Content); len(content) > notifyContentMaxRune {
+		event.Content = string(content[:notifyContentMaxRune])
+	}
+	for i := 0; i < notifyCreateRetries; i++ {
+		done, err := l.tryNotify(ctx, event)
+		if err != nil || done {
+			return err
+		}
+	}
+	return fmt.Errorf("notification of target %d kept conflicting", event.TargetId)
+}
+
+func (l *notificationLogic) tryNotify(ctx context.Context, event NotifyEvent) (bool, error) {
+	now := time.Now()
+	aggregated, created, actorAdded := false, false, false
+	var notification model.Notification
+	err := mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := notification.GetUnreadForUpdate(tx, event.UserId, event.Type, event.TargetId)
+		if err == nil && event.Type != model.NOTIFY_ORDER {
+			newActor, err := l.addActor(ctx, notification.Id, event.ActorId)
+			if err != nil {
+				logrus.Warn(err.Error())
+			}
+			actorAdded = err == nil && newActor && event.ActorId > 0
+			if err := notification.Aggregate(tx, event.ActorId, newActor, event.Content, now); err != nil {
+				return fmt.Errorf("db aggregate notification %d: %w", notification.Id, err)
+			}
+			aggregated = true
+			return nil
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("db query unread notification: %w", err)
+		}
+
+		notification = model.Notification{
+			UserId:     event.UserId,
+			Type:       event.Type,
+			TargetId:   event.TargetId,
+			ActorId:    event.ActorId,
+			ActorCount: 1,
+			Content:    event.Content,
+			CreateTime: now,
+			UpdateTime: now,
+		}
+		if event.Type != model.NOTIFY_ORDER {
+			aggKey := model.NotificationAggKey(event.UserId, event.Type, event.TargetId)
+			notification.AggKey = &aggKey
+		}
+		created, err = notification.CreateNotification(tx)
+		if err != nil {
+			return fmt.Errorf("db create notification: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		// 事务回滚时撤销本次记录的触发者，否则重试时被当作已计入，actor_count 不再增加
+		if actorAdded {
+			l.removeActor(ctx, notification.Id, event.ActorId)
+		}
+		return false, err
+	}
+
+	if created {
+		if _, err := l.addActor(ctx, notification.Id, event.ActorId); err != nil {
+			logrus.Warn(err.Error())
+		}
+		l.incrUnread(ctx, event.UserId, event.Type, 1)
+	}
+	return aggregated || created, nil
+}
+
+// addActor 记录已计入聚合的触发者，返回是否为新的触发者（同一用户反复点赞不重复计数）
+// 匿名触发者不记录，总是视为新的；记录失败时也按新的触发者计数
+func (l *notificationLogic) addActor(ctx context.Context, id, actorID int64) (bool, error) {
+	if actorID <= 0 {
+		return true, nil
+	}
+	redisKey := redisx.NOTIFY_ACTORS_KEY + strconv.FormatInt(id, 10)
+	pipe := redis.GetRedisClient().TxPipeline()
+	added := pipe.SAdd(ctx, redisKey, actorID)
+	pipe.Expire(ctx, redisKey, notifyActorsTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return true, fmt.Errorf("add actor %d of notification %d: %w", actorID, id, err)
+	}
+	return added.Val() > 0, nil
+}
+
+// removeActor 撤销 addActor 的记录
+func (l *notificationLogic) removeActor(ctx context.Context, id, actorID int64) {
+	redisKey := redisx.NOTIFY_ACTORS_KEY + strconv.FormatInt(id, 10)
+	if err := redis.GetRedisClient().SRem(ctx, redisKey, actorID).Err(); err != nil {
+		logrus.Warnf("remove actor %d of notification %d failed: %v", actorID, id, err)
+	}
+}
+
+func (l *notificationLogic) incrUnread(ctx context.Context, userID int64, typ string, delta int64) {
+	redisKey := redisx.NOTIFY_UNREAD_KEY + strconv.FormatInt(userID, 10)
+	if err := script.NotifyUnread.Run(ctx, redis.GetRedisClient(), []string{redisKey}, typ, delta).Err(); err != nil {
+		logrus.Warnf("incr unread %s of user %d failed: %v", typ, userID, err)
+	}
+}
+
+// evictUnread 删除未读计数，下次读取时从数据库重建
+func (l *notificationLogic) evictUnread(ctx context.Context, userID int64) {
+	redisKey := redisx.NOTIFY_UNREAD_KEY + strconv.FormatInt(userID, 10)
+	if err := redis.GetRedisClient().Del(ctx, redisKey).Err(); err != nil {
+		logrus.Warnf("del unread count of user %d failed: %v", userID, err)
+	}
+}
+
+func (l *notificationLogic) QueryNotifications(ctx context.Context, userID int64, typ string, current int) ([]model.Notification, int64, error) {
+	if typ != "" && !isNotificationType(typ) {
+		return nil, 0, ErrNotificationType
+	}
+
+	notifications, total, err := new(model.Notification).QueryNotifications(userID, typ, current)
+	if err != nil {
+		return nil, 0, fmt.Errorf("db query notifications user=%d page=%d: %w", userID, current, err)
+	}
+	if len(notifications) == 0 {
+		return []model.Notification{}, total, nil
+	}
+
+	actorIds := make([]int64, 0, len(notifications))
+	for i := range notifications {
+		if notifications[i].ActorId > 0 {
+			actorIds = append(actorIds, notifications[i].ActorId)
+		}
+	}
+	if len(actorIds) > 0 {
+		users, err := new(model.User).GetUsersByIds(actorIds)
+		if err != nil {
+			return nil, 0, fmt.Errorf("db get users by ids %v: %w", actorIds, err)
+		}
+		userMap := make(map[int64]model.User, len(users))
+		for _, u := range users {
+			userMap[u.Id] = u
+		}
+		for i := range notifications {
+			if u, ok := userMap[notifications[i].ActorId]; ok {
+				notifications[i].ActorName = u.NickName
+				notifications[i].ActorIcon = u.Icon
+			}
+		}
+	}
+	return notifications, total, nil
+}
+
+// UnreadCount 读取未读数，Redis 中不存在时从数据库重建
+func (l *notificationLogic) UnreadCount(ctx context.Context, userID int64) (UnreadCount, error) {
+	client := redis.GetRedisClient()
+	redisKey := redisx.NOTIFY_UNREAD_KEY + strconv.FormatInt(userID, 10)
+
+	values, err := client.HGetAll(ctx, redisKey).Result()
+	if err != nil {
+		return UnreadCount{}, fmt.Errorf("hgetall unread count of user %d: %w", userID, err)
+	}
+
+	counts := make(map[string]int64, len(model.NotificationTypes))
+	if len(values) == 0 {
+		counts, err = new(model.Notification).CountUnreadByType(userID)
+		if err != nil {
+			return UnreadCount{}, fmt.Errorf("db count unread of user %d: %w", userID, err)
+		}
+		fields := make(map[string]interface{}, len(model.NotificationTypes))
+		for _, typ := range model.NotificationTypes {
+			fields[typ] = counts[typ]
+		}
+		pipe := client.TxPipeline()
+		pipe.HSet(ctx, redisKey, fields)
+		pipe.Expire(ctx, redisKey, notifyUnreadTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			logrus.Warnf("rebuild unread count of user %d failed: %v", userID, err)
+		}
+	} else {
+		for typ, value := range values {
+			count, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			counts[typ] = count
+		}
+	}
+
+	result := UnreadCount{ByType: make(map[string]int64, len(model.NotificationTypes))}
+	for _, typ := range model.NotificationTypes {
+		result.ByType[typ] = counts[typ]
+		result.Total += counts[typ]
+	}
+	return result, nil
+}
+
+func (l *notificationLogic) MarkRead(ctx context.Context, id, userID int64) error {
+	var notification model.Notification
+	if err := notification.GetNotificationById(id); err != nil {
+		return fmt.Errorf("db get notification %d: %w", id, err)
+	}
+	if notification.UserId != userID {
+		return fmt.Errorf("notification %d of another user: %w", id, gorm.ErrRecordNotFound)
+	}
+
+	changed, err := notification.MarkRead(id, userID)
+	if err != nil {
+		return fmt.Errorf("db mark notification %d read: %w", id, err)
+	}
+	if changed {
+		l.incrUnread(ctx, userID, notification.Type, -1)
+	}
+	return nil
+}
+
+func (l *notificationLogic) MarkAllRead(ctx context.Context, userID int64, typ string) error {
+	if typ != "" && !isNotificationType(typ) {
+		return ErrNotificationType
+	}
+	if err := new(model.Notification).MarkAllRead(userID, typ); err != nil {
+		return fmt.Errorf("db mark all notifications read user=%d type=%s: %w", userID, typ, err)
+	}
+	l.evictUnread(ctx, userID)
+	return nil
+}
+
+func isNotificationType(typ string) bool {
+	for _, t := range model.NotificationTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,498 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/script"
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/config/redis"
+	"local-review-go/src/model"
+	"local-review-go/src/utils"
+	"local-review-go/src/utils/redisx"
+	"strconv"
+	"time"
+
+	redisConfig "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	seckillWarmupAhead    = 10 * time.Minute // 开始前多久把库存加载到 Redis
+	seckillWarmupInterval = time.Minute
+	seckillCloseWindow    = 24 * time.Hour // 清理最近多久内结束或取消的秒杀
+	seckillPendingScan    = 10000          // 加载库存时最多检查的 pending 消息数，超过时拒绝加载
+	seckillStockLockWait  = 5 * time.Second
+)
+
+var ErrSeckillWindowInvalid = errors.New("秒杀结束时间必须晚于开始时间")
+
+// ErrSeckillOrdersPending 待落库的订单过多，暂时无法确定可加载的库存
+var ErrSeckillOrdersPending = errors.New("秒杀订单处理中，请稍后重试")
+
+// SeckillStockReport 库存一致性检查结果
+// Redis 侧的剩余库存加已售数量应等于 MySQL 侧的剩余库存加订单数，差值为尚未落库的订单
+type SeckillStockReport struct {
+	VoucherId   int64 `json:"voucherId"`
+	MysqlStock  int   `json:"mysqlStock"`
+	MysqlOrders int64 `json:"mysqlOrders"`
+	RedisStock  int64 `json:"redisStock"` // 未预热时为 -1
+	RedisSold   int64 `json:"redisSold"`
+	Pending     int64 `json:"pending"` // 已在 Redis 扣减、尚未写入 MySQL 的订单数
+	Consistent  bool  `json:"consistent"`
+}
+
+// SeckillMeta 缓存在 Redis hash 中的秒杀元数据，秒杀脚本据此判断时间、状态与购买限制，
+// 下单时不再查询 MySQL
+type SeckillMeta struct {
+	VoucherId    int64
+	ShopId       int64
+	BeginTime    time.Time
+	EndTime      time.Time
+	Status       int
+	LimitPerUser int
+	LimitPerDay  int
+	LimitPerShop int
+	MinLevel     int
+	Credits      int
+}
+
+func newSeckillMeta(voucher model.Voucher, sv model.SecKillVoucher) SeckillMeta {
+	return SeckillMeta{
+		VoucherId:    sv.VoucherId,
+		ShopId:       voucher.ShopId,
+		BeginTime:    sv.BeginTime,
+		EndTime:      sv.EndTime,
+		Status:       sv.Status,
+		LimitPerUser: voucher.PerUserLimit(),
+		LimitPerDay:  voucher.LimitPerDay,
+		LimitPerShop: voucher.LimitPerShop,
+		MinLevel:     voucher.MinLevel,
+		Credits:      voucher.Credits,
+	}
+}
+
+// fields 写入 hash 的字段，时间为毫秒时间戳
+func (m SeckillMeta) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"begin":        m.BeginTime.UnixMilli(),
+		"end":          m.EndTime.UnixMilli(),
+		"status":       m.Status,
+		"limitPerUser": m.LimitPerUser,
+		"limitPerDay":  m.LimitPerDay,
+		"limitPerShop": m.LimitPerShop,
+		"shopId":       m.ShopId,
+		"minLevel":     m.MinLevel,
+		"credits":      m.Credits,
+	}
+}
+
+// getSeckillMeta 读取缓存的秒杀元数据，未缓存时 found 为 false
+func getSeckillMeta(ctx context.Context, voucherID int64) (meta SeckillMeta, found bool, err error) {
+	values, err := redis.GetRedisClient().HGetAll(ctx, redisx.SECKILL_META_KEY+strconv.FormatInt(voucherID, 10)).Result()
+	if err != nil || len(values) == 0 {
+		return SeckillMeta{}, false, err
+	}
+	parse := func(field string) int64 {
+		value, _ := strconv.ParseInt(values[field], 10, 64)
+		return value
+	}
+	return SeckillMeta{
+		VoucherId:    voucherID,
+		ShopId:       parse("shopId"),
+		BeginTime:    time.UnixMilli(parse("begin")),
+		EndTime:      time.UnixMilli(parse("end")),
+		Status:       int(parse("status")),
+		LimitPerUser: int(parse("limitPerUser")),
+		LimitPerDay:  int(parse("limitPerDay")),
+		LimitPerShop: int(parse("limitPerShop")),
+		MinLevel:     int(parse("minLevel")),
+		Credits:      int(parse("credits")),
+	}, true, nil
+}
+
+// loadSeckill 从 MySQL 读取秒杀券并写入 Redis
+func loadSeckill(ctx context.Context, voucherID int64) (SeckillMeta, error) {
+	var sv model.SecKillVoucher
+	if err := sv.QuerySeckillVoucherById(voucherID); err != nil {
+		return SeckillMeta{}, fmt.Errorf("db query seckill voucher %d: %w", voucherID, err)
+	}
+	var voucher model.Voucher
+	if err := voucher.QueryVoucherById(voucherID); err != nil {
+		return SeckillMeta{}, fmt.Errorf("db query voucher %d: %w", voucherID, err)
+	}
+	return warmUpSeckill(ctx, voucher, sv)
+}
+
+// warmUpSeckill 写入秒杀元数据，进行中或即将开始的秒杀同时加载库存
+// 库存已加载时不覆盖，库存 key 不设过期时间，由结束后的清理删除；元数据在结束一段时间后过期
+func warmUpSeckill(ctx context.Context, voucher model.Voucher, sv model.SecKillVoucher) (SeckillMeta, error) {
+	meta := newSeckillMeta(voucher, sv)
+	metaKey := redisx.SECKILL_META_KEY + strconv.FormatInt(sv.VoucherId, 10)
+	now := time.Now()
+
+	if sv.Status == model.SECKILL_ACTIVE && sv.BeginTime.Before(now.Add(seckillWarmupAhead)) && sv.EndTime.After(now) {
+		if err := loadSeckillStock(ctx, sv.VoucherId, seckillStockToLoad); err != nil {
+			return SeckillMeta{}, err
+		}
+	}
+
+	pipe := redis.GetRedisClient().TxPipeline()
+	pipe.Del(ctx, metaKey)
+	pipe.HSet(ctx, metaKey, meta.fields())
+	pipe.Expire(ctx, metaKey, max(sv.EndTime.Sub(now), 0)+seckillCloseWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return SeckillMeta{}, fmt.Errorf("cache seckill voucher %d: %w", sv.VoucherId, err)
+	}
+	return meta, nil
+}
+
+// loadSeckillStock 库存未加载时按 stockToLoad 计算并写入 Redis
+// 与 AdjustSeckillStock 持有同一把锁：否则加载到已调整的 MySQL 库存后，调整脚本会在 Redis 上再加一次增量
+func loadSeckillStock(ctx context.Context, voucherID int64, stockToLoad func(ctx context.Context, voucherID int64) (int, error)) error {
+	client := redis.GetRedisClient()
+	stockKey := redisx.SECKILL_STOCK_KEY + strconv.FormatInt(voucherID, 10)
+	loaded := func() (bool, error) {
+		n, err := client.Exists(ctx, stockKey).Result()
+		if err != nil {
+			return false, fmt.Errorf("check stock of seckill %d: %w", voucherID, err)
+		}
+		return n > 0, nil
+	}
+
+	if ok, err := loaded(); err != nil || ok {
+		return err
+	}
+	return withSeckillStockLock(ctx, voucherID, func() error {
+		if ok, err := loaded(); err != nil || ok {
+			return err
+		}
+		stock, err := stockToLoad(ctx, voucherID)
+		if err != nil {
+			return err
+		}
+		if err := client.SetNX(ctx, stockKey, stock, 0).Err(); err != nil {
+			return fmt.Errorf("load stock of seckill %d: %w", voucherID, err)
+		}
+		return nil
+	})
+}
+
+// withSeckillStockLock 串行化同一秒杀库存的加载与调整
+func withSeckillStockLock(ctx context.Context, voucherID int64, fn func() error) error {
+	lock := utils.NewLocker().NewMutex(redisx.SECKILL_STOCK_LOCK_KEY+strconv.FormatInt(voucherID, 10), 10*time.Second)
+	lockCtx, cancel := context.WithTimeout(ctx, seckillStockLockWait)
+	defer cancel()
+	if err := lock.Lock(lockCtx); err != nil {
+		return fmt.Errorf("lock stock of seckill %d: %w", voucherID, err)
+	}
+	defer lock.Unlock(ctx)
+	return fn()
+}
+
+// seckillStockToLoad 计算加载到 Redis 的库存：MySQL 库存减去已在 Redis 扣减、尚未落库的订单
+// 先统计未落库的订单再读 MySQL 库存，两步之间落库的订单会被多扣一次，只会少卖不会超卖
+func seckillStockToLoad(ctx context.Context, voucherID int64) (int, error) {
+	pending, err := countPendingSeckillOrders(ctx, voucherID)
+	if err != nil {
+		return 0, err
+	}
+	var sv model.SecKillVoucher
+	if err := sv.QuerySeckillVoucherById(voucherID); err != nil {
+		return 0, fmt.Errorf("db query seckill voucher %d: %w", voucherID, err)
+	}
+	return max(sv.Stock-pending, 0), nil
+}
+
+// countPendingSeckillOrders 统计 stream.orders 中该秒杀尚未落库的订单：尚未投递给消费者组的消息
+// 与已投递未确认的消息。消费端拒绝的订单已归还 Redis 扣减并确认，进入死信队列的消息不计入
+func countPendingSeckillOrders(ctx context.Context, voucherID int64) (int, error) {
+	client := redis.GetRedisClient()
+	exists, err := client.Exists(ctx, "stream.orders").Result()
+	if err != nil || exists == 0 {
+		return 0, err
+	}
+	groups, err := client.XInfoGroups(ctx, "stream.orders").Result()
+	if err != nil {
+		return 0, fmt.Errorf("get consumer groups of stream.orders: %w", err)
+	}
+	lastDelivered, grouped := "0", false
+	for _, group := range groups {
+		if group.Name == "g1" {
+			lastDelivered, grouped = group.LastDeliveredID, true
+		}
+	}
+
+	undelivered, err := client.XRange(ctx, "stream.orders", lastDelivered, "+").Result()
+	if err != nil {
+		return 0, fmt.Errorf("read undelivered orders: %w", err)
+	}
+	// XRANGE 的起点包含最后投递的那条消息，它已投递，是否确认以 pending list 为准
+	if grouped && len(undelivered) > 0 && undelivered[0].ID == lastDelivered {
+		undelivered = undelivered[1:]
+	}
+	messages := undelivered
+	if grouped {
+		pending, err := client.XPendingExt(ctx, &redisConfig.XPendingExtArgs{
+			Stream: "stream.orders",
+			Group:  "g1",
+			Start:  "-",
+			End:    "+",
+			Count:  seckillPendingScan,
+		}).Result()
+		if err != nil {
+			return 0, fmt.Errorf("read pending orders: %w", err)
+		}
+		if len(pending) >= seckillPendingScan {
+			return 0, ErrSeckillOrdersPending
+		}
+		pipe := client.Pipeline()
+		cmds := make([]*redisConfig.XMessageSliceCmd, len(pending))
+		for i, entry := range pending {
+			cmds[i] = pipe.XRange(ctx, "stream.orders", entry.ID, entry.ID)
+		}
+		if len(cmds) > 0 {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return 0, fmt.Errorf("read pending orders: %w", err)
+			}
+		}
+		for _, cmd := range cmds {
+			messages = append(messages, cmd.Val()...)
+		}
+	}
+
+	id := strconv.FormatInt(voucherID, 10)
+	count := 0
+	for _, msg := range messages {
+		if value, _ := msg.Values["voucherId"].(string); value == id {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// AdjustSeckillStock 调整秒杀库存，delta 为负时减少，返回实际调整的数量
+// 与库存加载持有同一把锁，加载要么读到调整前的 MySQL 库存并由调整脚本补上增量，要么读到调整后的库存
+func (l *voucherLogic) AdjustSeckillStock(ctx context.Context, voucherID int64, delta int) (int, error) {
+	if delta == 0 {
+		return 0, nil
+	}
+	db := mysql.GetMysqlDB().WithContext(ctx)
+	var sv model.SecKillVoucher
+	return adjustSeckillStock(ctx, voucherID, delta, func(delta int) error {
+		return sv.AdjustStock(db, voucherID, delta)
+	})
+}
+
+// adjustSeckillStock 持锁后先由 adjustDB 调整 MySQL 再调整已预热的 Redis 库存：Redis 调整失败时回滚 MySQL 并返回错误；
+// Redis 剩余库存不足以扣减时只扣到 0，MySQL 按实际扣减量补回差额，两侧调整量一致
+func adjustSeckillStock(ctx context.Context, voucherID int64, delta int, adjustDB func(delta int) error) (applied int, err error) {
+	err = withSeckillStockLock(ctx, voucherID, func() error {
+		applied, err = applySeckillAdjust(ctx, voucherID, delta, adjustDB)
+		return err
+	})
+	return applied, err
+}
+
+func applySeckillAdjust(ctx context.Context, voucherID int64, delta int, adjustDB func(delta int) error) (int, error) {
+	if err := adjustDB(delta); err != nil {
+		return 0, fmt.Errorf("db adjust stock of seckill %d by %d: %w", voucherID, delta, err)
+	}
+
+	redisKey := redisx.SECKILL_STOCK_KEY + strconv.FormatInt(voucherID, 10)
+	applied, err := script.SeckillAdjust.Run(ctx, redis.GetRedisClient(), []string{redisKey}, delta).Int()
+	if errors.Is(err, redisConfig.Nil) {
+		// 未预热，加载时以 MySQL 库存为准
+		return delta, nil
+	}
+	if err != nil {
+		if rollbackErr := adjustDB(-delta); rollbackErr != nil {
+			return 0, fmt.Errorf("adjust redis stock of seckill %d by %d: %w (rollback mysql stock failed: %v)",
+				voucherID, delta, err, rollbackErr)
+		}
+		return 0, fmt.Errorf("adjust redis stock of seckill %d by %d: %w", voucherID, delta, err)
+	}
+	if applied != delta {
+		if err := adjustDB(applied - delta); err != nil {
+			return applied, fmt.Errorf("db restore stock of seckill %d by %d: %w", voucherID, applied-delta, err)
+		}
+	}
+	return applied, nil
+}
+
+// UpdateSeckillWindow 修改秒杀时间并刷新缓存的元数据，已结束的秒杀延长后重新加载库存
+func (l *voucherLogic) UpdateSeckillWindow(ctx context.Context, voucherID int64, beginTime, endTime time.Time) error {
+	if !endTime.After(beginTime) {
+		return ErrSeckillWindowInvalid
+	}
+	var sv model.SecKillVoucher
+	if err := sv.QuerySeckillVoucherById(voucherID); err != nil {
+		return fmt.Errorf("db query seckill voucher %d: %w", voucherID, err)
+	}
+	if sv.Status == model.SECKILL_CANCELED {
+		return model.ErrSeckillStatus
+	}
+	if err := sv.UpdateWindow(mysql.GetMysqlDB().WithContext(ctx), voucherID, beginTime, endTime); err != nil {
+		return fmt.Errorf("db update window of seckill %d: %w", voucherID, err)
+	}
+
+	if _, err := loadSeckill(ctx, voucherID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// PauseSeckill 暂停秒杀，库存保留，恢复后继续
+func (l *voucherLogic) PauseSeckill(ctx context.Context, voucherID int64) error {
+	return l.updateSeckillStatus(ctx, voucherID, []int{model.SECKILL_ACTIVE}, model.SECKILL_PAUSED)
+}
+
+func (l *voucherLogic) ResumeSeckill(ctx context.Context, voucherID int64) error {
+	return l.updateSeckillStatus(ctx, voucherID, []int{model.SECKILL_PAUSED}, model.SECKILL_ACTIVE)
+}
+
+// CancelSeckill 取消秒杀并清除 Redis 库存，取消后不可恢复
+func (l *voucherLogic) CancelSeckill(ctx context.Context, voucherID int64) error {
+	err := l.updateSeckillStatus(ctx, voucherID, []int{model.SECKILL_ACTIVE, model.SECKILL_PAUSED}, model.SECKILL_CANCELED)
+	if err != nil {
+		return err
+	}
+	redisKey := redisx.SECKILL_STOCK_KEY + strconv.FormatInt(voucherID, 10)
+	if err := redis.GetRedisClient().Del(ctx, redisKey).Err(); err != nil {
+		logrus.Warnf("delete stock of canceled seckill %d failed, will retry in warm-up job: %v", voucherID, err)
+	}
+	return nil
+}
+
+// updateSeckillStatus 更新状态并刷新缓存的元数据，秒杀脚本随即按新状态拦截
+func (l *voucherLogic) updateSeckillStatus(ctx context.Context, voucherID int64, from []int, to int) error {
+	var sv model.SecKillVoucher
+	if err := sv.UpdateStatus(mysql.GetMysqlDB().WithContext(ctx), voucherID, from, to); err != nil {
+		return fmt.Errorf("db update status of seckill %d to %d: %w", voucherID, to, err)
+	}
+	if _, err := loadSeckill(ctx, voucherID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckSeckillStock 比较 Redis 与 MySQL 两侧的库存与订单
+func (l *voucherLogic) CheckSeckillStock(ctx context.Context, voucherID int64) (SeckillStockReport, error) {
+	var sv model.SecKillVoucher
+	if err := sv.QuerySeckillVoucherById(voucherID); err != nil {
+		return SeckillStockReport{}, fmt.Errorf("db query seckill voucher %d: %w", voucherID, err)
+	}
+	orders, err := new(model.VoucherOrder).CountByVoucher(voucherID)
+	if err != nil {
+		return SeckillStockReport{}, fmt.Errorf("db count orders of voucher %d: %w", voucherID, err)
+	}
+
+	id := strconv.FormatInt(voucherID, 10)
+	pipe := redis.GetRedisClient().Pipeline()
+	stockCmd := pipe.Get(ctx, redisx.SECKILL_STOCK_KEY+id)
+	soldCmd := pipe.HVals(ctx, redisx.SECKILL_COUNT_KEY+id)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redisConfig.Nil) {
+		return SeckillStockReport{}, fmt.Errorf("get redis stock of seckill %d: %w", voucherID, err)
+	}
+
+	report := SeckillStockReport{
+		VoucherId:   voucherID,
+		MysqlStock:  sv.Stock,
+		MysqlOrders: orders,
+		RedisStock:  -1,
+	}
+	if stock, err := stockCmd.Int64(); err == nil {
+		report.RedisStock = stock
+	}
+	for _, value := range soldCmd.Val() {
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		report.RedisSold += count
+	}
+	report.Pending = report.RedisSold - report.MysqlOrders
+	if report.RedisStock >= 0 {
+		report.Consistent = report.Pending >= 0 &&
+			report.RedisStock+report.RedisSold == int64(report.MysqlStock)+report.MysqlOrders
+	} else {
+		// 未预热时只要求 MySQL 侧没有多出 Redis 不知道的订单
+		report.Consistent = report.Pending >= 0
+	}
+	return report, nil
+}
+
+// StartWorkers 启动秒杀库存的预热与清理任务
+func (l *voucherLogic) StartWorkers() {
+	go l.warmUpSeckills()
+}
+
+func (l *voucherLogic) warmUpSeckills() {
+	l.warmUpSeckillsWithLock()
+
+	ticker := time.NewTicker(seckillWarmupInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.warmUpSeckillsWithLock()
+	}
+}
+
+func (l *voucherLogic) warmUpSeckillsWithLock() {
+	ctx := context.Background()
+	lock, acquired, err := utils.NewLocker().
+		LockWithWatchDog(ctx, redisx.SECKILL_WARMUP_LOCK_KEY, 30*time.Second)
+	if err != nil || !acquired {
+		return
+	}
+	defer lock.Unlock(ctx)
+
+	lockCtx, cancel := lock.Context(ctx)
+	defer cancel()
+	if err := warmUpSeckills(lockCtx); err != nil {
+		logrus.Errorf("warm up seckill vouchers failed: %v", err)
+	}
+}
+
+// warmUpSeckills 加载即将开始的秒杀库存，删除已结束或已取消的秒杀库存
+func warmUpSeckills(ctx context.Context) error {
+	var svUtils model.SecKillVoucher
+	now := time.Now()
+
+	opening, err := svUtils.QueryOpeningSeckills(now.Add(seckillWarmupAhead), now)
+	if err != nil {
+		return fmt.Errorf("db query opening seckills: %w", err)
+	}
+	for _, sv := range opening {
+		var voucher model.Voucher
+		if err := voucher.QueryVoucherById(sv.VoucherId); err != nil {
+			logrus.Warnf("query voucher %d for warm-up failed: %v", sv.VoucherId, err)
+			continue
+		}
+		if _, err := warmUpSeckill(ctx, voucher, sv); err != nil {
+			logrus.Warnf("warm up seckill voucher %d failed: %v", sv.VoucherId, err)
+		}
+	}
+
+	closed, err := svUtils.QueryClosedSeckills(now.Add(-seckillCloseWindow), now)
+	if err != nil {
+		return fmt.Errorf("db query closed seckills: %w", err)
+	}
+	if len(closed) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(closed))
+	for _, sv := range closed {
+		// 结束后又被延长的秒杀仍在进行中
+		if sv.Status != model.SECKILL_CANCELED && sv.EndTime.After(now) {
+			continue
+		}
+		keys = append(keys, redisx.SECKILL_STOCK_KEY+strconv.FormatInt(sv.VoucherId, 10))
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := redis.GetRedisClient().Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("delete stock of closed seckills: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package logic
+
+import (
+	"context"
+	"local-review-go/src/utils/redisx"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	redisConfig "github.com/redis/go-redis/v9"
+)
+
+func TestCountPendingSeckillOrders(t *testing.T) {
+	client := setupFeedRedis(t)
+	ctx := context.Background()
+
+	for _, voucherID := range []string{"1", "1", "2", "1"} {
+		client.XAdd(ctx, &redisConfig.XAddArgs{Stream: "stream.orders", Values: []interface{}{"voucherId", voucherID}})
+	}
+	if n, err := countPendingSeckillOrders(ctx, 1); err != nil || n != 3 {
+		t.Fatalf("pending before consumer group = %d, %v, want 3", n, err)
+	}
+
+	// 投递前两条，确认第一条：第二条在 pending list，后两条尚未投递
+	client.XGroupCreate(ctx, "stream.orders", "g1", "0")
+	msgs, err := client.XReadGroup(ctx, &redisConfig.XReadGroupArgs{
+		Group: "g1", Consumer: "c1", Streams: []string{"stream.orders", ">"}, Count: 2,
+	}).Result()
+	if err != nil || len(msgs[0].Messages) != 2 {
+		t.Fatalf("read group: %v", err)
+	}
+	client.XAck(ctx, "stream.orders", "g1", msgs[0].Messages[0].ID)
+
+	if n, err := countPendingSeckillOrders(ctx, 1); err != nil || n != 2 {
+		t.Fatalf("pending of voucher 1 = %d, %v, want 2", n, err)
+	}
+	if n, err := countPendingSeckillOrders(ctx, 2); err != nil || n != 1 {
+		t.Fatalf("pending of voucher 2 = %d, %v, want 1", n, err)
+	}
+}
+
+func TestAdjustSeckillStockSerializedWithLoad(t *testing.T) {
+	client := setupFeedRedis(t)
+	ctx := context.Background()
+	var mysqlStock atomic.Int64
+	mysqlStock.Store(10)
+	stockToLoad := func(context.Context, int64) (int, error) {
+		return int(mysqlStock.Load()), nil
+	}
+
+	// 未预热时调整 MySQL 后、调整 Redis 前，库存加载插进来：加载必须等调整完成，
+	// 否则加载到调整后的 MySQL 库存，调整脚本又在 Redis 上再加一次
+	loaded := make(chan error, 1)
+	applied, err := adjustSeckillStock(ctx, 1, 5, func(delta int) error {
+		mysqlStock.Add(int64(delta))
+		go func() { loaded <- loadSeckillStock(ctx, 1, stockToLoad) }()
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+	if err != nil || applied != 5 {
+		t.Fatalf("adjust = %d, %v", applied, err)
+	}
+	if err := <-loaded; err != nil {
+		t.Fatalf("load stock: %v", err)
+	}
+	if stock, _ := client.Get(ctx, redisx.SECKILL_STOCK_KEY+"1").Int(); stock != 15 {
+		t.Fatalf("redis stock = %d, want 15", stock)
+	}
+
+	// 已预热时调整同时作用于两侧
+	if applied, err = adjustSeckillStock(ctx, 1, -3, func(delta int) error {
+		mysqlStock.Add(int64(delta))
+		return nil
+	}); err != nil || applied != -3 {
+		t.Fatalf("adjust = %d, %v", applied, err)
+	}
+	if stock, _ := client.Get(ctx, redisx.SECKILL_STOCK_KEY+"1").Int(); stock != 12 || mysqlStock.Load() != 12 {
+		t.Fatalf("redis stock = %d, mysql stock = %d, want 12", stock, mysqlStock.Load())
+	}
+}
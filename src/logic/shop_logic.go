@@ -20,8 +20,12 @@ import (
 
 const (
 	maxRedisDataQueue = 10
+	shopRebuildWait   = 3 * time.Second // 等待其他请求重建缓存的最长时间
 )
 
+// ErrShopBlocked 布隆过滤器判定店铺不存在
+var ErrShopBlocked = errors.New("shop not found (blocked by Bloom Filter)")
+
 // ShopLogic 封装店铺领域的业务流程。
 type ShopLogic interface {
 	QueryShopById(ctx context.Context, id int64) (model.Shop, error)
@@ -36,22 +40,24 @@ type ShopLogic interface {
 	QueryShopByIdPassThrough(ctx context.Context, id int64) (model.Shop, error)
 	QueryShopByIdWithLogicExpire(ctx context.Context, id int64) (model.Shop, error)
 	QueryShopByType(ctx context.Context, typeID, current int, x, y float64) ([]model.Shop, error)
+	QueryShopsByIds(ctx context.Context, ids []int64) ([]model.Shop, error)
 
-	SetBloomFilter(filter *utils.BloomFilter)
+	SetBloomFilter(filter utils.BloomFilter)
 }
 
 // ShopLogicDeps 用于实例化 shopLogic 的依赖。
 type ShopLogicDeps struct {
 	Redis       *redisv9.Client
 	DB          *gorm.DB
-	BloomFilter *utils.BloomFilter
+	BloomFilter utils.BloomFilter
+	Locker      utils.Locker
 }
 
 type shopLogic struct {
 	redis          *redisv9.Client
 	db             *gorm.DB
-	distLock       *utils.DistributedLock
-	bloomFilter    *utils.BloomFilter
+	distLock       utils.Locker
+	bloomFilter    utils.BloomFilter
 	redisDataQueue chan int64
 }
 
@@ -62,6 +68,15 @@ func NewShopLogic(deps ShopLogicDeps) ShopLogic {
 		redisCli = redisClient.GetRedisClient()
 	}
 
+	// 注入了 Redis 时锁也使用该 Redis，否则按配置创建
+	locker := deps.Locker
+	if locker == nil && deps.Redis != nil {
+		locker = utils.NewDistributedLock(redisCli)
+	}
+	if locker == nil {
+		locker = utils.NewLocker()
+	}
+
 	db := deps.DB
 	if db == nil {
 		db = mysql.GetMysqlDB()
@@ -70,7 +85,7 @@ func NewShopLogic(deps ShopLogicDeps) ShopLogic {
 	l := &shopLogic{
 		redis:          redisCli,
 		db:             db,
-		distLock:       utils.NewDistributedLock(redisCli),
+		distLock:       locker,
 		bloomFilter:    deps.BloomFilter,
 		redisDataQueue: make(chan int64, maxRedisDataQueue),
 	}
@@ -81,7 +96,7 @@ func NewShopLogic(deps ShopLogicDeps) ShopLogic {
 	return l
 }
 
-func (s *shopLogic) SetBloomFilter(filter *utils.BloomFilter) {
+func (s *shopLogic) SetBloomFilter(filter utils.BloomFilter) {
 	s.bloomFilter = filter
 }
 
@@ -146,7 +161,7 @@ func (s *shopLogic) QueryShopByIdWithCache(ctx context.Context, id int64) (model
 		if err != nil {
 			logrus.Warnf("BloomFilter check failed for shop %d: %v, proceeding to cache/DB", id, err)
 		} else if !exists {
-			return model.Shop{}, errors.New("shop not found (blocked by Bloom Filter)")
+			return model.Shop{}, ErrShopBlocked
 		}
 	}
 
@@ -238,7 +253,7 @@ func (s *shopLogic) QueryShopByIdWithCacheNull(ctx context.Context, id int64) (m
 			logrus.Warnf("BloomFilter check failed for shop %d: %v, proceeding to cache/DB", id, err)
 		} else if !exists {
 			logrus.Infof("Bloom Filter blocked shop %d (not exists)", id)
-			return model.Shop{}, errors.New("shop not found (blocked by Bloom Filter)")
+			return model.Shop{}, ErrShopBlocked
 		} else {
 			logrus.Debugf("Bloom Filter passed for shop %d (exists)", id)
 		}
@@ -306,74 +321,82 @@ func (s *shopLogic) QueryShopByIdWithCacheNull(ctx context.Context, id int64) (m
 func (s *shopLogic) QueryShopByIdPassThrough(ctx context.Context, id int64) (model.Shop, error) {
 	redisKey := redisx.CACHE_SHOP_KEY + strconv.FormatInt(id, 10)
 
-	for {
-		shopInfoStr, err := s.redis.Get(ctx, redisKey).Result()
-		if err == nil {
-			if shopInfoStr == "" {
-				return model.Shop{}, nil
-			}
+	shopInfo, hit, err := s.getShopCache(ctx, id, redisKey)
+	if err != nil || hit {
+		return shopInfo, err
+	}
 
-			var shopInfo model.Shop
-			if err = json.Unmarshal([]byte(shopInfoStr), &shopInfo); err != nil {
-				return model.Shop{}, fmt.Errorf("unmarshal shop cache %d: %w", id, err)
-			}
-			return shopInfo, nil
-		}
+	// 缓存未命中时只让一个请求重建，其余请求阻塞到锁释放后直接读缓存
+	lockKey := redisx.CACHE_LOCK_KEY + strconv.FormatInt(id, 10)
+	lock := s.distLock.NewMutex(lockKey, 10*time.Second)
+	lockCtx, cancel := context.WithTimeout(ctx, shopRebuildWait)
+	defer cancel()
+	if err := lock.Lock(lockCtx); err != nil {
+		return model.Shop{}, fmt.Errorf("lock hot shop %d: %w", id, err)
+	}
+	defer lock.Unlock(context.Background())
 
-		if !errors.Is(err, redisv9.Nil) {
-			return model.Shop{}, fmt.Errorf("get shop cache %d: %w", id, err)
-		}
+	// 等锁期间缓存可能已被其他请求重建
+	shopInfo, hit, err = s.getShopCache(ctx, id, redisKey)
+	if err != nil || hit {
+		return shopInfo, err
+	}
 
-		lockKey := redisx.CACHE_LOCK_KEY + strconv.FormatInt(id, 10)
-		flag, token, lockErr := s.distLock.LockWithWatchDog(ctx, lockKey, 10*time.Second)
-		if lockErr != nil {
-			return model.Shop{}, fmt.Errorf("lock hot shop %d: %w", id, lockErr)
-		}
+	// 重新建立缓存
+	err = shopInfo.QueryShopById(id)
 
-		// 没有获取到锁，稍后重试
-		if !flag {
-			time.Sleep(time.Millisecond * 50)
-			continue
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if setErr := s.redis.Set(ctx, redisKey, "", time.Minute).Err(); setErr != nil {
+			return model.Shop{}, fmt.Errorf("set empty shop cache %d: %w", id, setErr)
 		}
+		return model.Shop{}, nil
+	}
 
-		// 重新建立缓存
-		defer s.distLock.UnlockWithWatchDog(ctx, lockKey, token)
-		var shopInfo model.Shop
-		err = shopInfo.QueryShopById(id)
+	if err != nil {
+		return model.Shop{}, fmt.Errorf("db query shop %d: %w", id, err)
+	}
 
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			if setErr := s.redis.Set(ctx, redisKey, "", time.Minute).Err(); setErr != nil {
-				return model.Shop{}, fmt.Errorf("set empty shop cache %d: %w", id, setErr)
+	// 防御性编程：如果数据库查询成功，确保布隆过滤器中也存在
+	if s.bloomFilter != nil && shopInfo.Id > 0 {
+		exists, bfErr := s.bloomFilter.Contains(shopInfo.Id)
+		if bfErr == nil && !exists {
+			if addErr := s.bloomFilter.Add(shopInfo.Id); addErr != nil {
+				logrus.Warnf("Failed to add shop %d to Bloom Filter after DB query: %v", shopInfo.Id, addErr)
+			} else {
+				logrus.Debugf("Defensively added shop %d to Bloom Filter after DB query", shopInfo.Id)
 			}
-			return model.Shop{}, nil
 		}
+	}
 
-		if err != nil {
-			return model.Shop{}, fmt.Errorf("db query shop %d: %w", id, err)
-		}
+	redisValue, err := json.Marshal(shopInfo)
+	if err != nil {
+		return model.Shop{}, fmt.Errorf("marshal shop %d: %w", id, err)
+	}
 
-		// 防御性编程：如果数据库查询成功，确保布隆过滤器中也存在
-		if s.bloomFilter != nil && shopInfo.Id > 0 {
-			exists, bfErr := s.bloomFilter.Contains(shopInfo.Id)
-			if bfErr == nil && !exists {
-				if addErr := s.bloomFilter.Add(shopInfo.Id); addErr != nil {
-					logrus.Warnf("Failed to add shop %d to Bloom Filter after DB query: %v", shopInfo.Id, addErr)
-				} else {
-					logrus.Debugf("Defensively added shop %d to Bloom Filter after DB query", shopInfo.Id)
-				}
-			}
-		}
+	if err = s.redis.Set(ctx, redisKey, string(redisValue), time.Minute).Err(); err != nil {
+		return model.Shop{}, fmt.Errorf("set shop cache %d: %w", id, err)
+	}
+	return shopInfo, nil
+}
 
-		redisValue, err := json.Marshal(shopInfo)
-		if err != nil {
-			return model.Shop{}, fmt.Errorf("marshal shop %d: %w", id, err)
-		}
+// getShopCache 读取店铺缓存，空字符串为缓存的空值
+func (s *shopLogic) getShopCache(ctx context.Context, id int64, redisKey string) (model.Shop, bool, error) {
+	shopInfoStr, err := s.redis.Get(ctx, redisKey).Result()
+	if errors.Is(err, redisv9.Nil) {
+		return model.Shop{}, false, nil
+	}
+	if err != nil {
+		return model.Shop{}, false, fmt.Errorf("get shop cache %d: %w", id, err)
+	}
+	if shopInfoStr == "" {
+		return model.Shop{}, true, nil
+	}
 
-		if err = s.redis.Set(ctx, redisKey, string(redisValue), time.Minute).Err(); err != nil {
-			return model.Shop{}, fmt.Errorf("set shop cache %d: %w", id, err)
-		}
-		return shopInfo, nil
+	var shopInfo model.Shop
+	if err = json.Unmarshal([]byte(shopInfoStr), &shopInfo); err != nil {
+		return model.Shop{}, false, fmt.Errorf("unmarshal shop cache %d: %w", id, err)
 	}
+	return shopInfo, true, nil
 }
 
 // QueryShopByIdWithLogicExpire 逻辑过期方案
@@ -405,7 +428,7 @@ func (s *shopLogic) QueryShopByIdWithLogicExpire(ctx context.Context, id int64)
 
 		lockKey := redisx.CACHE_LOCK_KEY + strconv.FormatInt(id, 10)
 		baseCtx := context.Background()
-		flag, token, lockErr := s.distLock.LockWithWatchDog(baseCtx, lockKey, 10*time.Second)
+		lock, flag, lockErr := s.distLock.LockWithWatchDog(baseCtx, lockKey, 10*time.Second)
 		if lockErr != nil {
 			return model.Shop{}, fmt.Errorf("lock logic-expire shop %d: %w", id, lockErr)
 		}
@@ -416,7 +439,7 @@ func (s *shopLogic) QueryShopByIdWithLogicExpire(ctx context.Context, id int64)
 		}
 
 		// if get the lock
-		defer s.distLock.UnlockWithWatchDog(baseCtx, lockKey, token)
+		defer lock.Unlock(baseCtx)
 		s.redisDataQueue <- id
 		return redisData.Data, nil
 	}
@@ -511,12 +534,37 @@ func (s *shopLogic) QueryShopByType(ctx context.Context, typeID, current int, x,
 	}
 
 	// 4. 数据库一次性查询
-	shops, err := new(model.Shop).QueryShopByIds(ids)
+	shops, err := s.QueryShopsByIds(ctx, ids)
 	if err != nil {
-		return nil, fmt.Errorf("db query shops by ids %v: %w", ids, err)
+		return nil, err
 	}
 	for i := range shops {
 		shops[i].Distance = dist[shops[i].Id] // ⚠️ 字段是 Id
 	}
 	return shops, nil
 }
+
+// QueryShopsByIds 批量查询店铺，先用布隆过滤器一次性剔除肯定不存在的 id，结果保持 ids 的顺序
+func (s *shopLogic) QueryShopsByIds(_ context.Context, ids []int64) ([]model.Shop, error) {
+	if s.bloomFilter != nil && len(ids) > 0 {
+		present, err := s.bloomFilter.ContainsBatch(ids)
+		if err != nil {
+			// 布隆过滤器不可用时降级为直接查库
+			logrus.Warnf("Bloom Filter check failed for shops %v: %v", ids, err)
+		} else {
+			kept := ids[:0:0]
+			for i, id := range ids {
+				if present[i] {
+					kept = append(kept, id)
+				}
+			}
+			ids = kept
+		}
+	}
+
+	shops, err := new(model.Shop).QueryShopByIds(ids)
+	if err != nil {
+		return nil, fmt.Errorf("db query shops by ids %v: %w", ids, err)
+	}
+	return shops, nil
+}
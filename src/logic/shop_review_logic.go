@@ -0,0 +1,298 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/script"
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/config/redis"
+	"local-review-go/src/model"
+	"local-review-go/src/utils/redisx"
+	"strconv"
+	"strings"
+	"time"
+
+	redisConfig "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const maxReviewImages = 9
+
+var (
+	ErrReviewOrderInvalid = errors.New("关联订单无效或未核销")
+	ErrReviewImageInvalid = errors.New("评价图片无效")
+	ErrReviewShopInvalid  = errors.New("店铺id无效")
+	ErrReviewSelfHelpful  = errors.New("不能给自己的评价点有用")
+)
+
+// ShopReviewLogic 店铺评价：星级、文字、图片，驱动店铺评分与评价数
+type ShopReviewLogic interface {
+	SaveReview(ctx context.Context, userID int64, review *model.ShopReview) (int64, error)
+	UpdateReview(ctx context.Context, userID int64, review *model.ShopReview) error
+	QueryReviewsOfShop(ctx context.Context, shopID int64, sortBy string, current int, userID int64) ([]model.ShopReview, int64, error)
+	HelpfulReview(ctx context.Context, id, userID int64) error
+}
+
+type shopReviewLogic struct {
+	upload UploadLogic
+}
+
+func NewShopReviewLogic(uploadLogic UploadLogic) ShopReviewLogic {
+	return &shopReviewLogic{upload: uploadLogic}
+}
+
+// SaveReview 发表评价，每个用户对每个店铺只能评价一次
+func (l *shopReviewLogic) SaveReview(ctx context.Context, userID int64, review *model.ShopReview) (int64, error) {
+	if err := l.checkReview(userID, review); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	review.Id = 0
+	review.UserId = userID
+	review.Helpful = 0
+	review.CreateTime = now
+	review.UpdateTime = now
+
+	err := mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing model.ShopReview
+		err := existing.GetUserReviewOfShop(tx, review.ShopId, userID)
+		if err == nil {
+			return model.ErrDuplicateReview
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("db query review shop=%d user=%d: %w", review.ShopId, userID, err)
+		}
+
+		// 并发发表时由唯一索引兜底，冲突返回 ErrDuplicateReview
+		if err := review.CreateShopReview(tx); err != nil {
+			return fmt.Errorf("db create review shop=%d user=%d: %w", review.ShopId, userID, err)
+		}
+		if err := new(model.Shop).ApplyReviewDelta(tx, review.ShopId, 1, review.Score, 1); err != nil {
+			return fmt.Errorf("db update shop %d score: %w", review.ShopId, err)
+		}
+		_, _, err = postCredits(tx, CreditPosting{
+			UserId:  userID,
+			BizType: model.CREDIT_BIZ_REVIEW,
+			BizKey:  fmt.Sprintf("%s:%d", model.CREDIT_BIZ_REVIEW, review.Id),
+			Amount:  reviewCredits,
+		})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	evictShopCache(ctx, review.ShopId)
+	return review.Id, nil
+}
+
+// UpdateReview 编辑自己对店铺的评价，评分变化以差值方式计入店铺总分
+func (l *shopReviewLogic) UpdateReview(ctx context.Context, userID int64, review *model.ShopReview) error {
+	if err := l.checkReview(userID, review); err != nil {
+		return err
+	}
+
+	var removedImages []string
+	err := mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing model.ShopReview
+		if err := existing.GetUserReviewOfShop(tx, review.ShopId, userID); err != nil {
+			return fmt.Errorf("db query review shop=%d user=%d: %w", review.ShopId, userID, err)
+		}
+
+		review.Id = existing.Id
+		review.UserId = userID
+		review.UpdateTime = time.Now()
+		if err := review.UpdateShopReview(tx); err != nil {
+			return fmt.Errorf("db update review %d: %w", review.Id, err)
+		}
+
+		if delta := review.Score - existing.Score; delta != 0 {
+			if err := new(model.Shop).ApplyReviewDelta(tx, review.ShopId, 0, delta, 0); err != nil {
+				return fmt.Errorf("db update shop %d score: %w", review.ShopId, err)
+			}
+		}
+
+		removedImages = diffImages(existing.Images, review.Images)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 事务提交后再清理被移除的图片，避免回滚后图片丢失
+	for _, name := range removedImages {
+		if err := l.upload.DeleteBlogImage(name); err != nil {
+			logrus.Warnf("delete review image %s failed: %v", name, err)
+		}
+	}
+
+	evictShopCache(ctx, review.ShopId)
+	return nil
+}
+
+// QueryReviewsOfShop 分页查询店铺评价，支持按最新/最有用排序
+func (l *shopReviewLogic) QueryReviewsOfShop(ctx context.Context, shopID int64, sortBy string, current int, userID int64) ([]model.ShopReview, int64, error) {
+	var reviewUtils model.ShopReview
+	reviews, err := reviewUtils.QueryReviewsOfShop(shopID, sortBy, current)
+	if err != nil {
+		return nil, 0, fmt.Errorf("db query reviews shop=%d page=%d: %w", shopID, current, err)
+	}
+	total, err := reviewUtils.CountReviewsOfShop(shopID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("db count reviews shop=%d: %w", shopID, err)
+	}
+	if len(reviews) == 0 {
+		return []model.ShopReview{}, total, nil
+	}
+
+	userIds := make([]int64, 0, len(reviews))
+	for i := range reviews {
+		userIds = append(userIds, reviews[i].UserId)
+	}
+	users, err := new(model.User).GetUsersByIds(userIds)
+	if err != nil {
+		return nil, 0, fmt.Errorf("db get users by ids %v: %w", userIds, err)
+	}
+	userMap := make(map[int64]model.User, len(users))
+	for _, u := range users {
+		userMap[u.Id] = u
+	}
+
+	pipe := redis.GetRedisClient().Pipeline()
+	cmds := make([]*redisConfig.BoolCmd, len(reviews))
+	for i := range reviews {
+		if u, ok := userMap[reviews[i].UserId]; ok {
+			reviews[i].Name = u.NickName
+			reviews[i].Icon = u.Icon
+		}
+		if userID > 0 {
+			key := redisx.REVIEW_HELPFUL_KEY + strconv.FormatInt(reviews[i].Id, 10)
+			cmds[i] = pipe.SIsMember(ctx, key, userID)
+		}
+	}
+	if userID > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			logrus.Warnf("query review helpful state for user %d failed: %v", userID, err)
+		} else {
+			for i := range reviews {
+				reviews[i].IsHelpful = cmds[i].Val()
+			}
+		}
+	}
+
+	return reviews, total, nil
+}
+
+// HelpfulReview 标记/取消评价"有用"，Redis 集合的切换由脚本原子完成，并发点击不会重复计数
+func (l *shopReviewLogic) HelpfulReview(ctx context.Context, id, userID int64) error {
+	var review model.ShopReview
+	if err := review.GetShopReviewById(id); err != nil {
+		return fmt.Errorf("db get review %d: %w", id, err)
+	}
+	if review.UserId == userID {
+		return ErrReviewSelfHelpful
+	}
+
+	client := redis.GetRedisClient()
+	redisKey := redisx.REVIEW_HELPFUL_KEY + strconv.FormatInt(id, 10)
+	delta, err := script.ReviewHelpful.Run(ctx, client, []string{redisKey}, userID).Int()
+	if err != nil {
+		return fmt.Errorf("toggle review helpful review=%d user=%d: %w", id, userID, err)
+	}
+
+	if err := review.IncrHelpful(delta); err != nil {
+		// 再切换一次撤销 Redis 中的标记，保持与数据库计数一致
+		if rbErr := script.ReviewHelpful.Run(ctx, client, []string{redisKey}, userID).Err(); rbErr != nil {
+			logrus.Warnf("revert review helpful review=%d user=%d failed: %v", id, userID, rbErr)
+		}
+		return fmt.Errorf("db update review %d helpful: %w", id, err)
+	}
+	return nil
+}
+
+// checkReview 校验评分、图片，以及关联订单是否为本人在该店铺已核销的订单
+func (l *shopReviewLogic) checkReview(userID int64, review *model.ShopReview) error {
+	if review.ShopId <= 0 {
+		return ErrReviewShopInvalid
+	}
+	if review.Score < 1 || review.Score > 5 {
+		return model.ErrInvalidScore
+	}
+
+	images := splitImages(review.Images)
+	if len(images) > maxReviewImages {
+		return ErrReviewImageInvalid
+	}
+	for _, name := range images {
+		// 图片必须来自 UploadLogic.SaveBlogImage 生成的路径
+		if !strings.HasPrefix(name, "/blogs/") || strings.Contains(name, "..") {
+			return ErrReviewImageInvalid
+		}
+	}
+	review.Images = strings.Join(images, ",")
+
+	review.Verified = false
+	if review.OrderId <= 0 {
+		review.OrderId = 0
+		return nil
+	}
+
+	var order model.VoucherOrder
+	if err := order.QueryVoucherOrderById(review.OrderId); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrReviewOrderInvalid
+		}
+		return fmt.Errorf("db query voucher order %d: %w", review.OrderId, err)
+	}
+	if order.UserId != userID || order.Status != model.USED {
+		return ErrReviewOrderInvalid
+	}
+
+	var voucher model.Voucher
+	if err := voucher.QueryVoucherById(order.VoucherId); err != nil {
+		return fmt.Errorf("db query voucher %d: %w", order.VoucherId, err)
+	}
+	if voucher.ShopId != review.ShopId {
+		return ErrReviewOrderInvalid
+	}
+
+	review.Verified = true
+	return nil
+}
+
+// evictShopCache 店铺评分/评价数变化后删除店铺缓存
+func evictShopCache(ctx context.Context, shopID int64) {
+	redisKey := redisx.CACHE_SHOP_KEY + strconv.FormatInt(shopID, 10)
+	if err := redis.GetRedisClient().Del(ctx, redisKey).Err(); err != nil {
+		logrus.Warnf("del shop cache %d failed: %v", shopID, err)
+	}
+}
+
+func splitImages(images string) []string {
+	var result []string
+	for _, name := range strings.Split(images, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// diffImages 返回 oldImages 中不再出现在 newImages 里的图片
+func diffImages(oldImages, newImages string) []string {
+	keep := make(map[string]struct{})
+	for _, name := range splitImages(newImages) {
+		keep[name] = struct{}{}
+	}
+	var removed []string
+	for _, name := range splitImages(oldImages) {
+		if _, ok := keep[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	return removed
+}
@@ -0,0 +1,197 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/model"
+	"local-review-go/src/utils"
+	"local-review-go/src/utils/redisx"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	levelRecomputeInterval = time.Hour
+	levelBatchSize         = 500
+)
+
+// 成长值 = 累计获得积分 + 订单数 * 20 + 博客数 * 10 + 获赞数 * 2 + 获评数
+const (
+	growthPerOrder   = 20
+	growthPerBlog    = 10
+	growthPerLike    = 2
+	growthPerComment = 1
+)
+
+// UserTier 会员等级，成长值达到 MinGrowth 即可升到该等级
+type UserTier struct {
+	Level     int    `json:"level"`
+	Name      string `json:"name"`
+	MinGrowth int    `json:"minGrowth"`
+}
+
+// userTiers 按等级升序排列
+var userTiers = []UserTier{
+	{Level: 0, Name: "普通会员", MinGrowth: 0},
+	{Level: 1, Name: "青铜会员", MinGrowth: 50},
+	{Level: 2, Name: "白银会员", MinGrowth: 200},
+	{Level: 3, Name: "黄金会员", MinGrowth: 500},
+	{Level: 4, Name: "铂金会员", MinGrowth: 1500},
+	{Level: 5, Name: "钻石会员", MinGrowth: 5000},
+}
+
+// UserActivity 计算等级用到的用户活跃数据
+type UserActivity struct {
+	EarnedCredits int
+	Orders        int
+	Blogs         int
+	Liked         int
+	Comments      int
+}
+
+func (a UserActivity) Growth() int {
+	return a.EarnedCredits + a.Orders*growthPerOrder + a.Blogs*growthPerBlog +
+		a.Liked*growthPerLike + a.Comments*growthPerComment
+}
+
+// levelOfGrowth 成长值对应的等级
+func levelOfGrowth(growth int) int {
+	level := 0
+	for _, tier := range userTiers {
+		if growth >= tier.MinGrowth {
+			level = tier.Level
+		}
+	}
+	return level
+}
+
+// tierName 等级对应的会员名称
+func tierName(level int) string {
+	for i := len(userTiers) - 1; i >= 0; i-- {
+		if level >= userTiers[i].Level {
+			return userTiers[i].Name
+		}
+	}
+	return userTiers[0].Name
+}
+
+// StartWorkers 启动定期重算用户等级的任务
+func (l *userLogic) StartWorkers() {
+	go l.recomputeLevels()
+}
+
+func (l *userLogic) recomputeLevels() {
+	l.recomputeLevelsWithLock()
+
+	ticker := time.NewTicker(levelRecomputeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.recomputeLevelsWithLock()
+	}
+}
+
+func (l *userLogic) recomputeLevelsWithLock() {
+	ctx := context.Background()
+	lock, acquired, err := utils.NewLocker().
+		LockWithWatchDog(ctx, redisx.USER_LEVEL_LOCK_KEY, 30*time.Second)
+	if err != nil || !acquired {
+		return
+	}
+	defer lock.Unlock(ctx)
+
+	if err := recomputeLevels(lockFence(lock)); err != nil {
+		logrus.Errorf("recompute user levels failed: %v", err)
+	}
+}
+
+// recomputeLevels 分批统计用户活跃数据，只更新等级有变化的用户
+// 每批在一个事务内写入并校验 fencing token，锁已被其它实例接管时停止
+func recomputeLevels(fence model.Fence) error {
+	var (
+		userInfoUtils model.UserInfo
+		lastUserId    int64
+		changed       int
+	)
+	for {
+		infos, err := userInfoUtils.QueryUserInfosAfter(lastUserId, levelBatchSize)
+		if err != nil {
+			return fmt.Errorf("db query user infos after %d: %w", lastUserId, err)
+		}
+		if len(infos) == 0 {
+			break
+		}
+		lastUserId = infos[len(infos)-1].UserId
+
+		activities, err := queryUserActivities(infos)
+		if err != nil {
+			return err
+		}
+		levels := make(map[int64]int)
+		for _, info := range infos {
+			if level := levelOfGrowth(activities[info.UserId].Growth()); level != info.Level {
+				levels[info.UserId] = level
+			}
+		}
+		err = mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+			if err := fence.Check(tx); err != nil {
+				return err
+			}
+			for userId, level := range levels {
+				if err := userInfoUtils.UpdateLevel(tx, userId, level); err != nil {
+					return fmt.Errorf("db update level of user %d to %d: %w", userId, level, err)
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, model.ErrStaleFence) {
+			return err
+		}
+		if err != nil {
+			logrus.Warnf("update levels after user %d failed: %v", infos[0].UserId, err)
+		} else {
+			changed += len(levels)
+		}
+		if len(infos) < levelBatchSize {
+			break
+		}
+	}
+	logrus.Infof("recompute user levels done, %d changed", changed)
+	return nil
+}
+
+func queryUserActivities(infos []model.UserInfo) (map[int64]UserActivity, error) {
+	userIds := make([]int64, len(infos))
+	for i, info := range infos {
+		userIds[i] = info.UserId
+	}
+
+	earned, err := new(model.CreditTxn).SumEarnedByUsers(userIds)
+	if err != nil {
+		return nil, fmt.Errorf("db sum earned credits: %w", err)
+	}
+	orders, err := new(model.VoucherOrder).CountPaidByUsers(userIds)
+	if err != nil {
+		return nil, fmt.Errorf("db count paid orders: %w", err)
+	}
+	engagements, err := new(model.Blog).QueryEngagementByUsers(userIds)
+	if err != nil {
+		return nil, fmt.Errorf("db query blog engagement: %w", err)
+	}
+
+	activities := make(map[int64]UserActivity, len(userIds))
+	for _, id := range userIds {
+		engagement := engagements[id]
+		activities[id] = UserActivity{
+			EarnedCredits: earned[id],
+			Orders:        orders[id],
+			Blogs:         engagement.Blogs,
+			Liked:         engagement.Liked,
+			Comments:      engagement.Comments,
+		}
+	}
+	return activities, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"local-review-go/src/config/mysql"
 	"local-review-go/src/config/redis"
 	"local-review-go/src/middleware"
 	"local-review-go/src/model"
@@ -14,9 +15,20 @@ import (
 type UserLogic interface {
 	SendCode(ctx context.Context, phone string) error
 	Login(ctx context.Context, phone, code string) (string, error)
-	Sign(ctx context.Context, userID int64) error
-	GetSignCount(ctx context.Context, userID int64) (int, error)
+	Sign(ctx context.Context, userID int64) (SignResult, error)
+	GetSignCount(ctx context.Context, userID int64) (SignStreak, error)
+	GetSignCalendar(ctx context.Context, userID int64, month time.Time) (SignCalendar, error)
+	MakeupSign(ctx context.Context, userID int64, date time.Time) (SignMakeupResult, error)
 	GetUserInfo(ctx context.Context, id int64) (model.UserInfo, error)
+	GetProfile(ctx context.Context, user middleware.AuthUser) (UserProfile, error)
+	StartWorkers()
+}
+
+// UserProfile 当前登录用户的信息，附带会员等级
+type UserProfile struct {
+	middleware.AuthUser
+	Level int    `json:"level"`
+	Tier  string `json:"tier"`
 }
 
 // UserBrief 用于对外返回/内部传递的用户简要信息
@@ -26,10 +38,13 @@ type UserBrief struct {
 	Icon     string `json:"icon"`
 }
 
-type userLogic struct{}
+type userLogic struct {
+	signRules []SignRewardRule
+	blooms    *BloomRegistry
+}
 
-func NewUserLogic() UserLogic {
-	return &userLogic{}
+func NewUserLogic(blooms *BloomRegistry) UserLogic {
+	return &userLogic{signRules: defaultSignRewardRules, blooms: blooms}
 }
 
 func (l *userLogic) SendCode(ctx context.Context, phone string) error {
@@ -68,6 +83,7 @@ func (l *userLogic) Login(ctx context.Context, phone, code string) (string, erro
 		if err = user.SaveUser(); err != nil {
 			return "", fmt.Errorf("create user %s: %w", phone, err)
 		}
+		l.blooms.Add(BloomUser, user.Id)
 	}
 
 	var authUser middleware.AuthUser
@@ -86,56 +102,23 @@ func (l *userLogic) Login(ctx context.Context, phone, code string) (string, erro
 	return token, nil
 }
 
-// Sign 用户签到
-func (l *userLogic) Sign(ctx context.Context, userID int64) error {
-	now := time.Now()
-	year, month := now.Year(), now.Month()
-	day := now.Day()
-
-	key := fmt.Sprintf("%s%d:%04d%02d", redisx.USER_SIGN_KEY, userID, year, month)
-	if err := redis.GetRedisClient().SetBit(ctx, key, int64(day-1), 1).Err(); err != nil {
-		return fmt.Errorf("set sign bit for user %d: %w", userID, err)
-	}
-	return nil
-}
-
-// GetSignCount 获取当月连续签到天数
-func (l *userLogic) GetSignCount(ctx context.Context, userID int64) (int, error) {
-	now := time.Now()
-	year, month := now.Year(), now.Month()
-	day := now.Day()
-
-	key := fmt.Sprintf("%s%d:%04d%02d", redisx.USER_SIGN_KEY, userID, year, month)
-
-	result, err := redis.GetRedisClient().Do(ctx,
-		"BITFIELD", key,
-		"GET", fmt.Sprintf("u%d", day), "0").Int64Slice()
-	if err != nil {
-		return 0, fmt.Errorf("get sign bitfield user=%d: %w", userID, err)
-	}
-
-	if len(result) == 0 || result[0] == 0 {
-		return 0, nil // 无签到记录
-	}
-
-	num := result[0]
-	count := 0
-	for {
-		if (num & 1) == 0 {
-			break
-		}
-		count++
-		num >>= 1
-	}
-
-	return count, nil
-}
-
 func (l *userLogic) GetUserInfo(ctx context.Context, id int64) (model.UserInfo, error) {
+	if err := l.blooms.Check(BloomUser, id); err != nil {
+		return model.UserInfo{}, err
+	}
 	var userInfoUtils model.UserInfo
 	info, err := userInfoUtils.GetUserInfoById(id)
 	if err != nil {
 		return model.UserInfo{}, fmt.Errorf("db get user info %d: %w", id, err)
 	}
+	info.Tier = tierName(info.Level)
 	return info, nil
 }
+
+func (l *userLogic) GetProfile(ctx context.Context, user middleware.AuthUser) (UserProfile, error) {
+	level, err := new(model.UserInfo).GetLevel(mysql.GetMysqlDB().WithContext(ctx), user.Id)
+	if err != nil {
+		return UserProfile{}, fmt.Errorf("db get level of user %d: %w", user.Id, err)
+	}
+	return UserProfile{AuthUser: user, Level: level, Tier: tierName(level)}, nil
+}
@@ -0,0 +1,270 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/script"
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/config/redis"
+	"local-review-go/src/model"
+	"local-review-go/src/utils/redisx"
+	"math/bits"
+	"strconv"
+	"time"
+
+	redisConfig "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	signMakeupQuota     = 3  // 每月可补签次数
+	signMakeupWindow    = 30 // 只能补签最近多少天内的日期
+	signStreakMaxMonths = 13 // 计算连续签到时最多回溯的月数
+	signMakeupTTL       = 62 * 24 * time.Hour
+)
+
+var (
+	ErrSignDateInvalid   = errors.New("补签日期无效")
+	ErrSignMakeupQuota   = errors.New("本月补签次数已用完")
+	ErrSignAlreadySigned = errors.New("该日期已签到")
+)
+
+// SignRewardRule 连续签到奖励规则，连续签到天数达到 Streak 时发放 Credits 积分
+// Repeat 为 true 时每满 Streak 天都会发放一次
+type SignRewardRule struct {
+	Streak  int
+	Credits int
+	Repeat  bool
+}
+
+// defaultSignRewardRules 每日签到 1 分，连续 3 天、每满 7 天、每满 30 天额外奖励
+var defaultSignRewardRules = []SignRewardRule{
+	{Streak: 1, Credits: 1, Repeat: true},
+	{Streak: 3, Credits: 5},
+	{Streak: 7, Credits: 20, Repeat: true},
+	{Streak: 30, Credits: 100, Repeat: true},
+}
+
+// SignResult 签到结果，AlreadySigned 为 true 时本次签到不发放奖励
+type SignResult struct {
+	AlreadySigned bool `json:"alreadySigned"`
+	Streak        int  `json:"streak"`
+	Credits       int  `json:"credits"`
+}
+
+// SignStreak 连续签到天数，今天未签到时 Current 为截至昨天的连续天数
+type SignStreak struct {
+	Current int `json:"current"`
+	Longest int `json:"longest"`
+}
+
+// SignCalendar 某月的签到日历，Bitmap 第 i 位（从低位起）表示第 i+1 天是否签到
+type SignCalendar struct {
+	Month      string `json:"month"`
+	Days       int    `json:"days"`
+	Bitmap     uint32 `json:"bitmap"`
+	SignedDays []int  `json:"signedDays"`
+	MakeupLeft int    `json:"makeupLeft"`
+}
+
+// SignMakeupResult 补签结果
+type SignMakeupResult struct {
+	Streak     int `json:"streak"`
+	MakeupLeft int `json:"makeupLeft"`
+}
+
+func signKey(userID int64, date time.Time) string {
+	return fmt.Sprintf("%s%d:%04d%02d", redisx.USER_SIGN_KEY, userID, date.Year(), date.Month())
+}
+
+func signMakeupKey(userID int64, date time.Time) string {
+	return fmt.Sprintf("%s%d:%04d%02d", redisx.USER_SIGN_MAKEUP_KEY, userID, date.Year(), date.Month())
+}
+
+func daysInMonth(date time.Time) int {
+	return time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, date.Location()).Day()
+}
+
+// Sign 用户签到，重复签到不会重复发放奖励
+// 签到位在 Redis、奖励在 MySQL 账本，两步无法原子完成，因此以账本幂等键（用户+日期）为准：
+// 签到位一经写入不再撤销，奖励记账失败或进程中断后，当天再次签到会按同一幂等键补发；
+// 账本中已有当天的奖励才视为重复签到
+func (l *userLogic) Sign(ctx context.Context, userID int64) (SignResult, error) {
+	now := time.Now()
+	key := signKey(userID, now)
+	offset := int64(now.Day() - 1)
+
+	old, err := redis.GetRedisClient().SetBit(ctx, key, offset, 1).Result()
+	if err != nil {
+		return SignResult{}, fmt.Errorf("set sign bit for user %d: %w", userID, err)
+	}
+
+	streak, err := l.countSignStreak(ctx, userID, now)
+	if err != nil {
+		return SignResult{}, err
+	}
+	credits := l.signRewardCredits(streak)
+	if credits == 0 {
+		return SignResult{AlreadySigned: old == 1, Streak: streak}, nil
+	}
+
+	var created bool
+	err = mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var postErr error
+		_, created, postErr = postCredits(tx, CreditPosting{
+			UserId:  userID,
+			BizType: model.CREDIT_BIZ_SIGN,
+			BizKey:  signBizKey(userID, now),
+			Amount:  credits,
+		})
+		return postErr
+	})
+	if err != nil {
+		return SignResult{}, fmt.Errorf("db add sign credits user=%d credits=%d: %w", userID, credits, err)
+	}
+	if !created {
+		return SignResult{AlreadySigned: true, Streak: streak}, nil
+	}
+	l.updateLongestStreak(ctx, userID, streak)
+	return SignResult{Streak: streak, Credits: credits}, nil
+}
+
+// signBizKey 每日签到奖励的账本幂等键
+func signBizKey(userID int64, date time.Time) string {
+	return fmt.Sprintf("%s:%d:%s", model.CREDIT_BIZ_SIGN, userID, date.Format("20060102"))
+}
+
+// signRewardCredits 根据奖励规则计算连续签到 streak 天时发放的积分
+func (l *userLogic) signRewardCredits(streak int) int {
+	credits := 0
+	for _, rule := range l.signRules {
+		if rule.Streak <= 0 {
+			continue
+		}
+		if streak == rule.Streak || (rule.Repeat && streak%rule.Streak == 0) {
+			credits += rule.Credits
+		}
+	}
+	return credits
+}
+
+// MakeupSign 补签最近 signMakeupWindow 天内的某一天，每月最多 signMakeupQuota 次
+// 补签只接上连续天数，不发放签到奖励
+func (l *userLogic) MakeupSign(ctx context.Context, userID int64, date time.Time) (SignMakeupResult, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, now.Location())
+	if !date.Before(today) || date.Before(today.AddDate(0, 0, -signMakeupWindow)) {
+		return SignMakeupResult{}, ErrSignDateInvalid
+	}
+
+	keys := []string{signKey(userID, date), signMakeupKey(userID, date)}
+	used, err := script.SignMakeup.Run(ctx, redis.GetRedisClient(), keys,
+		date.Day()-1, signMakeupQuota, int64(signMakeupTTL/time.Second)).Int()
+	if err != nil {
+		return SignMakeupResult{}, fmt.Errorf("makeup sign user=%d date=%s: %w", userID, date.Format(time.DateOnly), err)
+	}
+	switch used {
+	case -1:
+		return SignMakeupResult{}, ErrSignAlreadySigned
+	case -2:
+		return SignMakeupResult{}, ErrSignMakeupQuota
+	}
+
+	streak, err := l.currentSignStreak(ctx, userID, now)
+	if err != nil {
+		return SignMakeupResult{}, err
+	}
+	l.updateLongestStreak(ctx, userID, streak)
+	return SignMakeupResult{Streak: streak, MakeupLeft: signMakeupQuota - used}, nil
+}
+
+// GetSignCount 获取当前连续签到天数（可跨月）与历史最长连续天数
+func (l *userLogic) GetSignCount(ctx context.Context, userID int64) (SignStreak, error) {
+	current, err := l.currentSignStreak(ctx, userID, time.Now())
+	if err != nil {
+		return SignStreak{}, err
+	}
+	longest := l.updateLongestStreak(ctx, userID, current)
+	return SignStreak{Current: current, Longest: longest}, nil
+}
+
+// GetSignCalendar 获取某月的签到日历与剩余补签次数
+func (l *userLogic) GetSignCalendar(ctx context.Context, userID int64, month time.Time) (SignCalendar, error) {
+	days := daysInMonth(month)
+	client := redis.GetRedisClient()
+	pipe := client.Pipeline()
+	bitsCmd := pipe.BitField(ctx, signKey(userID, month), "GET", fmt.Sprintf("u%d", days), 0)
+	usedCmd := pipe.Get(ctx, signMakeupKey(userID, month))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redisConfig.Nil) {
+		return SignCalendar{}, fmt.Errorf("get sign calendar user=%d month=%s: %w", userID, month.Format("2006-01"), err)
+	}
+
+	var raw int64
+	if values := bitsCmd.Val(); len(values) > 0 {
+		raw = values[0]
+	}
+	calendar := SignCalendar{
+		Month:      month.Format("2006-01"),
+		Days:       days,
+		SignedDays: []int{},
+		MakeupLeft: signMakeupQuota,
+	}
+	// BITFIELD 读出的整数中第 1 天在最高位
+	for day := 1; day <= days; day++ {
+		if raw>>(days-day)&1 == 1 {
+			calendar.Bitmap |= 1 << (day - 1)
+			calendar.SignedDays = append(calendar.SignedDays, day)
+		}
+	}
+	if used, err := strconv.Atoi(usedCmd.Val()); err == nil {
+		calendar.MakeupLeft = max(signMakeupQuota-used, 0)
+	}
+	return calendar, nil
+}
+
+// currentSignStreak 今天已签到时返回截至今天的连续天数，否则返回截至昨天的
+func (l *userLogic) currentSignStreak(ctx context.Context, userID int64, now time.Time) (int, error) {
+	streak, err := l.countSignStreak(ctx, userID, now)
+	if err != nil || streak > 0 {
+		return streak, err
+	}
+	return l.countSignStreak(ctx, userID, now.AddDate(0, 0, -1))
+}
+
+// countSignStreak 从 end 往前数连续签到天数，某月从 1 号起全部签到时继续回溯上个月
+func (l *userLogic) countSignStreak(ctx context.Context, userID int64, end time.Time) (int, error) {
+	client := redis.GetRedisClient()
+	streak := 0
+	day := end
+	for i := 0; i < signStreakMaxMonths; i++ {
+		result, err := client.BitField(ctx, signKey(userID, day), "GET", fmt.Sprintf("u%d", day.Day()), 0).Result()
+		if err != nil {
+			return 0, fmt.Errorf("get sign bitfield user=%d month=%s: %w", userID, day.Format("2006-01"), err)
+		}
+		if len(result) == 0 {
+			return streak, nil
+		}
+		// 末尾连续的 1 即截至 day 的连续签到天数
+		n := bits.TrailingZeros64(^uint64(result[0]))
+		streak += n
+		if n < day.Day() {
+			return streak, nil
+		}
+		day = day.AddDate(0, 0, -day.Day())
+	}
+	return streak, nil
+}
+
+// updateLongestStreak 记录最长连续签到天数并返回，失败时只记录日志
+func (l *userLogic) updateLongestStreak(ctx context.Context, userID int64, streak int) int {
+	key := redisx.USER_SIGN_STAT_KEY + strconv.FormatInt(userID, 10)
+	longest, err := script.SignLongest.Run(ctx, redis.GetRedisClient(), []string{key}, streak).Int()
+	if err != nil {
+		logrus.Warnf("update longest sign streak of user %d failed: %v", userID, err)
+		return streak
+	}
+	return longest
+}
@@ -4,10 +4,7 @@ import (
 	"context"
 	"fmt"
 	"local-review-go/src/config/mysql"
-	"local-review-go/src/config/redis"
 	"local-review-go/src/model"
-	"local-review-go/src/utils/redisx"
-	"strconv"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -18,57 +15,67 @@ type VoucherLogic interface {
 	AddVoucher(ctx context.Context, voucher *model.Voucher) error
 	AddSeckillVoucher(ctx context.Context, voucher *model.Voucher) error
 	QueryVoucherOfShop(ctx context.Context, shopID int64) ([]model.Voucher, error)
+	AdjustSeckillStock(ctx context.Context, voucherID int64, delta int) (int, error)
+	UpdateSeckillWindow(ctx context.Context, voucherID int64, beginTime, endTime time.Time) error
+	PauseSeckill(ctx context.Context, voucherID int64) error
+	ResumeSeckill(ctx context.Context, voucherID int64) error
+	CancelSeckill(ctx context.Context, voucherID int64) error
+	CheckSeckillStock(ctx context.Context, voucherID int64) (SeckillStockReport, error)
+	StartWorkers()
 }
 
-type voucherLogic struct{}
+type voucherLogic struct {
+	blooms *BloomRegistry
+}
 
-func NewVoucherLogic() VoucherLogic {
-	return &voucherLogic{}
+func NewVoucherLogic(blooms *BloomRegistry) VoucherLogic {
+	return &voucherLogic{blooms: blooms}
 }
 
 func (l *voucherLogic) AddVoucher(ctx context.Context, voucher *model.Voucher) error {
 	if err := voucher.AddVoucher(mysql.GetMysqlDB().WithContext(ctx)); err != nil {
 		return fmt.Errorf("db add voucher: %w", err)
 	}
+	l.blooms.Add(BloomVoucher, voucher.Id)
 	return nil
 }
 
 func (l *voucherLogic) AddSeckillVoucher(ctx context.Context, voucher *model.Voucher) error {
-	return mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	seckillVoucher := model.SecKillVoucher{
+		Stock:      voucher.Stock,
+		Status:     model.SECKILL_ACTIVE,
+		BeginTime:  voucher.BeginTime,
+		EndTime:    voucher.EndTime,
+		CreateTime: voucher.CreateTime,
+		UpdateTime: voucher.UpdateTime,
+	}
+	err := mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		if err := voucher.AddVoucher(tx); err != nil {
 			return fmt.Errorf("写入主表失败: %w", err)
 		}
 
-		seckillVoucher := model.SecKillVoucher{
-			VoucherId:  voucher.Id,
-			Stock:      voucher.Stock,
-			BeginTime:  voucher.BeginTime,
-			EndTime:    voucher.EndTime,
-			CreateTime: voucher.CreateTime,
-			UpdateTime: voucher.UpdateTime,
-		}
+		seckillVoucher.VoucherId = voucher.Id
 		if err := seckillVoucher.AddSeckillVoucher(tx); err != nil {
 			return fmt.Errorf("写入秒杀表失败: %w", err)
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	l.blooms.Add(BloomVoucher, voucher.Id)
 
-	// 事务成功后，异步更新Redis
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-
-		redisKey := redisx.SECKILL_STOCK_KEY + strconv.FormatInt(voucher.Id, 10)
-		if err := redis.GetRedisClient().Set(ctx, redisKey, voucher.Stock, 24*time.Hour).Err(); err != nil {
-			logrus.Errorf("Redis缓存更新失败: key=%s, error=%v", redisKey, err)
-			retryUpdateRedis(redisKey, voucher.Stock)
-		}
-	}()
-
+	// 缓存元数据，即将开始的秒杀同时加载库存，其余由预热任务在开始前加载
+	if _, err := warmUpSeckill(ctx, *voucher, seckillVoucher); err != nil {
+		logrus.Warnf("warm up seckill voucher %d failed, will retry in warm-up job: %v", voucher.Id, err)
+	}
 	return nil
 }
 
 func (l *voucherLogic) QueryVoucherOfShop(ctx context.Context, shopID int64) ([]model.Voucher, error) {
+	if err := l.blooms.Check(BloomShop, shopID); err != nil {
+		return nil, err
+	}
 	var vocherUtils model.Voucher
 	vouchers, err := vocherUtils.QueryVoucherByShop(ctx, shopID)
 	if err != nil {
@@ -76,17 +83,3 @@ func (l *voucherLogic) QueryVoucherOfShop(ctx context.Context, shopID int64) ([]
 	}
 	return vouchers, nil
 }
-
-// 辅助函数：Redis更新重试
-func retryUpdateRedis(key string, stock int) {
-	for i := 0; i < 3; i++ {
-		time.Sleep(time.Duration(i+1) * time.Second)
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		err := redis.GetRedisClient().Set(ctx, key, stock, 24*time.Hour).Err()
-		cancel()
-		if err == nil {
-			return
-		}
-		logrus.Warnf("Redis重试%d次失败: %v", i+1, err)
-	}
-}
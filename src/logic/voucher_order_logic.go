@@ -4,12 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"local-review-go/script"
 	"local-review-go/src/config/mysql"
 	redisClient "local-review-go/src/config/redis"
 	"local-review-go/src/model"
 	"local-review-go/src/utils"
 	"local-review-go/src/utils/redisx"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -26,24 +26,58 @@ const (
 	retryTTL   = 24 * time.Hour
 )
 
+// seckillReleaseTTL 归还标记的保留时间，覆盖消息在 pending list 中重试的时长
+const seckillReleaseTTL = 7 * 24 * time.Hour
+
+// ErrVoucherNotForCredits 优惠券不支持积分兑换
+var ErrVoucherNotForCredits = errors.New("该优惠券不支持积分兑换")
+
+// ErrSeckillVoucherForCredits 秒杀券只能通过秒杀下单，不能直接用积分兑换
+var ErrSeckillVoucherForCredits = errors.New("秒杀券请通过秒杀下单")
+
+// ErrVoucherLevelTooLow 用户等级低于优惠券要求
+var ErrVoucherLevelTooLow = errors.New("用户等级不满足领取条件")
+
+var (
+	ErrSeckillNotStarted = errors.New("秒杀尚未开始")
+	ErrSeckillEnded      = errors.New("秒杀已结束")
+	ErrSeckillClosed     = errors.New("秒杀已暂停或取消")
+)
+
+// 秒杀脚本返回码，与 script/voucher_script.lua 保持一致
+const (
+	seckillOK         = 0
+	seckillSoldOut    = 1
+	seckillUserLimit  = 2
+	seckillDayLimit   = 3
+	seckillShopLimit  = 4
+	seckillNotStarted = 5
+	seckillEnded      = 6
+	seckillClosed     = 7
+	seckillNotLoaded  = 8
+)
+
 type VoucherOrderLogic interface {
-	SeckillVoucher(ctx context.Context, voucherID, userID int64) error
+	SeckillVoucher(ctx context.Context, voucherID, userID int64, payType int) error
+	PurchaseWithCredits(ctx context.Context, voucherID, userID int64) (model.VoucherOrder, error)
 	StartConsumers()
 }
 
 type voucherOrderLogic struct {
 	redis  *redisConfig.Client
-	script *redisConfig.Script
+	script *script.Script
+	idGen  redisx.IDGenerator
+	notify NotificationLogic
+	blooms *BloomRegistry
 }
 
-func NewVoucherOrderLogic() VoucherOrderLogic {
-	scriptBytes, err := os.ReadFile("script/voucher_script.lua")
-	if err != nil {
-		logrus.Errorf("读取秒杀脚本失败: %v", err)
-	}
+func NewVoucherOrderLogic(notificationLogic NotificationLogic, idGen redisx.IDGenerator, blooms *BloomRegistry) VoucherOrderLogic {
 	return &voucherOrderLogic{
 		redis:  redisClient.GetRedisClient(),
-		script: redisConfig.NewScript(string(scriptBytes)),
+		script: script.Seckill,
+		idGen:  idGen,
+		notify: notificationLogic,
+		blooms: blooms,
 	}
 }
 
@@ -58,40 +92,92 @@ func (l *voucherOrderLogic) StartConsumers() {
 	go l.handlePendingList()
 }
 
-func (l *voucherOrderLogic) SeckillVoucher(ctx context.Context, voucherID int64, userID int64) error {
-	voucher, err := l.querySeckillVoucherById(voucherID)
+// SeckillVoucher 秒杀下单，时间、状态、库存与购买限制都在秒杀脚本中基于缓存的元数据判断
+// payType 为 model.EXTRAPAY 时在创建订单时用积分支付
+func (l *voucherOrderLogic) SeckillVoucher(ctx context.Context, voucherID int64, userID int64, payType int) error {
+	meta, found, err := getSeckillMeta(ctx, voucherID)
 	if err != nil {
-		return fmt.Errorf("query seckill voucher %d: %w", voucherID, err)
+		return fmt.Errorf("get seckill meta %d: %w", voucherID, err)
 	}
-	now := time.Now()
-	if now.Before(voucher.BeginTime) {
-		return errors.New("秒杀尚未开始")
+	if !found {
+		// 元数据未缓存时才会查库，先用布隆过滤器挡住不存在的优惠券
+		if err := l.blooms.Check(BloomVoucher, voucherID); err != nil {
+			return err
+		}
+		if meta, err = loadSeckill(ctx, voucherID); err != nil {
+			return err
+		}
 	}
-	if now.After(voucher.EndTime) {
-		return errors.New("秒杀已结束")
+	if err := checkVoucherLevel(ctx, meta.MinLevel, userID); err != nil {
+		return err
 	}
-	orderId, err := redisx.RedisWork.NextId("order")
+	if payType == model.EXTRAPAY {
+		if err := checkCreditsPayable(ctx, meta.Credits, userID); err != nil {
+			return err
+		}
+	}
+
+	orderId, err := l.idGen.NextId("order")
 	if err != nil {
 		return fmt.Errorf("generate order id: %w", err)
 	}
+	code, err := l.runSeckillScript(ctx, voucherID, userID, orderId, payType)
+	if err != nil {
+		return err
+	}
+	if code == seckillNotLoaded {
+		// 元数据过期或库存尚未预热，从 MySQL 加载后重试一次
+		if _, err := loadSeckill(ctx, voucherID); err != nil {
+			return err
+		}
+		if code, err = l.runSeckillScript(ctx, voucherID, userID, orderId, payType); err != nil {
+			return err
+		}
+	}
+	return seckillResultError(code)
+}
 
+func (l *voucherOrderLogic) runSeckillScript(ctx context.Context, voucherID, userID, orderId int64, payType int) (int64, error) {
+	now := time.Now()
 	keys := []string{}
 	values := []interface{}{
 		strconv.FormatInt(voucherID, 10),
 		strconv.FormatInt(userID, 10),
 		strconv.FormatInt(orderId, 10),
+		strconv.Itoa(payType),
+		now.UnixMilli(),
+		now.Format("20060102"),
 	}
 
-	result, err := l.script.Run(ctx, l.redis, keys, values...).Result()
+	code, err := l.script.Run(ctx, l.redis, keys, values...).Int64()
 	if err != nil {
-		return fmt.Errorf("run seckill script: %w", err)
+		return 0, fmt.Errorf("run seckill script voucher=%d user=%d: %w", voucherID, userID, err)
 	}
+	return code, nil
+}
 
-	r := result.(int64)
-	if r != 0 {
-		return errors.New("the condition is not meet")
+// seckillResultError 把秒杀脚本的返回码转换为错误
+func seckillResultError(code int64) error {
+	switch code {
+	case seckillOK:
+		return nil
+	case seckillSoldOut:
+		return model.ErrStockNotEnough
+	case seckillUserLimit:
+		return model.ErrDuplicateOrder
+	case seckillDayLimit:
+		return model.ErrDailyLimit
+	case seckillShopLimit:
+		return model.ErrShopLimit
+	case seckillNotStarted:
+		return ErrSeckillNotStarted
+	case seckillEnded:
+		return ErrSeckillEnded
+	case seckillClosed:
+		return ErrSeckillClosed
+	default:
+		return fmt.Errorf("unexpected seckill script result %d", code)
 	}
-	return nil
 }
 
 // SyncHandlerStream 处理消息队列的goroutine
@@ -184,40 +270,105 @@ func (l *voucherOrderLogic) handlePendingList() {
 	}
 }
 
+// seckillMessage 秒杀脚本投递到 stream.orders 的订单消息
+// shopId、day 与下单时间由新版脚本写入，旧版脚本投递的消息中为零值
+type seckillMessage struct {
+	order  model.VoucherOrder
+	shopId int64
+	day    string
+}
+
+func decodeSeckillMessage(msg redisConfig.XMessage) (seckillMessage, error) {
+	var m seckillMessage
+	if err := mapstructure.WeakDecode(msg.Values, &m.order); err != nil {
+		return seckillMessage{}, fmt.Errorf("decode voucher order message %s: %w", msg.ID, err)
+	}
+	m.day, _ = msg.Values["day"].(string)
+	if shopId, ok := msg.Values["shopId"].(string); ok {
+		m.shopId, _ = strconv.ParseInt(shopId, 10, 64)
+	}
+	// 订单时间取秒杀脚本执行时的时间，与脚本中每日计数的日期一致
+	if orderTime, ok := msg.Values["orderTime"].(string); ok {
+		if ms, err := strconv.ParseInt(orderTime, 10, 64); err == nil {
+			m.order.CreateTime = time.UnixMilli(ms)
+		}
+	}
+	return m, nil
+}
+
+// isOrderRejected MySQL 侧的库存或购买限制拒绝了秒杀脚本已放行的订单，重试也不会成功
+func isOrderRejected(err error) bool {
+	return errors.Is(err, model.ErrStockNotEnough) || errors.Is(err, model.ErrDuplicateOrder) ||
+		errors.Is(err, model.ErrDailyLimit) || errors.Is(err, model.ErrShopLimit)
+}
+
 // 处理优惠券消息(使用自动看门狗的锁)
 func (l *voucherOrderLogic) processVoucherMessage(msg redisConfig.XMessage) error {
-	var order model.VoucherOrder
-	if err := mapstructure.Decode(msg.Values, &order); err != nil {
-		return fmt.Errorf("decode voucher order message %s: %w", msg.ID, err)
+	m, err := decodeSeckillMessage(msg)
+	if err != nil {
+		return err
 	}
+	order := m.order
 
 	lockKey := fmt.Sprintf("lock:order:%d", order.UserId)
-	lock := utils.NewDistributedLock(l.redis)
+	lock := utils.NewLocker().NewMutex(lockKey, 10*time.Second)
 
+	// 同一用户的下单串行执行，最多等待 3 秒
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	acquired, token, err := lock.LockWithWatchDog(ctx, lockKey, 10*time.Second)
-	if err != nil || !acquired {
-		if err != nil {
-			return fmt.Errorf("lock order user=%d: %w", order.UserId, err)
-		}
-		return errors.New("系统繁忙，请重试")
+	if err := lock.Lock(ctx); err != nil {
+		return fmt.Errorf("lock order user=%d: %w", order.UserId, err)
 	}
-	defer lock.UnlockWithWatchDog(ctx, lockKey, token)
+	defer lock.Unlock(context.Background())
 
-	return createVoucherOrder(order)
+	order, err = createVoucherOrder(order, lockFence(lock))
+	if isOrderRejected(err) {
+		// 不再重试，直接进入死信并归还 Redis 中的扣减
+		l.handleFailedMessage(msg, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content := "秒杀订单创建成功"
+	if order.PayType == model.EXTRAPAY && order.Status == model.NOTPAYED {
+		content = "秒杀订单创建成功，积分不足，请更换支付方式"
+	}
+	l.notify.Notify(ctx, NotifyEvent{
+		UserId:   order.UserId,
+		Type:     model.NOTIFY_ORDER,
+		TargetId: order.Id,
+		Content:  content,
+	})
+	return nil
 }
 
-// 创建优惠券订单
-func createVoucherOrder(order model.VoucherOrder) error {
-	return mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
-		purchasedFlag, err := new(model.VoucherOrder).HasPurchasedVoucher(order.UserId, order.VoucherId, tx)
-		if err != nil || purchasedFlag {
-			if err != nil {
-				return fmt.Errorf("check duplicate order user=%d voucher=%d: %w", order.UserId, order.VoucherId, err)
-			}
-			return model.ErrDuplicateOrder
+// 创建优惠券订单，积分支付的订单在同一事务中扣减积分，积分不足时订单保持未支付
+// fence 为用户下单锁的 fencing token，锁已被他人接管时整个事务回滚，消息稍后重试
+func createVoucherOrder(order model.VoucherOrder, fence model.Fence) (model.VoucherOrder, error) {
+	err := mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := fence.Check(tx); err != nil {
+			return err
+		}
+		// 消息重复投递时订单已存在
+		exists, err := new(model.VoucherOrder).ExistsVoucherOrder(tx, order.Id)
+		if err != nil {
+			return fmt.Errorf("check order %d exists: %w", order.Id, err)
+		}
+		if exists {
+			return nil
+		}
+
+		var voucher model.Voucher
+		if err := tx.Table(voucher.TableName()).Where("id = ?", order.VoucherId).First(&voucher).Error; err != nil {
+			return fmt.Errorf("db query voucher %d: %w", order.VoucherId, err)
+		}
+		if order.CreateTime.IsZero() {
+			order.CreateTime = time.Now()
+		}
+		if err := checkPurchaseLimit(tx, &voucher, order.UserId, order.CreateTime); err != nil {
+			return err
 		}
 
 		var sv model.SecKillVoucher
@@ -225,13 +376,199 @@ func createVoucherOrder(order model.VoucherOrder) error {
 			return fmt.Errorf("decrease voucher stock %d: %w", order.VoucherId, err)
 		}
 
-		order.CreateTime = time.Now()
+		order.Status = model.NOTPAYED
 		order.UpdateTime = time.Now()
+		if order.PayType == model.EXTRAPAY {
+			// 在保存点中扣减，积分不足时只回滚记账部分
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				return payOrderWithCredits(tx, &order, &voucher)
+			})
+			if err != nil && !errors.Is(err, model.ErrCreditsNotEnough) {
+				return err
+			}
+		}
 		if err := order.CreateVoucherOrder(tx); err != nil {
 			return fmt.Errorf("create voucher order: %w", err)
 		}
 		return nil
 	})
+	return order, err
+}
+
+// PurchaseWithCredits 用积分兑换普通优惠券，下单与扣减积分在同一事务中完成
+func (l *voucherOrderLogic) PurchaseWithCredits(ctx context.Context, voucherID, userID int64) (model.VoucherOrder, error) {
+	var voucher model.Voucher
+	if err := voucher.QueryVoucherById(voucherID); err != nil {
+		return model.VoucherOrder{}, fmt.Errorf("db query voucher %d: %w", voucherID, err)
+	}
+	if voucher.Type == 1 {
+		return model.VoucherOrder{}, ErrSeckillVoucherForCredits
+	}
+	if voucher.Credits <= 0 {
+		return model.VoucherOrder{}, ErrVoucherNotForCredits
+	}
+	if err := checkVoucherLevel(ctx, voucher.MinLevel, userID); err != nil {
+		return model.VoucherOrder{}, err
+	}
+
+	orderId, err := l.idGen.NextId("order")
+	if err != nil {
+		return model.VoucherOrder{}, fmt.Errorf("generate order id: %w", err)
+	}
+	now := time.Now()
+	order := model.VoucherOrder{
+		Id:         orderId,
+		UserId:     userID,
+		VoucherId:  voucherID,
+		PayType:    model.EXTRAPAY,
+		Status:     model.NOTPAYED,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	// 与秒杀订单的创建共用用户级的锁，保证购买限制的检查与下单不被并发穿透
+	lockKey := fmt.Sprintf("lock:order:%d", userID)
+	lock, acquired, err := utils.NewLocker().LockWithWatchDog(ctx, lockKey, 10*time.Second)
+	if err != nil {
+		return model.VoucherOrder{}, fmt.Errorf("lock order user=%d: %w", userID, err)
+	}
+	if !acquired {
+		return model.VoucherOrder{}, errors.New("系统繁忙，请重试")
+	}
+	defer lock.Unlock(ctx)
+
+	fence := lockFence(lock)
+	err = mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := fence.Check(tx); err != nil {
+			return err
+		}
+		if err := checkPurchaseLimit(tx, &voucher, userID, now); err != nil {
+			return err
+		}
+		if err := payOrderWithCredits(tx, &order, &voucher); err != nil {
+			return err
+		}
+		if err := order.CreateVoucherOrder(tx); err != nil {
+			return fmt.Errorf("create voucher order: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return model.VoucherOrder{}, err
+	}
+
+	// 秒杀脚本按 Redis 计数判断店铺限购，积分兑换的订单同样计入，与 MySQL 侧的统计一致
+	shopKey := redisx.SECKILL_SHOP_COUNT_KEY + strconv.FormatInt(voucher.ShopId, 10)
+	if err := l.redis.HIncrBy(ctx, shopKey, strconv.FormatInt(userID, 10), 1).Err(); err != nil {
+		// 创建秒杀订单时 MySQL 侧仍会按订单记录拦截
+		logrus.Warnf("count shop order shop=%d user=%d failed: %v", voucher.ShopId, userID, err)
+	}
+
+	l.notify.Notify(ctx, NotifyEvent{
+		UserId:   userID,
+		Type:     model.NOTIFY_ORDER,
+		TargetId: order.Id,
+		Content:  "积分兑换优惠券成功",
+	})
+	return order, nil
+}
+
+// lockFence 持锁写入 MySQL 时携带的 fencing token，token 落后于 MySQL 记录时提升 Redis 中的计数器
+func lockFence(lock utils.Lock) model.Fence {
+	return model.Fence{
+		Name:  lock.Key(),
+		Token: lock.Fence(),
+		Raise: func(mark int64) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := lock.RaiseFence(ctx, mark); err != nil {
+				logrus.Warnf("raise fence of lock %s to %d failed: %v", lock.Key(), mark, err)
+			}
+		},
+	}
+}
+
+// checkPurchaseLimit 在事务中按订单记录检查优惠券的购买限制，与秒杀脚本中的计数保持一致：
+// 每日限购按下单时间 orderTime 所在的自然日统计，店铺限购统计该店铺的全部订单
+func checkPurchaseLimit(tx *gorm.DB, voucher *model.Voucher, userID int64, orderTime time.Time) error {
+	var orderUtils model.VoucherOrder
+	if limit := voucher.PerUserLimit(); limit > 0 {
+		count, err := orderUtils.CountUserOrders(tx, userID, voucher.Id, time.Time{}, time.Time{})
+		if err != nil {
+			return fmt.Errorf("count orders user=%d voucher=%d: %w", userID, voucher.Id, err)
+		}
+		if count >= int64(limit) {
+			return model.ErrDuplicateOrder
+		}
+	}
+	if voucher.LimitPerDay > 0 {
+		day := time.Date(orderTime.Year(), orderTime.Month(), orderTime.Day(), 0, 0, 0, 0, orderTime.Location())
+		count, err := orderUtils.CountUserOrders(tx, userID, voucher.Id, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			return fmt.Errorf("count today orders user=%d voucher=%d: %w", userID, voucher.Id, err)
+		}
+		if count >= int64(voucher.LimitPerDay) {
+			return model.ErrDailyLimit
+		}
+	}
+	if voucher.LimitPerShop > 0 {
+		count, err := orderUtils.CountUserShopOrders(tx, userID, voucher.ShopId)
+		if err != nil {
+			return fmt.Errorf("count shop orders user=%d shop=%d: %w", userID, voucher.ShopId, err)
+		}
+		if count >= int64(voucher.LimitPerShop) {
+			return model.ErrShopLimit
+		}
+	}
+	return nil
+}
+
+// payOrderWithCredits 按优惠券的积分价格扣减积分并把订单置为已支付
+func payOrderWithCredits(tx *gorm.DB, order *model.VoucherOrder, voucher *model.Voucher) error {
+	if voucher.Credits <= 0 {
+		return ErrVoucherNotForCredits
+	}
+	_, _, err := postCredits(tx, CreditPosting{
+		UserId:  order.UserId,
+		BizType: model.CREDIT_BIZ_VOUCHER,
+		BizKey:  fmt.Sprintf("%s:%d", model.CREDIT_BIZ_VOUCHER, order.Id),
+		Amount:  -voucher.Credits,
+	})
+	if err != nil {
+		return err
+	}
+	order.Status = model.PAYED
+	order.PayTime = time.Now()
+	return nil
+}
+
+// checkVoucherLevel 检查用户等级是否满足优惠券的最低等级
+func checkVoucherLevel(ctx context.Context, minLevel int, userID int64) error {
+	if minLevel <= 0 {
+		return nil
+	}
+	level, err := new(model.UserInfo).GetLevel(mysql.GetMysqlDB().WithContext(ctx), userID)
+	if err != nil {
+		return fmt.Errorf("db get level of user %d: %w", userID, err)
+	}
+	if level < minLevel {
+		return ErrVoucherLevelTooLow
+	}
+	return nil
+}
+
+// checkCreditsPayable 秒杀前检查优惠券支持积分兑换且余额足够，扣减在创建订单时进行
+func checkCreditsPayable(ctx context.Context, price int, userID int64) error {
+	if price <= 0 {
+		return ErrVoucherNotForCredits
+	}
+	credits, err := new(model.UserInfo).GetCredits(mysql.GetMysqlDB().WithContext(ctx), userID)
+	if err != nil {
+		return fmt.Errorf("db get credits of user %d: %w", userID, err)
+	}
+	if credits < price {
+		return model.ErrCreditsNotEnough
+	}
+	return nil
 }
 
 // 获取消息重试次数
@@ -265,7 +602,7 @@ func (l *voucherOrderLogic) clearRetryCount(ctx context.Context, msgID string) {
 	}
 }
 
-// 处理失败消息
+// 处理失败消息：写入死信队列，归还 Redis 中的扣减并通知用户
 func (l *voucherOrderLogic) handleFailedMessage(msg redisConfig.XMessage, err error) {
 	logrus.Warnf("消息处理失败(ID:%s): %v", msg.ID, err)
 
@@ -283,12 +620,45 @@ func (l *voucherOrderLogic) handleFailedMessage(msg redisConfig.XMessage, err er
 	if dlerr != nil {
 		logrus.Errorf("死信队列添加失败: %v", dlerr)
 	}
+
+	m, decodeErr := decodeSeckillMessage(msg)
+	if decodeErr != nil {
+		logrus.Errorf("死信消息解析失败(ID:%s): %v", msg.ID, decodeErr)
+		return
+	}
+	// MySQL 库存不足说明 Redis 库存已偏多，只归还购买计数
+	l.releaseSeckill(ctx, m, !errors.Is(err, model.ErrStockNotEnough))
+
+	// 告知用户订单未能创建
+	l.notify.Notify(ctx, NotifyEvent{
+		UserId:   m.order.UserId,
+		Type:     model.NOTIFY_ORDER,
+		TargetId: m.order.Id,
+		Content:  "秒杀订单处理失败",
+	})
 }
 
-func (l *voucherOrderLogic) querySeckillVoucherById(id int64) (model.SecKillVoucher, error) {
-	var result model.SecKillVoucher
-	if err := result.QuerySeckillVoucherById(id); err != nil {
-		return result, fmt.Errorf("db query seckill voucher %d: %w", id, err)
+// releaseSeckill 归还未能创建订单的秒杀在 Redis 中扣减的库存与购买计数，同一订单只归还一次
+func (l *voucherOrderLogic) releaseSeckill(ctx context.Context, m seckillMessage, restock bool) {
+	id := strconv.FormatInt(m.order.VoucherId, 10)
+	keys := []string{
+		redisx.SECKILL_RELEASED_KEY + strconv.FormatInt(m.order.Id, 10),
+		redisx.SECKILL_STOCK_KEY + id,
+		redisx.SECKILL_COUNT_KEY + id,
+		redisx.SECKILL_ORDER_KEY + id,
+	}
+	if m.day != "" {
+		keys = append(keys,
+			redisx.SECKILL_COUNT_KEY+id+":"+m.day,
+			redisx.SECKILL_SHOP_COUNT_KEY+strconv.FormatInt(m.shopId, 10))
+	}
+	restockArg := 0
+	if restock {
+		restockArg = 1
+	}
+	err := script.SeckillRelease.Run(ctx, l.redis, keys,
+		m.order.UserId, int64(seckillReleaseTTL/time.Second), restockArg).Err()
+	if err != nil {
+		logrus.Errorf("release seckill voucher=%d order=%d failed: %v", m.order.VoucherId, m.order.Id, err)
 	}
-	return result, nil
 }
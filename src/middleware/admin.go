@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"local-review-go/src/config"
+	"local-review-go/src/httpx"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// adminIds 管理员用户 id 白名单，从环境变量 ADMIN_USER_IDS 读取，逗号分隔；未配置时没有管理员
+var adminIds = parseAdminIds(config.GetEnv("ADMIN_USER_IDS", ""))
+
+func parseAdminIds(raw string) map[int64]struct{} {
+	ids := make(map[int64]struct{})
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			logrus.Warnf("skip invalid admin user id %q", field)
+			continue
+		}
+		ids[id] = struct{}{}
+	}
+	return ids
+}
+
+// AdminRequired 只允许白名单中的用户访问，需放在 AuthRequired 之后
+func AdminRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := GetUserInfo(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, httpx.Fail[string]("请先登录"))
+			c.Abort()
+			return
+		}
+		if _, ok := adminIds[user.Id]; !ok {
+			c.JSON(http.StatusForbidden, httpx.Fail[string]("无权执行该操作"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import "testing"
+
+func TestParseAdminIds(t *testing.T) {
+	ids := parseAdminIds(" 1, 2,,x,3 ")
+	for _, id := range []int64{1, 2, 3} {
+		if _, ok := ids[id]; !ok {
+			t.Fatalf("admin id %d missing from %v", id, ids)
+		}
+	}
+	if len(ids) != 3 {
+		t.Fatalf("expected 3 admin ids, got %v", ids)
+	}
+	if len(parseAdminIds("")) != 0 {
+		t.Fatal("expected no admin ids when unset")
+	}
+}
@@ -1,39 +1,49 @@
 package model
 
 import (
+	"context"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 	"local-review-go/src/config/mysql"
 	"local-review-go/src/utils/redisx"
+	"math"
 	"strings"
 	"time"
 )
 
 const BLOG_TABLE_NAME = "tb_blog"
 
+const (
+	BLOG_SORT_HOT = "hot" // 按热度，与热榜的热度公式一致
+	BLOG_SORT_NEW = "new" // 按发布时间
+)
+
 type Blog struct {
-	Id         int64     `gorm:"primary_key;AUTO_INCREMENT;column:id" json:"id"`
-	ShopId     int64     `gorm:"column:shop_id" json:"shopId"`
-	UserId     int64     `gorm:"column:user_id" json:"userId"`
-	Icon       string    `gorm:"-" json:"icon"`
-	Name       string    `gorm:"-" json:"name"`
-	IsLike     bool      `gorm:"-" json:"isLike"`
-	Title      string    `gorm:"column:title" json:"title"`
-	Images     string    `gorm:"column:images" json:"images"`
-	Content    string    `gorm:"column:content" json:"content"`
-	Liked      int       `gorm:"column:liked" json:"liked"`
-	Comments   int       `gorm:"column:comments" json:"comments"`
-	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
-	UpdateTime time.Time `gorm:"column:update_time" json:"updateTime"`
+	Id         int64      `gorm:"primary_key;AUTO_INCREMENT;column:id" json:"id"`
+	ShopId     int64      `gorm:"column:shop_id" json:"shopId"`
+	UserId     int64      `gorm:"column:user_id" json:"userId"`
+	Icon       string     `gorm:"-" json:"icon"`
+	Name       string     `gorm:"-" json:"name"`
+	IsLike     bool       `gorm:"-" json:"isLike"`
+	Shop       *ShopBrief `gorm:"-" json:"shop,omitempty"`
+	Title      string     `gorm:"column:title" json:"title"`
+	Images     string     `gorm:"column:images" json:"images"`
+	Content    string     `gorm:"column:content" json:"content"`
+	Liked      int        `gorm:"column:liked" json:"liked"`
+	Comments   int        `gorm:"column:comments" json:"comments"`
+	CreateTime time.Time  `gorm:"column:create_time" json:"createTime"`
+	UpdateTime time.Time  `gorm:"column:update_time" json:"updateTime"`
+	// 软删除标记，保留期内可恢复，普通查询自动过滤
+	DeleteTime gorm.DeletedAt `gorm:"column:delete_time;index" json:"-"`
 }
 
 func (*Blog) TableName() string {
 	return BLOG_TABLE_NAME
 }
 
-func (blog *Blog) SaveBlog() (id int64, err error) {
-	err = mysql.GetMysqlDB().Table(blog.TableName()).Create(blog).Error
+func (blog *Blog) SaveBlog(tx *gorm.DB) (id int64, err error) {
+	err = tx.Table(blog.TableName()).Create(blog).Error
 	if err != nil {
 		logrus.Error("[Blog model] insert data into database failed")
 		return id, err
@@ -48,25 +58,78 @@ func (blog *Blog) QueryBlogs(current int) ([]Blog, error) {
 	return blogs, err
 }
 
-func (blog *Blog) QueryHots(current int) ([]Blog, error) {
+// QueryBlogsOfShop 按 order 分页查询店铺关联的博客，order 由调用方根据排序方式给出
+func (blog *Blog) QueryBlogsOfShop(shopId int64, order string, current int) ([]Blog, error) {
 	var blogs []Blog
-	err := mysql.GetMysqlDB().Order("liked desc").Offset((current - 1) * redisx.MAXPAGESIZE).Limit(redisx.MAXPAGESIZE).Find(&blogs).Error
+	err := mysql.GetMysqlDB().Table(blog.TableName()).
+		Where("shop_id = ?", shopId).
+		Order(order).
+		Offset((current - 1) * redisx.MAXPAGESIZE).
+		Limit(redisx.MAXPAGESIZE).
+		Find(&blogs).Error
 	return blogs, err
 }
 
+// QueryHotsByScore 按热度表达式 scoreExpr 倒序分页查询 since 之后发布的博客
+// 只返回热度不超过 maxScore 的博客，并跳过其中前 offset 条，同时返回每条博客的热度
+func (blog *Blog) QueryHotsByScore(scoreExpr string, since time.Time, maxScore float64, offset, limit int) ([]Blog, []float64, error) {
+	var rows []struct {
+		Blog     `gorm:"embedded"`
+		HotScore float64 `gorm:"column:hot_score"`
+	}
+	db := mysql.GetMysqlDB().Model(&Blog{}).
+		Select("*, "+scoreExpr+" AS hot_score").
+		Where("create_time >= ?", since)
+	if !math.IsInf(maxScore, 1) {
+		db = db.Where(scoreExpr+" <= ?", maxScore)
+	}
+	err := db.Order("hot_score desc, id desc").Offset(offset).Limit(limit).Find(&rows).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blogs := make([]Blog, len(rows))
+	scores := make([]float64, len(rows))
+	for i := range rows {
+		blogs[i] = rows[i].Blog
+		scores[i] = rows[i].HotScore
+	}
+	return blogs, scores, nil
+}
+
 func (blog *Blog) GetBlogById(id int64) error {
 	err := mysql.GetMysqlDB().Where("id = ?", id).First(blog).Error
 	return err
 }
 
-func (blog *Blog) DecrLike() error {
-	err := mysql.GetMysqlDB().Table(blog.TableName()).Where("id = ?", blog.Id).Update("liked", gorm.Expr("liked - ?", 1)).Error
-	return err
+// ApplyLikeDeltas 在一个事务内批量累加点赞增量，fencing token 过期时整批回滚
+func (blog *Blog) ApplyLikeDeltas(fence Fence, deltas map[int64]int64) error {
+	return mysql.GetMysqlDB().Transaction(func(tx *gorm.DB) error {
+		if err := fence.Check(tx); err != nil {
+			return err
+		}
+		for id, delta := range deltas {
+			if delta == 0 {
+				continue
+			}
+			err := tx.Table(blog.TableName()).Where("id = ?", id).
+				Update("liked", gorm.Expr("GREATEST(liked + ?, 0)", delta)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (blog *Blog) IncrLike() error {
-	err := mysql.GetMysqlDB().Table(blog.TableName()).Where("id = ?", blog.Id).Update("liked", gorm.Expr("liked + ?", 1)).Error
-	return err
+// SetLiked 用 Redis 中的点赞集合校准点赞数，与 ApplyLikeDeltas 一样在事务内校验 fencing token
+func (blog *Blog) SetLiked(ctx context.Context, fence Fence, liked int64) error {
+	return mysql.GetMysqlDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := fence.Check(tx); err != nil {
+			return err
+		}
+		return tx.Table(blog.TableName()).Where("id = ?", blog.Id).Update("liked", liked).Error
+	})
 }
 
 func (blog *Blog) QueryBlogByIds(ids []int64) ([]Blog, error) {
@@ -80,3 +143,139 @@ func (blog *Blog) QueryBlogByIds(ids []int64) ([]Blog, error) {
 	err := mysql.GetMysqlDB().Where("id IN ?", ids).Order(fmt.Sprintf("FIELD(id , %s)", idsJoined)).Find(&blogs).Error
 	return blogs, err
 }
+
+func (blog *Blog) UpdateBlog(tx *gorm.DB) error {
+	return tx.Table(blog.TableName()).Where("id = ?", blog.Id).Updates(map[string]interface{}{
+		"shop_id":     blog.ShopId,
+		"title":       blog.Title,
+		"images":      blog.Images,
+		"content":     blog.Content,
+		"update_time": blog.UpdateTime,
+	}).Error
+}
+
+// DeleteBlog 软删除，仅设置 delete_time
+func (blog *Blog) DeleteBlog(tx *gorm.DB) error {
+	return tx.Where("id = ?", blog.Id).Delete(&Blog{}).Error
+}
+
+// GetDeletedBlogById 查询已软删除的博客
+func (blog *Blog) GetDeletedBlogById(tx *gorm.DB, id int64) error {
+	return tx.Unscoped().Where("id = ? AND delete_time IS NOT NULL", id).First(blog).Error
+}
+
+func (blog *Blog) RestoreBlog(tx *gorm.DB) error {
+	return tx.Unscoped().Model(&Blog{}).Where("id = ?", blog.Id).Update("delete_time", nil).Error
+}
+
+// QueryDeletedBlogs 查询用户在保留期内删除的博客
+func (blog *Blog) QueryDeletedBlogs(userId int64, since time.Time) ([]Blog, error) {
+	var blogs []Blog
+	err := mysql.GetMysqlDB().Unscoped().
+		Where("user_id = ? AND delete_time IS NOT NULL AND delete_time >= ?", userId, since).
+		Order("delete_time desc").
+		Limit(redisx.MAXPAGESIZE).
+		Find(&blogs).Error
+	return blogs, err
+}
+
+// QueryExpiredDeletedBlogs 查询超过保留期的已删除博客
+func (blog *Blog) QueryExpiredDeletedBlogs(before time.Time, limit int) ([]Blog, error) {
+	var blogs []Blog
+	err := mysql.GetMysqlDB().Unscoped().
+		Where("delete_time IS NOT NULL AND delete_time < ?", before).
+		Order("id asc").
+		Limit(limit).
+		Find(&blogs).Error
+	return blogs, err
+}
+
+// PurgeBlog 物理删除博客
+func (blog *Blog) PurgeBlog(tx *gorm.DB) error {
+	return tx.Unscoped().Where("id = ?", blog.Id).Delete(&Blog{}).Error
+}
+
+func (blog *Blog) IncrComments(tx *gorm.DB, delta int) error {
+	return tx.Table(blog.TableName()).Where("id = ?", blog.Id).Update("comments", gorm.Expr("comments + ?", delta)).Error
+}
+
+// QueryBlogsSince 按 id 游标分页查询某时间之后发布的博客
+func (blog *Blog) QueryBlogsSince(since time.Time, lastId int64, limit int) ([]Blog, error) {
+	var blogs []Blog
+	err := mysql.GetMysqlDB().
+		Select("id", "liked", "comments", "create_time").
+		Where("create_time >= ? AND id > ?", since, lastId).
+		Order("id asc").
+		Limit(limit).
+		Find(&blogs).Error
+	return blogs, err
+}
+
+// QueryLatestBlogsOfUser 查询用户最近发布的博客，只取 feed 需要的字段
+func (blog *Blog) QueryLatestBlogsOfUser(userId int64, limit int) ([]Blog, error) {
+	var blogs []Blog
+	err := mysql.GetMysqlDB().
+		Select("id", "user_id", "create_time").
+		Where("user_id = ?", userId).
+		Order("id desc").
+		Limit(limit).
+		Find(&blogs).Error
+	return blogs, err
+}
+
+// QueryBlogIdsOfUser 从给定 id 中筛选出属于该用户的博客 id（含已删除的）
+func (blog *Blog) QueryBlogIdsOfUser(userId int64, ids []int64) ([]int64, error) {
+	var result []int64
+	err := mysql.GetMysqlDB().Unscoped().Model(&Blog{}).
+		Where("user_id = ? AND id IN ?", userId, ids).
+		Pluck("id", &result).Error
+	return result, err
+}
+
+// BlogEngagement 用户发布的博客数与获得的点赞、评论总数
+type BlogEngagement struct {
+	UserId   int64
+	Blogs    int
+	Liked    int
+	Comments int
+}
+
+// QueryEngagementByUsers 统计用户未删除博客的互动数据
+func (blog *Blog) QueryEngagementByUsers(userIds []int64) (map[int64]BlogEngagement, error) {
+	var rows []BlogEngagement
+	err := mysql.GetMysqlDB().Table(blog.TableName()).
+		Select("user_id, COUNT(*) AS blogs, COALESCE(SUM(liked), 0) AS liked, COALESCE(SUM(comments), 0) AS comments").
+		Where("user_id IN ? AND delete_time IS NULL", userIds).
+		Group("user_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int64]BlogEngagement, len(rows))
+	for _, row := range rows {
+		result[row.UserId] = row
+	}
+	return result, nil
+}
+
+// QueryBlogIdsAfter 按 id 游标分批查询未删除的博客 id，用于重建博客布隆过滤器
+func (blog *Blog) QueryBlogIdsAfter(lastId int64, limit int) ([]int64, error) {
+	var ids []int64
+	err := mysql.GetMysqlDB().Model(blog).
+		Where("id > ?", lastId).
+		Order("id asc").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// QueryLikedBlogIdsAfter 按 id 游标分批查询点赞数大于 0 的博客 id，用于校准点赞数
+func (blog *Blog) QueryLikedBlogIdsAfter(lastId int64, limit int) ([]int64, error) {
+	var ids []int64
+	err := mysql.GetMysqlDB().Model(blog).
+		Where("id > ? AND liked > 0", lastId).
+		Order("id asc").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
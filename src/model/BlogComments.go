@@ -1,6 +1,12 @@
 package model
 
-import "time"
+import (
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/utils/redisx"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 const (
 	NORMAL     = 0 // 正常
@@ -17,6 +23,31 @@ type BlogComments struct {
 	Content    string    `gorm:"column:content" json:"content"`
 	Liked      int       `gorm:"column:liked" json:"liked"`
 	Status     int       `gorm:"column:status" json:"status"`
+	Icon       string    `gorm:"-" json:"icon"`
+	Name       string    `gorm:"-" json:"name"`
 	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
 	UpdateTime time.Time `gorm:"column:update_time" json:"updateTime"`
 }
+
+func (c *BlogComments) DeleteCommentsOfBlog(tx *gorm.DB, blogId int64) error {
+	return tx.Where("blog_id = ?", blogId).Delete(&BlogComments{}).Error
+}
+
+func (c *BlogComments) SaveComment(tx *gorm.DB) error {
+	return tx.Create(c).Error
+}
+
+func (c *BlogComments) GetCommentById(id int64) error {
+	return mysql.GetMysqlDB().Where("id = ?", id).First(c).Error
+}
+
+func (c *BlogComments) QueryCommentsOfBlog(blogId int64, current int) ([]BlogComments, error) {
+	var comments []BlogComments
+	err := mysql.GetMysqlDB().
+		Where("blog_id = ? AND status = ?", blogId, NORMAL).
+		Order("id asc").
+		Offset((current - 1) * redisx.MAXPAGESIZE).
+		Limit(redisx.MAXPAGESIZE).
+		Find(&comments).Error
+	return comments, err
+}
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"errors"
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/utils/redisx"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	CREDIT_TXN_TABLE_NAME   = "tb_credit_txn"
+	CREDIT_ENTRY_TABLE_NAME = "tb_credit_entry"
+)
+
+// 积分业务类型
+const (
+	CREDIT_BIZ_SIGN    = "sign"
+	CREDIT_BIZ_REVIEW  = "review"
+	CREDIT_BIZ_BLOG    = "blog"
+	CREDIT_BIZ_VOUCHER = "voucher"
+)
+
+// 积分账户，用户账户为 user，系统侧的发放与回收各记一个账户
+const (
+	CREDIT_ACCOUNT_USER   = "user"
+	CREDIT_ACCOUNT_REWARD = "system:reward"  // 发放积分的来源
+	CREDIT_ACCOUNT_SPEND  = "system:consume" // 消费积分的去向
+)
+
+var ErrCreditsNotEnough = errors.New("积分不足")
+
+// CreditTxn 一笔积分业务，BizKey 全局唯一，同一事件重复记账只生效一次
+type CreditTxn struct {
+	Id         int64     `gorm:"primary_key;AUTO_INCREMENT;column:id" json:"id"`
+	BizKey     string    `gorm:"column:biz_key;size:64;uniqueIndex:uk_biz_key" json:"bizKey"`
+	BizType    string    `gorm:"column:biz_type;size:16" json:"bizType"`
+	UserId     int64     `gorm:"column:user_id;index:idx_user" json:"userId"`
+	Amount     int       `gorm:"column:amount" json:"amount"` // 正数为获得，负数为消费
+	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
+}
+
+func (*CreditTxn) TableName() string {
+	return CREDIT_TXN_TABLE_NAME
+}
+
+// CreateIfAbsent 按 BizKey 幂等写入，已存在时返回 false 并把已有记录读入 t
+func (t *CreditTxn) CreateIfAbsent(tx *gorm.DB) (bool, error) {
+	result := tx.Table(t.TableName()).Clauses(clause.OnConflict{DoNothing: true}).Create(t)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+	return false, tx.Table(t.TableName()).Where("biz_key = ?", t.BizKey).First(t).Error
+}
+
+// CreditEntry 复式记账分录，每笔业务借贷两条分录金额之和为 0
+// Balance 为记账后该账户的余额快照，系统账户不维护余额
+type CreditEntry struct {
+	Id         int64     `gorm:"primary_key;AUTO_INCREMENT;column:id" json:"id"`
+	TxnId      int64     `gorm:"column:txn_id;index:idx_txn" json:"txnId"`
+	Account    string    `gorm:"column:account;size:32" json:"account"`
+	UserId     int64     `gorm:"column:user_id;index:idx_user_account" json:"userId"`
+	BizType    string    `gorm:"column:biz_type;size:16" json:"bizType"`
+	Amount     int       `gorm:"column:amount" json:"amount"`
+	Balance    int       `gorm:"column:balance" json:"balance"`
+	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
+}
+
+func (*CreditEntry) TableName() string {
+	return CREDIT_ENTRY_TABLE_NAME
+}
+
+func (e *CreditEntry) CreateEntries(tx *gorm.DB, entries []CreditEntry) error {
+	return tx.Table(e.TableName()).Create(&entries).Error
+}
+
+// QueryUserEntries 分页查询用户账户的积分流水
+func (e *CreditEntry) QueryUserEntries(userId int64, current int) ([]CreditEntry, int64, error) {
+	db := mysql.GetMysqlDB().Table(e.TableName()).
+		Where("user_id = ? AND account = ?", userId, CREDIT_ACCOUNT_USER)
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var entries []CreditEntry
+	err := db.Order("id desc").
+		Offset((current - 1) * redisx.MAXPAGESIZE).
+		Limit(redisx.MAXPAGESIZE).
+		Find(&entries).Error
+	return entries, total, err
+}
+
+// SumEarnedByUsers 统计用户累计获得的积分（不扣除消费）
+func (t *CreditTxn) SumEarnedByUsers(userIds []int64) (map[int64]int, error) {
+	var rows []struct {
+		UserId int64
+		Total  int
+	}
+	err := mysql.GetMysqlDB().Table(t.TableName()).
+		Select("user_id, SUM(amount) AS total").
+		Where("user_id IN ? AND amount > 0", userIds).
+		Group("user_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int64]int, len(rows))
+	for _, row := range rows {
+		result[row.UserId] = row.Total
+	}
+	return result, nil
+}
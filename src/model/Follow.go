@@ -37,3 +37,21 @@ func (f *Follow) GetFollowsByFollowId(id int64) ([]Follow, error) {
 	err := mysql.GetMysqlDB().Table(f.TableName()).Where("follow_user_id = ?", id).Find(&follows).Error
 	return follows, err
 }
+
+// CountFollowers 统计用户的粉丝数
+func (f *Follow) CountFollowers(id int64) (int64, error) {
+	var count int64
+	err := mysql.GetMysqlDB().Table(f.TableName()).Where("follow_user_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+// QueryFollowersAfter 按主键游标分批查询粉丝，避免一次加载大V的全部粉丝
+func (f *Follow) QueryFollowersAfter(id, lastId int64, limit int) ([]Follow, error) {
+	var follows []Follow
+	err := mysql.GetMysqlDB().Table(f.TableName()).
+		Where("follow_user_id = ? AND id > ?", id, lastId).
+		Order("id asc").
+		Limit(limit).
+		Find(&follows).Error
+	return follows, err
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const LOCK_FENCE_TABLE_NAME = "tb_lock_fence"
+
+// ErrStaleFence 写入方的 fencing token 小于存储已见过的值，说明它持有的锁已过期
+var ErrStaleFence = errors.New("分布式锁已失效")
+
+// LockFence 每把分布式锁已见过的最大 fencing token
+type LockFence struct {
+	Name       string    `gorm:"column:name;size:128;primaryKey" json:"name"`
+	Fence      int64     `gorm:"column:fence" json:"fence"`
+	UpdateTime time.Time `gorm:"column:update_time" json:"updateTime"`
+}
+
+func (*LockFence) TableName() string {
+	return LOCK_FENCE_TABLE_NAME
+}
+
+// Fence 持锁写入时携带的 fencing token，Token 为 0 表示不校验
+// Raise 非空时，校验发现 token 落后时用已记录的值提升锁的 token 计数器：
+// 计数器丢失后重新从小值分配的 token 会一直落后，提升后下一次获取锁即可恢复
+type Fence struct {
+	Name  string
+	Token int64
+	Raise func(mark int64)
+}
+
+// Check 在事务中校验并记录 fencing token，行锁保证同一把锁的写入串行，
+// token 小于已记录的值时返回 ErrStaleFence，调用方应回滚事务
+func (f Fence) Check(tx *gorm.DB) error {
+	if f.Token == 0 {
+		return nil
+	}
+	table := new(LockFence).TableName()
+	err := tx.Table(table).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&LockFence{Name: f.Name, UpdateTime: time.Now()}).Error
+	if err != nil {
+		return err
+	}
+
+	var current LockFence
+	err = tx.Table(table).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("name = ?", f.Name).First(&current).Error
+	if err != nil {
+		return err
+	}
+	if f.Token < current.Fence {
+		if f.Raise != nil {
+			f.Raise(current.Fence)
+		}
+		return ErrStaleFence
+	}
+	if f.Token == current.Fence {
+		return nil
+	}
+	return tx.Table(table).Where("name = ?", f.Name).
+		Updates(map[string]interface{}{"fence": f.Token, "update_time": time.Now()}).Error
+}
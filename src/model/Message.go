@@ -0,0 +1,138 @@
+package model
+
+import (
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/utils/redisx"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MESSAGE_TABLE_NAME      = "tb_message"
+	CONVERSATION_TABLE_NAME = "tb_conversation"
+)
+
+// Message 私信，UserLow/UserHigh 为会话双方 id 的较小/较大值，用于按会话查询历史
+type Message struct {
+	Id         int64     `gorm:"primary_key;AUTO_INCREMENT;column:id" json:"id"`
+	UserLow    int64     `gorm:"column:user_low;index:idx_conversation" json:"-"`
+	UserHigh   int64     `gorm:"column:user_high;index:idx_conversation" json:"-"`
+	FromId     int64     `gorm:"column:from_id;index:idx_from" json:"fromId"`
+	ToId       int64     `gorm:"column:to_id;index:idx_to" json:"toId"`
+	Content    string    `gorm:"column:content;size:1024" json:"content"`
+	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
+}
+
+func (*Message) TableName() string {
+	return MESSAGE_TABLE_NAME
+}
+
+// SetPeers 根据收发双方设置会话字段
+func (m *Message) SetPeers(fromId, toId int64) {
+	m.FromId, m.ToId = fromId, toId
+	m.UserLow, m.UserHigh = fromId, toId
+	if m.UserLow > m.UserHigh {
+		m.UserLow, m.UserHigh = m.UserHigh, m.UserLow
+	}
+}
+
+func (m *Message) CreateMessage(tx *gorm.DB) error {
+	return tx.Table(m.TableName()).Create(m).Error
+}
+
+// QueryHistory 倒序查询两人会话中 id 小于 beforeId 的消息，beforeId 为 0 时从最新开始
+func (m *Message) QueryHistory(userId, peerId, beforeId int64, limit int) ([]Message, error) {
+	var probe Message
+	probe.SetPeers(userId, peerId)
+
+	db := mysql.GetMysqlDB().Table(m.TableName()).
+		Where("user_low = ? AND user_high = ?", probe.UserLow, probe.UserHigh)
+	if beforeId > 0 {
+		db = db.Where("id < ?", beforeId)
+	}
+
+	var messages []Message
+	err := db.Order("id desc").Limit(limit).Find(&messages).Error
+	return messages, err
+}
+
+// QueryMessagesAfter 按 id 升序查询用户收发的、id 大于 afterId 的消息，用于增量同步
+func (m *Message) QueryMessagesAfter(userId, afterId int64, limit int) ([]Message, error) {
+	var messages []Message
+	err := mysql.GetMysqlDB().Table(m.TableName()).
+		Where("(from_id = ? OR to_id = ?) AND id > ?", userId, userId, afterId).
+		Order("id asc").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+// Conversation 会话列表，收发双方各一行
+type Conversation struct {
+	Id            int64     `gorm:"primary_key;AUTO_INCREMENT;column:id" json:"id"`
+	UserId        int64     `gorm:"column:user_id;uniqueIndex:uk_user_peer" json:"userId"`
+	PeerId        int64     `gorm:"column:peer_id;uniqueIndex:uk_user_peer" json:"peerId"`
+	LastMessageId int64     `gorm:"column:last_message_id" json:"lastMessageId"`
+	LastContent   string    `gorm:"column:last_content;size:1024" json:"lastContent"`
+	PeerName      string    `gorm:"-" json:"peerName"`
+	PeerIcon      string    `gorm:"-" json:"peerIcon"`
+	Unread        int64     `gorm:"column:unread" json:"unread"` // 来自对方的未读私信数，Redis 中的未读计数据此重建
+	UpdateTime    time.Time `gorm:"column:update_time" json:"updateTime"`
+}
+
+func (*Conversation) TableName() string {
+	return CONVERSATION_TABLE_NAME
+}
+
+// UpsertConversation 新消息到达时更新会话的最后一条消息，并把 c.Unread 累加到未读数
+func (c *Conversation) UpsertConversation(tx *gorm.DB) error {
+	updates := clause.AssignmentColumns([]string{"last_message_id", "last_content", "update_time"})
+	updates = append(updates, clause.Assignment{
+		Column: clause.Column{Name: "unread"},
+		Value:  gorm.Expr("unread + ?", c.Unread),
+	})
+	return tx.Table(c.TableName()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "peer_id"}},
+		DoUpdates: updates,
+	}).Create(c).Error
+}
+
+// ClearUnread 会话标记已读
+func (c *Conversation) ClearUnread(userId, peerId int64) error {
+	return mysql.GetMysqlDB().Table(c.TableName()).
+		Where("user_id = ? AND peer_id = ?", userId, peerId).
+		Update("unread", 0).Error
+}
+
+// QueryUnreadConversations 有未读私信的会话，用于重建 Redis 未读计数
+func (c *Conversation) QueryUnreadConversations(userId int64) ([]Conversation, error) {
+	var conversations []Conversation
+	err := mysql.GetMysqlDB().Table(c.TableName()).
+		Select("peer_id, unread").
+		Where("user_id = ? AND unread > 0", userId).
+		Find(&conversations).Error
+	return conversations, err
+}
+
+func (c *Conversation) QueryConversations(userId int64, current int) ([]Conversation, error) {
+	var conversations []Conversation
+	err := mysql.GetMysqlDB().Table(c.TableName()).
+		Where("user_id = ?", userId).
+		Order("update_time desc, id desc").
+		Offset((current - 1) * redisx.MAXPAGESIZE).
+		Limit(redisx.MAXPAGESIZE).
+		Find(&conversations).Error
+	return conversations, err
+}
+
+// QueryLatestMessageIdBefore 用户收发的、before 之前创建的最新一条消息 id，没有消息时为 0
+func (m *Message) QueryLatestMessageIdBefore(userId int64, before time.Time) (int64, error) {
+	var id int64
+	err := mysql.GetMysqlDB().Table(m.TableName()).
+		Select("COALESCE(MAX(id), 0)").
+		Where("(from_id = ? OR to_id = ?) AND create_time < ?", userId, userId, before).
+		Scan(&id).Error
+	return id, err
+}
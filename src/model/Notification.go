@@ -0,0 +1,152 @@
+package model
+
+import (
+	"fmt"
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/utils/redisx"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const NOTIFICATION_TABLE_NAME = "tb_notification"
+
+// 通知类型
+const (
+	NOTIFY_LIKE    = "like"
+	NOTIFY_COMMENT = "comment"
+	NOTIFY_FOLLOW  = "follow"
+	NOTIFY_ORDER   = "order"
+)
+
+// NotificationTypes 所有通知类型
+var NotificationTypes = []string{NOTIFY_LIKE, NOTIFY_COMMENT, NOTIFY_FOLLOW, NOTIFY_ORDER}
+
+// Notification 站内通知，同一接收者、类型、目标的未读通知会聚合为一条
+// AggKey 为聚合目标，只在可聚合的未读通知上设置、已读后清空，由唯一索引保证同一目标最多一条未读通知
+type Notification struct {
+	Id         int64     `gorm:"primary_key;AUTO_INCREMENT;column:id" json:"id"`
+	UserId     int64     `gorm:"column:user_id;index:idx_user_read" json:"userId"` // 接收者
+	Type       string    `gorm:"column:type;size:16;index:idx_user_read" json:"type"`
+	TargetId   int64     `gorm:"column:target_id;index:idx_user_read" json:"targetId"` // 博客/订单 id，关注为 0
+	IsRead     bool      `gorm:"column:is_read;index:idx_user_read" json:"isRead"`
+	AggKey     *string   `gorm:"column:agg_key;size:64;uniqueIndex:uk_agg_key" json:"-"`
+	ActorId    int64     `gorm:"column:actor_id" json:"actorId"`       // 最近一次触发的用户
+	ActorCount int       `gorm:"column:actor_count" json:"actorCount"` // 聚合的用户数
+	Content    string    `gorm:"column:content" json:"content"`
+	ActorName  string    `gorm:"-" json:"actorName"`
+	ActorIcon  string    `gorm:"-" json:"actorIcon"`
+	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
+	UpdateTime time.Time `gorm:"column:update_time" json:"updateTime"`
+}
+
+func (*Notification) TableName() string {
+	return NOTIFICATION_TABLE_NAME
+}
+
+// NotificationAggKey 可聚合通知的聚合目标
+func NotificationAggKey(userId int64, typ string, targetId int64) string {
+	return fmt.Sprintf("%d:%s:%d", userId, typ, targetId)
+}
+
+// CreateNotification 写入通知，同一聚合目标已有未读通知（唯一索引冲突）时返回 false
+func (n *Notification) CreateNotification(tx *gorm.DB) (bool, error) {
+	result := tx.Table(n.TableName()).Clauses(clause.OnConflict{DoNothing: true}).Create(n)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (n *Notification) GetNotificationById(id int64) error {
+	return mysql.GetMysqlDB().Table(n.TableName()).Where("id = ?", id).First(n).Error
+}
+
+// GetUnreadForUpdate 查询可聚合的未读通知（加行锁）
+func (n *Notification) GetUnreadForUpdate(tx *gorm.DB, userId int64, typ string, targetId int64) error {
+	return tx.Table(n.TableName()).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND type = ? AND target_id = ? AND is_read = ?", userId, typ, targetId, false).
+		Order("id desc").
+		First(n).Error
+}
+
+// Aggregate 将新的触发者合并进已有通知
+func (n *Notification) Aggregate(tx *gorm.DB, actorId int64, newActor bool, content string, now time.Time) error {
+	updates := map[string]interface{}{
+		"actor_id":    actorId,
+		"content":     content,
+		"update_time": now,
+	}
+	if newActor {
+		updates["actor_count"] = gorm.Expr("actor_count + 1")
+	}
+	return tx.Table(n.TableName()).Where("id = ?", n.Id).Updates(updates).Error
+}
+
+// QueryNotifications 分页查询通知，typ 为空时查询全部类型
+func (n *Notification) QueryNotifications(userId int64, typ string, current int) ([]Notification, int64, error) {
+	db := mysql.GetMysqlDB().Table(n.TableName()).Where("user_id = ?", userId)
+	if typ != "" {
+		db = db.Where("type = ?", typ)
+	}
+	// 同一条件先计数再分页查询
+	db = db.Session(&gorm.Session{})
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var notifications []Notification
+	err := db.Order("update_time desc, id desc").
+		Offset((current - 1) * redisx.MAXPAGESIZE).
+		Limit(redisx.MAXPAGESIZE).
+		Find(&notifications).Error
+	return notifications, total, err
+}
+
+// readUpdates 标记已读并释放聚合目标，之后的同类事件生成新的通知
+var readUpdates = map[string]interface{}{
+	"is_read": true,
+	"agg_key": gorm.Expr("NULL"),
+}
+
+// MarkRead 标记单条通知已读，返回是否由未读变为已读
+func (n *Notification) MarkRead(id, userId int64) (bool, error) {
+	res := mysql.GetMysqlDB().Table(n.TableName()).
+		Where("id = ? AND user_id = ? AND is_read = ?", id, userId, false).
+		Updates(readUpdates)
+	return res.RowsAffected > 0, res.Error
+}
+
+// MarkAllRead 标记用户全部（或某类型）通知已读
+func (n *Notification) MarkAllRead(userId int64, typ string) error {
+	db := mysql.GetMysqlDB().Table(n.TableName()).Where("user_id = ? AND is_read = ?", userId, false)
+	if typ != "" {
+		db = db.Where("type = ?", typ)
+	}
+	return db.Updates(readUpdates).Error
+}
+
+// CountUnreadByType 按类型统计未读数，用于重建 Redis 计数
+func (n *Notification) CountUnreadByType(userId int64) (map[string]int64, error) {
+	var rows []struct {
+		Type  string
+		Count int64
+	}
+	err := mysql.GetMysqlDB().Table(n.TableName()).
+		Select("type, COUNT(*) AS count").
+		Where("user_id = ? AND is_read = ?", userId, false).
+		Group("type").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Type] = row.Count
+	}
+	return counts, nil
+}
@@ -13,11 +13,23 @@ const SECKILL_VOUCHER_NAME = "tb_seckill_voucher"
 var (
 	ErrStockNotEnough = errors.New("库存不足")
 	ErrDuplicateOrder = errors.New("请勿重复购买")
+	ErrDailyLimit     = errors.New("已达到今日购买上限")
+	ErrShopLimit      = errors.New("已达到该店铺购买上限")
 )
 
+// 秒杀状态
+const (
+	SECKILL_ACTIVE   = 1 // 进行中
+	SECKILL_PAUSED   = 2 // 已暂停，可恢复
+	SECKILL_CANCELED = 3 // 已取消
+)
+
+var ErrSeckillStatus = errors.New("秒杀状态不允许该操作")
+
 type SecKillVoucher struct {
 	VoucherId  int64     `gorm:"primary;column:voucher_id" json:"voucherId"`
 	Stock      int       `gorm:"column:stock" json:"stock"`
+	Status     int       `gorm:"column:status;not null;default:1" json:"status"`
 	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
 	BeginTime  time.Time `gorm:"column:begin_time" json:"beginTime"`
 	EndTime    time.Time `gorm:"column:end_time" json:"endTime"`
@@ -54,3 +66,64 @@ func (sv *SecKillVoucher) DecrVoucherStock(voucherId int64, tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// AdjustStock 调整库存，调整后库存不能为负
+func (sv *SecKillVoucher) AdjustStock(tx *gorm.DB, voucherId int64, delta int) error {
+	result := tx.Table(sv.TableName()).
+		Where("voucher_id = ? AND stock + ? >= 0", voucherId, delta).
+		Updates(map[string]interface{}{
+			"stock":       gorm.Expr("stock + ?", delta),
+			"update_time": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStockNotEnough
+	}
+	return nil
+}
+
+func (sv *SecKillVoucher) UpdateWindow(tx *gorm.DB, voucherId int64, beginTime, endTime time.Time) error {
+	return tx.Table(sv.TableName()).Where("voucher_id = ?", voucherId).
+		Updates(map[string]interface{}{
+			"begin_time":  beginTime,
+			"end_time":    endTime,
+			"update_time": time.Now(),
+		}).Error
+}
+
+// UpdateStatus 仅当当前状态为 from 之一时更新为 to
+func (sv *SecKillVoucher) UpdateStatus(tx *gorm.DB, voucherId int64, from []int, to int) error {
+	result := tx.Table(sv.TableName()).
+		Where("voucher_id = ? AND status IN ?", voucherId, from).
+		Updates(map[string]interface{}{
+			"status":      to,
+			"update_time": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSeckillStatus
+	}
+	return nil
+}
+
+// QueryOpeningSeckills 查询 before 之前开始、尚未结束的进行中秒杀
+func (sv *SecKillVoucher) QueryOpeningSeckills(before, now time.Time) ([]SecKillVoucher, error) {
+	var vouchers []SecKillVoucher
+	err := mysql.GetMysqlDB().Table(sv.TableName()).
+		Where("status = ? AND begin_time <= ? AND end_time > ?", SECKILL_ACTIVE, before, now).
+		Find(&vouchers).Error
+	return vouchers, err
+}
+
+// QueryClosedSeckills 查询 since 之后结束或被取消的秒杀
+func (sv *SecKillVoucher) QueryClosedSeckills(since, now time.Time) ([]SecKillVoucher, error) {
+	var vouchers []SecKillVoucher
+	err := mysql.GetMysqlDB().Table(sv.TableName()).
+		Where("(end_time > ? AND end_time <= ?) OR (status = ? AND update_time > ?)", since, now, SECKILL_CANCELED, since).
+		Find(&vouchers).Error
+	return vouchers, err
+}
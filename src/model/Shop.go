@@ -25,13 +25,32 @@ type Shop struct {
 	AvgPrice   int64     `gorm:"column:avg_price" json:"avgPrice"`
 	Sold       int       `gorm:"column:sold" json:"sold"`
 	Comments   int       `gorm:"column:comments" json:"comments"`
-	Score      int       `gorm:"column:score" json:"score"`
+	Score      int       `gorm:"column:score" json:"score"`     // 平均星级*10，如 45 表示 4.5 星
+	ScoreTotal int64     `gorm:"column:score_total" json:"-"`   // 评价星级总和
+	Reviews    int       `gorm:"column:reviews" json:"reviews"` // 评价数
 	OpenHours  string    `gorm:"column:open_hours" json:"openHours"`
 	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
 	UpdateTime time.Time `gorm:"column:update_time" json:"updateTime"`
 	Distance   float64   `gorm:"-" json:"distance"`
 }
 
+// ShopBrief 店铺简要信息，嵌入在博客等响应中
+type ShopBrief struct {
+	Id     int64  `json:"id"`
+	Name   string `json:"name"`
+	Images string `json:"images"`
+	Score  int    `json:"score"`
+}
+
+func (shop *Shop) Brief() *ShopBrief {
+	return &ShopBrief{
+		Id:     shop.Id,
+		Name:   shop.Name,
+		Images: shop.Images,
+		Score:  shop.Score,
+	}
+}
+
 func (*Shop) TableName() string {
 	return SHOP_TABLE_NAME
 }
@@ -76,7 +95,8 @@ func (shop *Shop) SaveShop() error {
 }
 
 func (shop *Shop) UpdateShop(tx *gorm.DB) error {
-	err := tx.Model(shop).Save(shop).Error
+	// 评分与评价数由评价流程维护，不允许直接覆盖
+	err := tx.Model(shop).Omit("score", "score_total", "reviews", "comments").Save(shop).Error
 	return err
 }
 
@@ -91,3 +111,35 @@ func (shop *Shop) QueryShopByName(name string, current int) ([]Shop, error) {
 	err := mysql.GetMysqlDB().Table(shop.TableName()).Where("name LIKE ?", name).Offset((current - 1) * redisx.MAXPAGESIZE).Limit(redisx.MAXPAGESIZE).Find(&shops).Error
 	return shops, err
 }
+
+// ApplyReviewDelta 增量更新店铺评分与评价数
+// MySQL 的 SET 子句从左到右求值，score 使用的是已更新后的 score_total/reviews
+func (*Shop) ApplyReviewDelta(tx *gorm.DB, shopId int64, reviewDelta int, scoreDelta int, commentDelta int) error {
+	result := tx.Exec(`
+		UPDATE tb_shop
+		SET reviews = reviews + ?,
+			score_total = score_total + ?,
+			comments = comments + ?,
+			score = IF(reviews > 0, ROUND(score_total * 10 / reviews), 0),
+			update_time = ?
+		WHERE id = ?
+	`, reviewDelta, scoreDelta, commentDelta, time.Now(), shopId)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// QueryShopIdsAfter 按 id 游标分批查询店铺 id，用于重建布隆过滤器
+func (shop *Shop) QueryShopIdsAfter(lastId int64, limit int) ([]int64, error) {
+	var ids []int64
+	err := mysql.GetMysqlDB().Table(shop.TableName()).
+		Where("id > ?", lastId).
+		Order("id asc").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"errors"
+	"local-review-go/src/config/mysql"
+	"local-review-go/src/utils/redisx"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const SHOP_REVIEW_TABLE_NAME = "tb_shop_review"
+
+const (
+	REVIEW_SORT_NEW     = "new"     // 最新
+	REVIEW_SORT_HELPFUL = "helpful" // 最有用
+)
+
+var (
+	ErrDuplicateReview = errors.New("已评价过该店铺")
+	ErrInvalidScore    = errors.New("评分必须在1到5之间")
+)
+
+type ShopReview struct {
+	Id         int64     `gorm:"primary_key;AUTO_INCREMENT;column:id" json:"id"`
+	ShopId     int64     `gorm:"column:shop_id;uniqueIndex:uk_shop_user" json:"shopId"`
+	UserId     int64     `gorm:"column:user_id;uniqueIndex:uk_shop_user" json:"userId"`
+	OrderId    int64     `gorm:"column:order_id" json:"orderId"`
+	Score      int       `gorm:"column:score" json:"score"` // 1-5 星
+	Content    string    `gorm:"column:content" json:"content"`
+	Images     string    `gorm:"column:images" json:"images"`
+	Verified   bool      `gorm:"column:verified" json:"verified"` // 关联已核销订单的真实消费评价
+	Helpful    int       `gorm:"column:helpful" json:"helpful"`
+	Icon       string    `gorm:"-" json:"icon"`
+	Name       string    `gorm:"-" json:"name"`
+	IsHelpful  bool      `gorm:"-" json:"isHelpful"`
+	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
+	UpdateTime time.Time `gorm:"column:update_time" json:"updateTime"`
+}
+
+func (*ShopReview) TableName() string {
+	return SHOP_REVIEW_TABLE_NAME
+}
+
+// CreateShopReview 写入评价，同一用户对同一店铺已有评价（唯一索引冲突）时返回 ErrDuplicateReview
+func (r *ShopReview) CreateShopReview(tx *gorm.DB) error {
+	result := tx.Table(r.TableName()).Clauses(clause.OnConflict{DoNothing: true}).Create(r)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDuplicateReview
+	}
+	return nil
+}
+
+func (r *ShopReview) UpdateShopReview(tx *gorm.DB) error {
+	return tx.Table(r.TableName()).Where("id = ?", r.Id).Updates(map[string]interface{}{
+		"order_id":    r.OrderId,
+		"score":       r.Score,
+		"content":     r.Content,
+		"images":      r.Images,
+		"verified":    r.Verified,
+		"update_time": r.UpdateTime,
+	}).Error
+}
+
+func (r *ShopReview) GetShopReviewById(id int64) error {
+	return mysql.GetMysqlDB().Table(r.TableName()).Where("id = ?", id).First(r).Error
+}
+
+// GetUserReviewOfShop 查询用户对某店铺的评价（加行锁，用于事务内编辑）
+func (r *ShopReview) GetUserReviewOfShop(tx *gorm.DB, shopId, userId int64) error {
+	return tx.Table(r.TableName()).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("shop_id = ? AND user_id = ?", shopId, userId).
+		First(r).Error
+}
+
+func (r *ShopReview) QueryReviewsOfShop(shopId int64, sortBy string, current int) ([]ShopReview, error) {
+	order := "id desc"
+	if sortBy == REVIEW_SORT_HELPFUL {
+		order = "helpful desc, id desc"
+	}
+
+	var reviews []ShopReview
+	err := mysql.GetMysqlDB().Table(r.TableName()).
+		Where("shop_id = ?", shopId).
+		Order(order).
+		Offset((current - 1) * redisx.MAXPAGESIZE).
+		Limit(redisx.MAXPAGESIZE).
+		Find(&reviews).Error
+	return reviews, err
+}
+
+func (r *ShopReview) CountReviewsOfShop(shopId int64) (int64, error) {
+	var count int64
+	err := mysql.GetMysqlDB().Table(r.TableName()).Where("shop_id = ?", shopId).Count(&count).Error
+	return count, err
+}
+
+func (r *ShopReview) IncrHelpful(delta int) error {
+	return mysql.GetMysqlDB().Table(r.TableName()).Where("id = ?", r.Id).Update("helpful", gorm.Expr("helpful + ?", delta)).Error
+}
@@ -47,3 +47,14 @@ func (user *User) GetUsersByIds(ids []int64) ([]User, error) {
 
 	return users, err
 }
+
+// QueryUserIdsAfter 按 id 游标分批查询用户 id，用于重建用户布隆过滤器
+func (user *User) QueryUserIdsAfter(lastId int64, limit int) ([]int64, error) {
+	var ids []int64
+	err := mysql.GetMysqlDB().Model(user).
+		Where("id > ?", lastId).
+		Order("id asc").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
@@ -1,9 +1,10 @@
 package model
 
 import (
-	_ "gorm.io/gorm"
 	"local-review-go/src/config/mysql"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 const USERINFO_TABLE_NAME = "tb_user_info"
@@ -17,7 +18,8 @@ type UserInfo struct {
 	Gender     bool      `gorm:"column:gender" json:"gender"`
 	Birthday   time.Time `gorm:"column:birthday" json:"birthday"`
 	Credits    int       `gorm:"column:credits" json:"credits"`
-	Level      bool      `gorm:"column:level" json:"level"`
+	Level      int       `gorm:"column:level;type:int;not null;default:0" json:"level"` // 由 bool 迁移为等级，原 true 对应 1
+	Tier       string    `gorm:"-" json:"tier"`
 	CreateTime time.Time `gorm:"column:create_time" json:"createTime"`
 	UpdateTime time.Time `gorm:"column:update_time" json:"updateTime"`
 }
@@ -31,3 +33,69 @@ func (u *UserInfo) GetUserInfoById(id int64) (UserInfo, error) {
 	err := mysql.GetMysqlDB().Table(u.TableName()).Where("user_id = ?", id).First(&userInfo).Error
 	return userInfo, err
 }
+
+// AddCredits 增加用户积分，用户信息不存在时创建
+func (u *UserInfo) AddCredits(tx *gorm.DB, userId int64, delta int) error {
+	now := time.Now()
+	result := tx.Table(u.TableName()).Where("user_id = ?", userId).
+		Updates(map[string]interface{}{
+			"credits":     gorm.Expr("credits + ?", delta),
+			"update_time": now,
+		})
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+	return tx.Table(u.TableName()).Omit("birthday").Create(&UserInfo{
+		UserId:     userId,
+		Credits:    delta,
+		CreateTime: now,
+		UpdateTime: now,
+	}).Error
+}
+
+// DeductCredits 扣减用户积分，余额不足时返回 ErrCreditsNotEnough
+func (u *UserInfo) DeductCredits(tx *gorm.DB, userId int64, amount int) error {
+	result := tx.Table(u.TableName()).Where("user_id = ? AND credits >= ?", userId, amount).
+		Updates(map[string]interface{}{
+			"credits":     gorm.Expr("credits - ?", amount),
+			"update_time": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCreditsNotEnough
+	}
+	return nil
+}
+
+// GetCredits 查询用户积分余额，在事务中更新余额后调用可读到最新值
+func (u *UserInfo) GetCredits(tx *gorm.DB, userId int64) (int, error) {
+	var credits int
+	err := tx.Table(u.TableName()).Select("credits").Where("user_id = ?", userId).Scan(&credits).Error
+	return credits, err
+}
+
+// QueryUserInfosAfter 按 user_id 游标分批查询，用于后台重算等级
+func (u *UserInfo) QueryUserInfosAfter(lastUserId int64, limit int) ([]UserInfo, error) {
+	var infos []UserInfo
+	err := mysql.GetMysqlDB().Table(u.TableName()).
+		Select("user_id", "credits", "level").
+		Where("user_id > ?", lastUserId).
+		Order("user_id asc").
+		Limit(limit).
+		Find(&infos).Error
+	return infos, err
+}
+
+func (u *UserInfo) UpdateLevel(tx *gorm.DB, userId int64, level int) error {
+	return tx.Table(u.TableName()).Where("user_id = ?", userId).
+		Update("level", level).Error
+}
+
+// GetLevel 查询用户等级，没有用户信息时为 0
+func (u *UserInfo) GetLevel(tx *gorm.DB, userId int64) (int, error) {
+	var level int
+	err := tx.Table(u.TableName()).Select("level").Where("user_id = ?", userId).Scan(&level).Error
+	return level, err
+}
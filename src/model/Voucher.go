@@ -11,27 +11,45 @@ import (
 const VOUCHER_TABLE_NAME = "tb_voucher"
 
 type Voucher struct {
-	Id          int64     `gorm:"primary;AUTO_INCREMENT;column:id" json:"id"`
-	ShopId      int64     `gorm:"column:shop_id" json:"shopId"`
-	Title       string    `gorm:"column:title" json:"title"`
-	SubTitlte   string    `gorm:"column:sub_title" json:"subTitle"`
-	Rules       string    `gorm:"column:rules" json:"rules"`
-	PayValue    int64     `gorm:"column:pay_value" json:"payValue"`
-	ActualValue int64     `gorm:"column:actual_value" json:"actualValue"`
-	Type        int       `gorm:"column:type" json:"type"`
-	Status      int       `gorm:"column:status" json:"status"`
-	Stock       int       `gorm:"-" json:"stock"`
-	BeginTime   time.Time `gorm:"-" json:"beginTime"`
-	EndTime     time.Time `gorm:"-" json:"endTime"`
-	CreateTime  time.Time `gorm:"column:create_time" json:"createTime"`
-	UpdateTime  time.Time `gorm:"column:update_time" json:"updateTime"`
+	Id          int64  `gorm:"primary;AUTO_INCREMENT;column:id" json:"id"`
+	ShopId      int64  `gorm:"column:shop_id" json:"shopId"`
+	Title       string `gorm:"column:title" json:"title"`
+	SubTitlte   string `gorm:"column:sub_title" json:"subTitle"`
+	Rules       string `gorm:"column:rules" json:"rules"`
+	PayValue    int64  `gorm:"column:pay_value" json:"payValue"`
+	ActualValue int64  `gorm:"column:actual_value" json:"actualValue"`
+	Credits     int    `gorm:"column:credits" json:"credits"`    // 积分兑换价格，0 表示不支持积分兑换
+	MinLevel    int    `gorm:"column:min_level" json:"minLevel"` // 领取所需的最低用户等级
+	// 购买限制，小于等于 0 表示不限制；每人限购未填写时默认 1 张
+	LimitPerUser *int      `gorm:"column:limit_per_user;not null" json:"limitPerUser"`
+	LimitPerDay  int       `gorm:"column:limit_per_day;not null;default:0" json:"limitPerDay"`   // 每人每天
+	LimitPerShop int       `gorm:"column:limit_per_shop;not null;default:0" json:"limitPerShop"` // 每人在该店铺所有优惠券合计
+	Type         int       `gorm:"column:type" json:"type"`
+	Status       int       `gorm:"column:status" json:"status"`
+	Stock        int       `gorm:"-" json:"stock"`
+	BeginTime    time.Time `gorm:"-" json:"beginTime"`
+	EndTime      time.Time `gorm:"-" json:"endTime"`
+	CreateTime   time.Time `gorm:"column:create_time" json:"createTime"`
+	UpdateTime   time.Time `gorm:"column:update_time" json:"updateTime"`
 }
 
 func (*Voucher) TableName() string {
 	return VOUCHER_TABLE_NAME
 }
 
+// PerUserLimit 每人限购数量，小于等于 0 表示不限制
+func (voucher *Voucher) PerUserLimit() int {
+	if voucher.LimitPerUser == nil {
+		return 1
+	}
+	return *voucher.LimitPerUser
+}
+
 func (voucher *Voucher) AddVoucher(tx *gorm.DB) error {
+	if voucher.LimitPerUser == nil {
+		limit := 1
+		voucher.LimitPerUser = &limit
+	}
 	err := tx.Table(voucher.TableName()).Create(voucher).Error
 	return err
 }
@@ -55,3 +73,18 @@ func (voucher *Voucher) QueryVoucherByShop(ctx context.Context, shopId int64) ([
 	}
 	return vouchers, err
 }
+
+func (voucher *Voucher) QueryVoucherById(id int64) error {
+	return mysql.GetMysqlDB().Table(voucher.TableName()).Where("id = ?", id).First(voucher).Error
+}
+
+// QueryVoucherIdsAfter 按 id 游标分批查询优惠券 id，用于重建优惠券布隆过滤器
+func (voucher *Voucher) QueryVoucherIdsAfter(lastId int64, limit int) ([]int64, error) {
+	var ids []int64
+	err := mysql.GetMysqlDB().Model(voucher).
+		Where("id > ?", lastId).
+		Order("id asc").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
@@ -48,10 +48,63 @@ func (vo *VoucherOrder) CreateVoucherOrder(tx *gorm.DB) error {
 	return err
 }
 
-func (vo *VoucherOrder) HasPurchasedVoucher(userId, voucherId int64, tx *gorm.DB) (bool, error) {
+// CountUserOrders 统计用户购买某优惠券的订单数，since、until 非零时只统计 [since, until) 内创建的
+func (vo *VoucherOrder) CountUserOrders(tx *gorm.DB, userId, voucherId int64, since, until time.Time) (int64, error) {
 	var count int64
-	err := tx.Table(vo.TableName()).
-		Where("user_id = ? AND voucher_id = ?", userId, voucherId).
+	db := tx.Table(vo.TableName()).Where("user_id = ? AND voucher_id = ?", userId, voucherId)
+	if !since.IsZero() {
+		db = db.Where("create_time >= ?", since)
+	}
+	if !until.IsZero() {
+		db = db.Where("create_time < ?", until)
+	}
+	err := db.Count(&count).Error
+	return count, err
+}
+
+// CountUserShopOrders 统计用户购买某店铺所有优惠券的订单数
+func (vo *VoucherOrder) CountUserShopOrders(tx *gorm.DB, userId, shopId int64) (int64, error) {
+	var count int64
+	err := tx.Table(vo.TableName()+" AS o").
+		Joins("JOIN "+VOUCHER_TABLE_NAME+" AS v ON v.id = o.voucher_id").
+		Where("o.user_id = ? AND v.shop_id = ?", userId, shopId).
 		Count(&count).Error
+	return count, err
+}
+
+func (vo *VoucherOrder) ExistsVoucherOrder(tx *gorm.DB, id int64) (bool, error) {
+	var count int64
+	err := tx.Table(vo.TableName()).Where("id = ?", id).Count(&count).Error
 	return count > 0, err
 }
+
+func (vo *VoucherOrder) QueryVoucherOrderById(id int64) error {
+	return mysql.GetMysqlDB().Table(vo.TableName()).Where("id = ?", id).First(vo).Error
+}
+
+// CountPaidByUsers 统计用户已支付或已核销的订单数
+func (vo *VoucherOrder) CountPaidByUsers(userIds []int64) (map[int64]int, error) {
+	var rows []struct {
+		UserId int64
+		Total  int
+	}
+	err := mysql.GetMysqlDB().Table(vo.TableName()).
+		Select("user_id, COUNT(*) AS total").
+		Where("user_id IN ? AND status IN ?", userIds, []int{PAYED, USED}).
+		Group("user_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int64]int, len(rows))
+	for _, row := range rows {
+		result[row.UserId] = row.Total
+	}
+	return result, nil
+}
+
+func (vo *VoucherOrder) CountByVoucher(voucherId int64) (int64, error) {
+	var count int64
+	err := mysql.GetMysqlDB().Table(vo.TableName()).Where("voucher_id = ?", voucherId).Count(&count).Error
+	return count, err
+}
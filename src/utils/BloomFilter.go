@@ -3,126 +3,271 @@ package utils
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"math"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	bloomGrowth     = 2               // 每层容量是上一层的倍数
+	bloomTightening = 0.5             // 每层误判率是上一层的倍数，各层误判率之和不超过 p/(1-0.5) = 2p
+	bloomMaxLayers  = 16              // 最多扩容的层数
+	bloomBuildTTL   = 2 * time.Minute // 重建标记的有效期，每批写入后续期，重建进程退出后其他实例可以从检查点继续
+	bloomRetireTTL  = time.Minute     // 重建切换后旧一代保留的时间，让切换前读到旧元数据的请求仍能查到
+	bloomBuildSep   = ":"             // 重建标记的值形如 {代}:{容量}
+	bloomTimeLayout = time.RFC3339    // 元数据中 builtAt 的格式
+	bloomMinFill    = 1 - 1e-9        // 估算元素数时填充率的上限，避免 ln(0)
+	bloomSeedStride = uint32(1 << 16) // 不同层使用不同的哈希种子区间，第 0 层与旧版位图兼容
+)
+
+// ErrBloomRebuilding 已有其他实例在重建同一个布隆过滤器
+var ErrBloomRebuilding = errors.New("bloom filter is rebuilding")
+
+// BloomLoader 从 after 之后按 id 升序分批提供全部元素，每批通过 add 写入
+// 重建中断后从最后一个写入成功的批次继续，after 即该批次的最大 id
+type BloomLoader func(after int64, add func(ids []int64) error) error
+
 // BloomFilter Redis分布式布隆过滤器
-type BloomFilter struct {
-	client *redis.Client // Redis 客户端
-	key    string        // Redis Key
-	m      uint64        // 位数组大小
-	k      uint64        // 哈希函数数量
+// 有 RedisBloom 模块时使用 BF.* 命令（RedisBloomFilter），否则使用位图实现（BitmapBloomFilter）。
+// 两种实现都会在元素数超过容量时扩容，删除通过 Rebuild 重建到新的一代再原子切换实现。
+// 第一次重建（预热）完成前过滤器数据不完整，Contains 与 ContainsBatch 一律返回可能存在。
+type BloomFilter interface {
+	Add(id int64) error
+	AddBatch(ids []int64) error
+	Contains(id int64) (bool, error)
+	// ContainsBatch 一次往返检查多个元素，结果与 ids 一一对应
+	ContainsBatch(ids []int64) ([]bool, error)
+	Stats(ctx context.Context) (BloomStats, error)
+	// Rebuild 把 load 提供的全部元素写入新的一代，完成后原子切换，已删除的元素随旧一代一起淘汰；
+	// 上次重建中断时从检查点继续，同一时间只允许一个重建，否则返回 ErrBloomRebuilding
+	Rebuild(ctx context.Context, load BloomLoader) error
+	DebugInfo() string
 }
 
-// NewBloomFilter 创建新的布隆过滤器
+// NewBloomFilter 创建新的布隆过滤器，Redis 加载了 RedisBloom 模块时使用 BF.* 命令，否则回退到位图实现
 // client: Redis客户端
 // key: Redis键名
-// n: 预期元素数量
+// n: 预期元素数量，超过后自动扩容
 // p: 期望的误判率 (0 < p < 1)
-func NewBloomFilter(client *redis.Client, key string, n uint64, p float64) *BloomFilter {
+func NewBloomFilter(client *redis.Client, key string, n uint64, p float64) BloomFilter {
+	if HasRedisBloom(context.Background(), client) {
+		return NewRedisBloomFilter(client, key, n, p)
+	}
+	return NewBitmapBloomFilter(client, key, n, p)
+}
+
+func checkBloomParams(n uint64, p float64) {
 	if p <= 0 || p >= 1 {
 		panic("false positive rate must be between 0 and 1")
 	}
 	if n == 0 {
 		panic("number of elements must be positive")
 	}
+}
 
-	// 计算最优参数
-	m := optimalM(n, p)
-	k := optimalK(n, m)
+// bloomMeta 布隆过滤器的元数据与重建状态，两种实现共用
+//
+//	{prefix}:meta        hash: gen 当前代、layers 层数、capacity 第 0 层容量、builtAt 重建完成时间
+//	{prefix}:building    string: 正在重建的代与容量，重建期间的写入同时写入新一代；每批写入后续期，进程退出后自动过期
+//	{prefix}:checkpoint  hash: gen、capacity 与已写入的最大 id cursor，重建中断后据此继续
+type bloomMeta struct {
+	gen        int64
+	layers     int
+	capacity   uint64
+	builtAt    time.Time // 为零表示从未完成过重建，数据不完整
+	building   *bloomBuild
+	checkpoint *bloomBuild
+}
 
-	return &BloomFilter{
-		client: client,
-		key:    key,
-		m:      m,
-		k:      k,
-	}
+// ready 是否完成过一次重建
+func (m bloomMeta) ready() bool {
+	return !m.builtAt.IsZero()
 }
 
-// Add 添加元素到布隆过滤器
-func (bf *BloomFilter) Add(id int64) error {
-	ctx := context.Background()
-	pipe := bf.client.Pipeline()
+// bloomBuild 正在重建的一代
+type bloomBuild struct {
+	gen      int64
+	capacity uint64
+	cursor   int64 // 已写入的最大 id
+}
 
-	data := make([]byte, 8)
-	binary.LittleEndian.PutUint64(data, uint64(id))
+func bloomMetaKey(prefix string) string {
+	return prefix + ":meta"
+}
 
-	for i := uint64(0); i < bf.k; i++ {
-		// 计算哈希值
-		hash := hashWithSeed(data, uint32(i))
-		offset := hash % bf.m
-		pipe.SetBit(ctx, bf.key, int64(offset), 1)
-	}
+func bloomBuildingKey(prefix string) string {
+	return prefix + ":building"
+}
 
-	_, err := pipe.Exec(ctx)
-	return err
+func bloomCheckpointKey(prefix string) string {
+	return prefix + ":checkpoint"
 }
 
-// AddBatch 批量添加元素到布隆过滤器（真正的批量操作）
-// 将多个ID的操作合并到一个Pipeline中，减少Redis往返次数
-func (bf *BloomFilter) AddBatch(ids []int64) error {
-	if len(ids) == 0 {
-		return nil
+// readBloomMeta 读取元数据，从未扩容或重建过的过滤器视为第 0 代、一层、容量为 n
+func readBloomMeta(ctx context.Context, client *redis.Client, prefix string, n uint64) (bloomMeta, error) {
+	pipe := client.Pipeline()
+	metaCmd := pipe.HGetAll(ctx, bloomMetaKey(prefix))
+	buildingCmd := pipe.Get(ctx, bloomBuildingKey(prefix))
+	checkpointCmd := pipe.HGetAll(ctx, bloomCheckpointKey(prefix))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return bloomMeta{}, fmt.Errorf("read bloom filter %s meta: %w", prefix, err)
 	}
 
-	ctx := context.Background()
-	pipe := bf.client.Pipeline()
+	fields := metaCmd.Val()
+	var meta bloomMeta
+	meta.gen, _ = strconv.ParseInt(fields["gen"], 10, 64)
+	meta.capacity, _ = strconv.ParseUint(fields["capacity"], 10, 64)
+	if meta.capacity == 0 {
+		meta.capacity = n
+	}
+	meta.layers, _ = strconv.Atoi(fields["layers"])
+	meta.layers = min(max(meta.layers, 1), bloomMaxLayers)
+	meta.builtAt, _ = time.Parse(bloomTimeLayout, fields["builtAt"])
 
-	// 为每个ID计算所有哈希位并添加到Pipeline
-	for _, id := range ids {
-		data := make([]byte, 8)
-		binary.LittleEndian.PutUint64(data, uint64(id))
+	if building, err := buildingCmd.Result(); err == nil {
+		genStr, capStr, _ := strings.Cut(building, bloomBuildSep)
+		buildGen, err1 := strconv.ParseInt(genStr, 10, 64)
+		buildCap, err2 := strconv.ParseUint(capStr, 10, 64)
+		if err1 == nil && err2 == nil && buildGen != meta.gen {
+			meta.building = &bloomBuild{gen: buildGen, capacity: buildCap}
+		}
+	}
 
-		for i := uint64(0); i < bf.k; i++ {
-			hash := hashWithSeed(data, uint32(i))
-			offset := hash % bf.m
-			pipe.SetBit(ctx, bf.key, int64(offset), 1)
+	// 只有紧接当前代的检查点才能继续，其余是已切换或已放弃的重建留下的
+	checkpoint := checkpointCmd.Val()
+	if gen, _ := strconv.ParseInt(checkpoint["gen"], 10, 64); gen == meta.gen+1 {
+		capacity, err1 := strconv.ParseUint(checkpoint["capacity"], 10, 64)
+		cursor, err2 := strconv.ParseInt(checkpoint["cursor"], 10, 64)
+		if err1 == nil && err2 == nil {
+			meta.checkpoint = &bloomBuild{gen: gen, capacity: capacity, cursor: cursor}
 		}
 	}
+	return meta, nil
+}
+
+// nextBloomBuild 决定本次重建的代：有可继续的检查点时沿用，否则新建下一代
+// resumed 为 false 时调用方需先清理并创建新一代的数据，再调用 beginBloomBuild
+func nextBloomBuild(meta bloomMeta, capacity uint64) (build bloomBuild, resumed bool, err error) {
+	if meta.building != nil {
+		return bloomBuild{}, false, ErrBloomRebuilding
+	}
+	if meta.checkpoint != nil {
+		return *meta.checkpoint, true, nil
+	}
+	return bloomBuild{gen: meta.gen + 1, capacity: capacity}, false, nil
+}
 
-	// 一次性执行所有操作
-	_, err := pipe.Exec(ctx)
-	return err
+// beginBloomBuild 登记重建标记与检查点，已有重建进行中时返回 ErrBloomRebuilding
+func beginBloomBuild(ctx context.Context, client *redis.Client, prefix string, build bloomBuild) error {
+	marker := fmt.Sprintf("%d%s%d", build.gen, bloomBuildSep, build.capacity)
+	ok, err := client.SetNX(ctx, bloomBuildingKey(prefix), marker, bloomBuildTTL).Result()
+	if err != nil {
+		return fmt.Errorf("mark bloom filter %s rebuilding: %w", prefix, err)
+	}
+	if !ok {
+		return ErrBloomRebuilding
+	}
+	err = client.HSet(ctx, bloomCheckpointKey(prefix),
+		"gen", build.gen,
+		"capacity", build.capacity,
+		"cursor", build.cursor).Err()
+	if err != nil {
+		return fmt.Errorf("save bloom filter %s checkpoint: %w", prefix, err)
+	}
+	return nil
 }
 
-// Contains 检查元素是否存在
-func (bf *BloomFilter) Contains(id int64) (bool, error) {
-	ctx := context.Background()
-	pipe := bf.client.Pipeline()
+// checkpointBloomBuild 在写入一批元素的 Pipeline 中推进检查点并续期重建标记
+func checkpointBloomBuild(ctx context.Context, pipe redis.Pipeliner, prefix string, build bloomBuild, cursor int64) {
+	pipe.HSet(ctx, bloomCheckpointKey(prefix), "cursor", cursor)
+	pipe.Set(ctx, bloomBuildingKey(prefix), fmt.Sprintf("%d%s%d", build.gen, bloomBuildSep, build.capacity), bloomBuildTTL)
+}
 
-	data := make([]byte, 8)
-	binary.LittleEndian.PutUint64(data, uint64(id))
+// loadBloomBuild 从检查点开始调用 load，write 把一批元素写入新一代的 Pipeline
+func loadBloomBuild(ctx context.Context, client *redis.Client, prefix string, build bloomBuild, load BloomLoader,
+	write func(pipe redis.Pipeliner, ids []int64)) error {
+	return load(build.cursor, func(ids []int64) error {
+		if len(ids) == 0 {
+			return nil
+		}
+		pipe := client.Pipeline()
+		write(pipe, ids)
+		checkpointBloomBuild(ctx, pipe, prefix, build, ids[len(ids)-1])
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+}
 
-	// 收集所有 GETBIT 命令的结果
-	cmds := make([]*redis.IntCmd, bf.k)
+// abortBloomBuild 重建失败时只清除重建标记，已写入的数据与检查点保留，下次重建从检查点继续。
+// 中断期间新建的数据 id 都大于检查点，继续时会被加载
+func abortBloomBuild(client *redis.Client, prefix string) {
+	client.Del(context.Background(), bloomBuildingKey(prefix))
+}
 
-	for i := uint64(0); i < bf.k; i++ {
-		hash := hashWithSeed(data, uint32(i))
-		offset := hash % bf.m
-		cmds[i] = pipe.GetBit(ctx, bf.key, int64(offset))
+// commitBloomBuild 原子切换到新的一代并清除重建标记与检查点；旧一代的 key 延迟过期，
+// 切换前读到旧元数据的请求不会因为数据被删而误判不存在
+func commitBloomBuild(ctx context.Context, client *redis.Client, prefix string, build bloomBuild, retire ...string) error {
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, bloomMetaKey(prefix),
+			"gen", build.gen,
+			"layers", 1,
+			"capacity", build.capacity,
+			"builtAt", time.Now().Format(bloomTimeLayout))
+		pipe.Del(ctx, bloomBuildingKey(prefix), bloomCheckpointKey(prefix))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("switch bloom filter %s to generation %d: %w", prefix, build.gen, err)
 	}
 
-	_, err := pipe.Exec(ctx)
-	if err != nil {
-		return false, err
+	pipe := client.Pipeline()
+	for _, key := range retire {
+		pipe.Expire(ctx, key, bloomRetireTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("retire bloom filter %s generation %d: %w", prefix, build.gen-1, err)
 	}
+	return nil
+}
 
-	// 检查所有位是否都为 1
-	for _, cmd := range cmds {
-		val, err := cmd.Result()
-		if err != nil {
-			return false, err
-		}
-		if val == 0 {
-			return false, nil // 只要有一位是 0，则一定不存在
-		}
+// allPresent 预热完成前的查询结果：全部视为可能存在
+func allPresent(n int) []bool {
+	present := make([]bool, n)
+	for i := range present {
+		present[i] = true
 	}
+	return present
+}
+
+// BloomLayerStats 单层的统计信息
+type BloomLayerStats struct {
+	Capacity          uint64  `json:"capacity"`
+	Bits              uint64  `json:"bits"`
+	Hashes            uint64  `json:"hashes"`
+	Items             uint64  `json:"items"`             // 写入计数
+	FillRatio         float64 `json:"fillRatio"`         // 置 1 的位占比
+	EstimatedItems    float64 `json:"estimatedItems"`    // 按填充率估算的元素数
+	FalsePositiveRate float64 `json:"falsePositiveRate"` // 估算的误判率
+}
 
-	return true, nil // 所有位都是 1，可能存在
+// BloomStats 布隆过滤器的统计信息，用于监控容量与误判率
+type BloomStats struct {
+	Key               string            `json:"key"`
+	Backend           string            `json:"backend"` // bitmap 或 redisbloom
+	Generation        int64             `json:"generation"`
+	BuiltAt           time.Time         `json:"builtAt"`
+	Ready             bool              `json:"ready"` // 是否完成过预热，未完成时查询一律放行
+	Rebuilding        bool              `json:"rebuilding"`
+	Items             uint64            `json:"items"`
+	EstimatedItems    float64           `json:"estimatedItems"`
+	FalsePositiveRate float64           `json:"falsePositiveRate"`
+	Layers            []BloomLayerStats `json:"layers"`
 }
 
 // optimalM 计算最优的位数组大小
@@ -144,8 +289,3 @@ func hashWithSeed(data []byte, seed uint32) uint64 {
 	hasher.Write(data)
 	return hasher.Sum64()
 }
-
-// DebugInfo 获取调试信息
-func (bf *BloomFilter) DebugInfo() string {
-	return fmt.Sprintf("BloomFilter[Key=%s, m=%d, k=%d]", bf.key, bf.m, bf.k)
-}
@@ -2,9 +2,11 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -63,3 +65,220 @@ func TestBloomFilter(t *testing.T) {
 		}
 	}
 }
+
+func setupBloomRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+// testBloomFilterSuite 两种实现共用的行为测试
+func testBloomFilterSuite(t *testing.T, bf BloomFilter) {
+	ctx := context.Background()
+	// 预热完成前数据不完整，一律放行
+	if present, err := bf.ContainsBatch([]int64{9999}); err != nil || !present[0] {
+		t.Fatalf("contains before warm-up = %v, %v", present, err)
+	}
+	err := bf.Rebuild(ctx, func(after int64, add func(ids []int64) error) error {
+		return add([]int64{1001, 2002, 3003})
+	})
+	if err != nil {
+		t.Fatalf("warm up: %v", err)
+	}
+	if err := bf.Add(4004); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if ok, err := bf.Contains(4004); err != nil || !ok {
+		t.Fatalf("contains 4004 = %v, %v", ok, err)
+	}
+
+	present, err := bf.ContainsBatch([]int64{1001, 9999, 3003, 8888})
+	if err != nil {
+		t.Fatalf("contains batch: %v", err)
+	}
+	if len(present) != 4 || !present[0] || present[1] || !present[2] || present[3] {
+		t.Fatalf("contains batch = %v", present)
+	}
+
+	stats, err := bf.Stats(ctx)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Items != 4 || len(stats.Layers) != 1 || !stats.Ready || stats.FalsePositiveRate > 0.01 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	// 重建淘汰已删除的元素
+	err = bf.Rebuild(ctx, func(after int64, add func(ids []int64) error) error {
+		return add([]int64{1001, 4004})
+	})
+	if err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	present, err = bf.ContainsBatch([]int64{1001, 2002, 3003, 4004})
+	if err != nil {
+		t.Fatalf("contains batch after rebuild: %v", err)
+	}
+	if !present[0] || present[1] || present[2] || !present[3] {
+		t.Fatalf("contains batch after rebuild = %v", present)
+	}
+	if stats, _ := bf.Stats(ctx); stats.Generation != 2 || stats.Items != 2 || stats.BuiltAt.IsZero() {
+		t.Fatalf("stats after rebuild = %+v", stats)
+	}
+}
+
+func TestBitmapBloomFilterSuite(t *testing.T) {
+	_, client := setupBloomRedis(t)
+	if HasRedisBloom(context.Background(), client) {
+		t.Fatal("miniredis reported RedisBloom support")
+	}
+	testBloomFilterSuite(t, NewBloomFilter(client, "bf:suite", 1000, 0.01))
+}
+
+func TestRedisBloomFilterSuite(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     "127.0.0.1:6379",
+		Password: "8888.216", // match docker-compose
+	})
+	defer client.Close()
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	if !HasRedisBloom(ctx, client) {
+		t.Skip("RedisBloom not available")
+	}
+
+	key := "test:bf:suite"
+	t.Cleanup(func() {
+		keys, _ := client.Keys(ctx, key+"*").Result()
+		if len(keys) > 0 {
+			client.Del(ctx, keys...)
+		}
+	})
+	testBloomFilterSuite(t, NewBloomFilter(client, key, 1000, 0.01))
+}
+
+func TestBloomFilterScaleAndRebuild(t *testing.T) {
+	_, client := setupBloomRedis(t)
+	ctx := context.Background()
+	bf := NewBitmapBloomFilter(client, "bf:test", 100, 0.01)
+
+	ids := make([]int64, 0, 500)
+	for id := int64(1); id <= 500; id++ {
+		ids = append(ids, id)
+	}
+	for i := 0; i < len(ids); i += 50 {
+		if err := bf.AddBatch(ids[i : i+50]); err != nil {
+			t.Fatalf("add batch: %v", err)
+		}
+	}
+	for _, id := range ids {
+		if ok, err := bf.Contains(id); err != nil || !ok {
+			t.Fatalf("contains %d = %v, %v", id, ok, err)
+		}
+	}
+
+	stats, err := bf.Stats(ctx)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	// 100 -> 200 -> 400，写满前两层后扩容到第三层
+	if len(stats.Layers) != 3 || stats.Items < 450 {
+		t.Fatalf("stats = %d layers, %d items", len(stats.Layers), stats.Items)
+	}
+	if stats.FalsePositiveRate <= 0 || stats.FalsePositiveRate > 0.05 {
+		t.Fatalf("false positive rate = %v", stats.FalsePositiveRate)
+	}
+
+	// 重建后只保留仍存在的元素
+	err = bf.Rebuild(ctx, func(after int64, add func(ids []int64) error) error {
+		return add(ids[:10])
+	})
+	if err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	for _, id := range ids[:10] {
+		if ok, _ := bf.Contains(id); !ok {
+			t.Fatalf("kept id %d missing after rebuild", id)
+		}
+	}
+	removed := 0
+	for _, id := range ids[10:] {
+		if ok, _ := bf.Contains(id); !ok {
+			removed++
+		}
+	}
+	if removed < 480 {
+		t.Fatalf("only %d of 490 deleted ids removed by rebuild", removed)
+	}
+	if stats, _ := bf.Stats(ctx); stats.Generation != 1 || len(stats.Layers) != 1 || stats.BuiltAt.IsZero() {
+		t.Fatalf("stats after rebuild = %+v", stats)
+	}
+}
+
+func TestBloomFilterResumeRebuild(t *testing.T) {
+	_, client := setupBloomRedis(t)
+	ctx := context.Background()
+	bf := NewBitmapBloomFilter(client, "bf:resume", 1000, 0.01)
+
+	// 写入两批后中断
+	errBroken := fmt.Errorf("db gone")
+	err := bf.Rebuild(ctx, func(after int64, add func(ids []int64) error) error {
+		if after != 0 {
+			t.Fatalf("first rebuild starts after %d", after)
+		}
+		if err := add([]int64{1, 2, 3}); err != nil {
+			return err
+		}
+		if err := add([]int64{4, 5}); err != nil {
+			return err
+		}
+		return errBroken
+	})
+	if !errors.Is(err, errBroken) {
+		t.Fatalf("interrupted rebuild = %v", err)
+	}
+	if stats, _ := bf.Stats(ctx); stats.Ready || stats.Rebuilding {
+		t.Fatalf("stats after interrupted rebuild = %+v", stats)
+	}
+	if ok, _ := bf.Contains(99); !ok {
+		t.Fatal("unknown id blocked before warm-up completed")
+	}
+
+	// 再次重建从检查点继续，已写入的数据不再加载
+	err = bf.Rebuild(ctx, func(after int64, add func(ids []int64) error) error {
+		if after != 5 {
+			t.Fatalf("resumed rebuild starts after %d, want 5", after)
+		}
+		return add([]int64{6, 7})
+	})
+	if err != nil {
+		t.Fatalf("resume rebuild: %v", err)
+	}
+	for id := int64(1); id <= 7; id++ {
+		if ok, _ := bf.Contains(id); !ok {
+			t.Fatalf("id %d missing after resumed rebuild", id)
+		}
+	}
+	if ok, _ := bf.Contains(99); ok {
+		t.Fatal("unknown id passed after warm-up")
+	}
+	stats, _ := bf.Stats(ctx)
+	if !stats.Ready || stats.Generation != 1 || stats.Items != 7 {
+		t.Fatalf("stats after resumed rebuild = %+v", stats)
+	}
+
+	// 完成后检查点已清除，下次重建从头开始
+	err = bf.Rebuild(ctx, func(after int64, add func(ids []int64) error) error {
+		if after != 0 {
+			t.Fatalf("next rebuild starts after %d", after)
+		}
+		return add([]int64{1})
+	})
+	if err != nil {
+		t.Fatalf("next rebuild: %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+package utils
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"local-review-go/script"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// BitmapBloomFilter 基于位图的可扩展布隆过滤器，未加载 RedisBloom 模块时使用
+// 元素数达到当前层容量时增加一层，新层容量翻倍、误判率减半；查询时任一层命中即视为可能存在。
+//
+// 除 bloomMeta 中的元数据外，Redis 中的结构：
+//
+//	{key}:{gen}:{layer}     位图，第 0 代第 0 层沿用 {key}，兼容旧版单层位图
+//	{key}:{gen}:count       hash: layer -> 写入的元素数
+type BitmapBloomFilter struct {
+	client *redis.Client // Redis 客户端
+	key    string        // Redis Key 前缀
+	n      uint64        // 第 0 层的预期元素数量
+	p      float64       // 第 0 层的误判率
+}
+
+// NewBitmapBloomFilter 创建基于位图的布隆过滤器，参数同 NewBloomFilter
+func NewBitmapBloomFilter(client *redis.Client, key string, n uint64, p float64) *BitmapBloomFilter {
+	checkBloomParams(n, p)
+	return &BitmapBloomFilter{
+		client: client,
+		key:    key,
+		n:      n,
+		p:      p,
+	}
+}
+
+// bloomLayer 某一代中的一层位图
+type bloomLayer struct {
+	key      string
+	index    int
+	capacity uint64
+	m        uint64 // 位数组大小
+	k        uint64 // 哈希函数数量
+}
+
+// offsets 元素在该层位图中的所有位
+func (l bloomLayer) offsets(id int64) []int64 {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, uint64(id))
+
+	offsets := make([]int64, l.k)
+	for i := uint64(0); i < l.k; i++ {
+		hash := hashWithSeed(data, uint32(l.index)*bloomSeedStride+uint32(i))
+		offsets[i] = int64(hash % l.m)
+	}
+	return offsets
+}
+
+// bloomGeneration 一代布隆过滤器，重建时整体替换
+type bloomGeneration struct {
+	gen      int64
+	capacity uint64 // 第 0 层容量
+	layers   []bloomLayer
+}
+
+func (g bloomGeneration) last() bloomLayer {
+	return g.layers[len(g.layers)-1]
+}
+
+// bloomState 从 Redis 读到的当前代与正在重建的代
+type bloomState struct {
+	current  bloomGeneration
+	building *bloomGeneration
+	builtAt  time.Time
+}
+
+func (bf *BitmapBloomFilter) countKey(gen int64) string {
+	return fmt.Sprintf("%s:%d:count", bf.key, gen)
+}
+
+func (bf *BitmapBloomFilter) layerKey(gen int64, layer int) string {
+	if gen == 0 && layer == 0 {
+		return bf.key
+	}
+	return fmt.Sprintf("%s:%d:%d", bf.key, gen, layer)
+}
+
+// generation 按第 0 层容量推算各层参数，第 i 层容量为 capacity*2^i、误判率为 p*0.5^i
+func (bf *BitmapBloomFilter) generation(gen int64, capacity uint64, layers int) bloomGeneration {
+	g := bloomGeneration{gen: gen, capacity: capacity, layers: make([]bloomLayer, layers)}
+	for i := range g.layers {
+		n := capacity * uint64(math.Pow(bloomGrowth, float64(i)))
+		p := bf.p * math.Pow(bloomTightening, float64(i))
+		m := optimalM(n, p)
+		g.layers[i] = bloomLayer{key: bf.layerKey(gen, i), index: i, capacity: n, m: m, k: optimalK(n, m)}
+	}
+	return g
+}
+
+func (bf *BitmapBloomFilter) state(ctx context.Context) (bloomState, error) {
+	meta, err := readBloomMeta(ctx, bf.client, bf.key, bf.n)
+	if err != nil {
+		return bloomState{}, err
+	}
+	st := bloomState{current: bf.generation(meta.gen, meta.capacity, meta.layers), builtAt: meta.builtAt}
+	if meta.building != nil {
+		g := bf.generation(meta.building.gen, meta.building.capacity, 1)
+		st.building = &g
+	}
+	return st, nil
+}
+
+// Add 添加元素到布隆过滤器
+func (bf *BitmapBloomFilter) Add(id int64) error {
+	return bf.AddBatch([]int64{id})
+}
+
+// AddBatch 批量添加元素到布隆过滤器
+// 已存在于任一层的元素不再写入，避免重复计数；写入后最后一层达到容量时扩容
+func (bf *BitmapBloomFilter) AddBatch(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	st, err := bf.state(ctx)
+	if err != nil {
+		return err
+	}
+
+	present, err := bf.containsIn(ctx, st.current, ids)
+	if err != nil {
+		return err
+	}
+	seen := make(map[int64]bool, len(ids))
+	fresh := make([]int64, 0, len(ids))
+	for i, id := range ids {
+		if !present[i] && !seen[id] {
+			seen[id] = true
+			fresh = append(fresh, id)
+		}
+	}
+
+	pipe := bf.client.Pipeline()
+	last := st.current.last()
+	var countCmd *redis.IntCmd
+	if len(fresh) > 0 {
+		setBits(ctx, pipe, last, fresh)
+		countCmd = pipe.HIncrBy(ctx, bf.countKey(st.current.gen), strconv.Itoa(last.index), int64(len(fresh)))
+	}
+	// 重建期间的写入同时进入新一代，切换后不会丢失
+	if st.building != nil {
+		setBits(ctx, pipe, st.building.last(), ids)
+		pipe.HIncrBy(ctx, bf.countKey(st.building.gen), "0", int64(len(ids)))
+	}
+	if pipe.Len() == 0 {
+		return nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("add to bloom filter %s: %w", bf.key, err)
+	}
+
+	if countCmd != nil && uint64(countCmd.Val()) >= last.capacity {
+		err := script.BloomGrow.Run(ctx, bf.client, []string{bloomMetaKey(bf.key)},
+			st.current.gen, len(st.current.layers), bloomMaxLayers).Err()
+		if err != nil {
+			return fmt.Errorf("grow bloom filter %s: %w", bf.key, err)
+		}
+	}
+	return nil
+}
+
+func setBits(ctx context.Context, pipe redis.Pipeliner, layer bloomLayer, ids []int64) {
+	for _, id := range ids {
+		for _, offset := range layer.offsets(id) {
+			pipe.SetBit(ctx, layer.key, offset, 1)
+		}
+	}
+}
+
+// Contains 检查元素是否存在，预热完成前一律返回可能存在
+func (bf *BitmapBloomFilter) Contains(id int64) (bool, error) {
+	present, err := bf.ContainsBatch([]int64{id})
+	if err != nil {
+		return false, err
+	}
+	return present[0], nil
+}
+
+// ContainsBatch 批量检查元素是否存在，结果与 ids 一一对应
+func (bf *BitmapBloomFilter) ContainsBatch(ids []int64) ([]bool, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	ctx := context.Background()
+	st, err := bf.state(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if st.builtAt.IsZero() {
+		return allPresent(len(ids)), nil
+	}
+	return bf.containsIn(ctx, st.current, ids)
+}
+
+// containsIn 在一次 Pipeline 中检查多个元素，任一层的所有位都为 1 即可能存在
+func (bf *BitmapBloomFilter) containsIn(ctx context.Context, g bloomGeneration, ids []int64) ([]bool, error) {
+	pipe := bf.client.Pipeline()
+	cmds := make([][][]*redis.IntCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = make([][]*redis.IntCmd, len(g.layers))
+		for j, layer := range g.layers {
+			for _, offset := range layer.offsets(id) {
+				cmds[i][j] = append(cmds[i][j], pipe.GetBit(ctx, layer.key, offset))
+			}
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("check bloom filter %s: %w", bf.key, err)
+	}
+
+	present := make([]bool, len(ids))
+	for i := range ids {
+		for _, layerCmds := range cmds[i] {
+			if allBitsSet(layerCmds) {
+				present[i] = true
+				break
+			}
+		}
+	}
+	return present, nil
+}
+
+func allBitsSet(cmds []*redis.IntCmd) bool {
+	for _, cmd := range cmds {
+		if cmd.Val() == 0 {
+			return false // 只要有一位是 0，则一定不在该层
+		}
+	}
+	return true
+}
+
+// Stats 统计各层的填充率、估算元素数与误判率
+// 单层误判率为 fill^k，元素数按 -m/k*ln(1-fill) 估算；整体误判率为 1-Π(1-各层误判率)
+func (bf *BitmapBloomFilter) Stats(ctx context.Context) (BloomStats, error) {
+	st, err := bf.state(ctx)
+	if err != nil {
+		return BloomStats{}, err
+	}
+
+	pipe := bf.client.Pipeline()
+	countsCmd := pipe.HGetAll(ctx, bf.countKey(st.current.gen))
+	bitCmds := make([]*redis.IntCmd, len(st.current.layers))
+	for i, layer := range st.current.layers {
+		bitCmds[i] = pipe.BitCount(ctx, layer.key, nil)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return BloomStats{}, fmt.Errorf("stats bloom filter %s: %w", bf.key, err)
+	}
+
+	stats := BloomStats{
+		Key:        bf.key,
+		Backend:    "bitmap",
+		Generation: st.current.gen,
+		BuiltAt:    st.builtAt,
+		Ready:      !st.builtAt.IsZero(),
+		Rebuilding: st.building != nil,
+	}
+	counts := countsCmd.Val()
+	notFalse := 1.0
+	for i, layer := range st.current.layers {
+		items, _ := strconv.ParseUint(counts[strconv.Itoa(i)], 10, 64)
+		fill := float64(bitCmds[i].Val()) / float64(layer.m)
+		ls := BloomLayerStats{
+			Capacity:          layer.capacity,
+			Bits:              layer.m,
+			Hashes:            layer.k,
+			Items:             items,
+			FillRatio:         fill,
+			EstimatedItems:    -float64(layer.m) / float64(layer.k) * math.Log(1-min(fill, bloomMinFill)),
+			FalsePositiveRate: math.Pow(fill, float64(layer.k)),
+		}
+		stats.Items += ls.Items
+		stats.EstimatedItems += ls.EstimatedItems
+		notFalse *= 1 - ls.FalsePositiveRate
+		stats.Layers = append(stats.Layers, ls)
+	}
+	stats.FalsePositiveRate = 1 - notFalse
+	return stats, nil
+}
+
+// Rebuild 重建到新的一代，新一代第 0 层容量取初始容量与当前元素数两倍中的较大者，
+// 重建期间的 Add 会同时写入新一代；上次重建中断时沿用其容量并从检查点继续
+func (bf *BitmapBloomFilter) Rebuild(ctx context.Context, load BloomLoader) error {
+	meta, err := readBloomMeta(ctx, bf.client, bf.key, bf.n)
+	if err != nil {
+		return err
+	}
+	stats, err := bf.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	build, resumed, err := nextBloomBuild(meta, max(bf.n, stats.Items*bloomGrowth))
+	if err != nil {
+		return err
+	}
+	next := bf.generation(build.gen, build.capacity, 1).layers[0]
+
+	if err := beginBloomBuild(ctx, bf.client, bf.key, build); err != nil {
+		return err
+	}
+	// 拿到重建标记后再清理上次放弃的重建可能留下的同代数据，避免清掉其他实例正在写入的新一代；
+	// 清理前并发写入新一代的元素会在从头加载时补回
+	if !resumed {
+		if err := bf.client.Del(ctx, next.key, bf.countKey(build.gen)).Err(); err != nil {
+			abortBloomBuild(bf.client, bf.key)
+			return fmt.Errorf("clear bloom filter %s generation %d: %w", bf.key, build.gen, err)
+		}
+	}
+
+	err = loadBloomBuild(ctx, bf.client, bf.key, build, load, func(pipe redis.Pipeliner, ids []int64) {
+		setBits(ctx, pipe, next, ids)
+		pipe.HIncrBy(ctx, bf.countKey(build.gen), "0", int64(len(ids)))
+	})
+	if err != nil {
+		abortBloomBuild(bf.client, bf.key)
+		return fmt.Errorf("rebuild bloom filter %s: %w", bf.key, err)
+	}
+
+	current := bf.generation(meta.gen, meta.capacity, meta.layers)
+	retire := []string{bf.countKey(current.gen)}
+	for _, layer := range current.layers {
+		retire = append(retire, layer.key)
+	}
+	return commitBloomBuild(ctx, bf.client, bf.key, build, retire...)
+}
+
+// DebugInfo 获取调试信息
+func (bf *BitmapBloomFilter) DebugInfo() string {
+	return fmt.Sprintf("BloomFilter[Key=%s, n=%d, p=%g]", bf.key, bf.n, bf.p)
+}
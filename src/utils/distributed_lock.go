@@ -2,103 +2,365 @@ package utils
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
+	"local-review-go/script"
+	redisClient "local-review-go/src/config/redis"
+	"local-review-go/src/utils/redisx"
 	"sync"
 	"time"
 )
 
+const (
+	lockModeRead  = "read"
+	lockModeWrite = "write"
+
+	lockMaxWait      = time.Second     // 等待锁时最长多久重试一次，防止错过释放通知
+	fairQueueTimeout = 5 * time.Second // 公平锁等待者多久未刷新即被移出队列
+)
+
+var (
+	ErrLockTimeout = errors.New("获取锁超时")
+	ErrLockNotHeld = errors.New("未持有该锁")
+)
+
+// notHeld 未持有锁时 Lost() 返回的已关闭 channel
+var notHeld = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// Lock 分布式锁的持有者句柄
+type Lock interface {
+	Key() string
+	TryLock(ctx context.Context) (bool, error)
+	Lock(ctx context.Context) error
+	Unlock(ctx context.Context) error
+	Fence() int64
+	// RaiseFence 把 fencing token 计数器提升到不小于 fence，计数器丢失后按存储记录的值修复
+	RaiseFence(ctx context.Context, fence int64) error
+	Lost() <-chan struct{}
+	Context(parent context.Context) (context.Context, context.CancelFunc)
+}
+
+// Locker 分布式锁的创建方，单节点的 DistributedLock 与多节点的 RedLock 都实现该接口
+type Locker interface {
+	NewMutex(key string, ttl time.Duration) Lock
+	LockWithWatchDog(ctx context.Context, key string, ttl time.Duration) (Lock, bool, error)
+}
+
+// NewLocker 按配置创建分布式锁：配置了多个独立的 Redis 节点时使用 RedLock，否则使用默认 Redis
+func NewLocker() Locker {
+	if clients := redisClient.GetLockClients(); len(clients) > 1 {
+		return NewRedLock(clients...)
+	}
+	return NewDistributedLock(redisClient.GetRedisClient())
+}
+
+// DistributedLock 基于单个 Redis 的分布式锁
 type DistributedLock struct {
-	client    *redis.Client
-	watchDogs map[string]context.CancelFunc // 存储看门狗的取消函数
-	mutex     sync.Mutex                    // 保护watchDogs的并发访问
+	client   *redis.Client
+	notifier *lockNotifier
 }
 
 func NewDistributedLock(client *redis.Client) *DistributedLock {
-	return &DistributedLock{
-		client:    client,
-		watchDogs: make(map[string]context.CancelFunc),
+	return &DistributedLock{client: client, notifier: notifierOf(client)}
+}
+
+// Mutex 可重入的分布式锁，一个 Mutex 即一个持有者，以令牌区分
+// 同一个 Mutex 重复加锁只增加持有次数，需要同样次数的 Unlock 才会释放
+// 持有期间由看门狗自动续期，续期失败或锁过期时关闭 Lost() 通知持有者停止工作；
+// 写入存储时带上 Fence()，存储拒绝比已见过的更小的 fencing token 即可挡住过期的持有者
+// 多个 goroutine 互斥时应各自创建 Mutex
+type Mutex struct {
+	dl    *DistributedLock
+	key   string
+	token string
+	ttl   time.Duration
+	mode  string
+	fair  bool
+
+	mu      sync.Mutex
+	holds   int
+	fence   int64
+	lost    chan struct{}
+	stopDog context.CancelFunc
+}
+
+// NewMutex 创建可重入互斥锁
+func (dl *DistributedLock) NewMutex(key string, ttl time.Duration) Lock {
+	return dl.newMutex(key, uuid.New().String(), ttl, lockModeWrite, false)
+}
+
+// NewFairMutex 创建公平的可重入互斥锁，阻塞等待的持有者按到达顺序获取
+func (dl *DistributedLock) NewFairMutex(key string, ttl time.Duration) *Mutex {
+	return dl.newMutex(key, uuid.New().String(), ttl, lockModeWrite, true)
+}
+
+func (dl *DistributedLock) newMutex(key, token string, ttl time.Duration, mode string, fair bool) *Mutex {
+	return &Mutex{dl: dl, key: key, token: token, ttl: ttl, mode: mode, fair: fair, lost: notHeld}
+}
+
+// Token 持有者令牌
+func (m *Mutex) Token() string {
+	return m.token
+}
+
+// Key 锁 key
+func (m *Mutex) Key() string {
+	return m.key
+}
+
+// Fence 本次持有的 fencing token，每次新获取写锁时单调递增，未持有时为 0
+func (m *Mutex) Fence() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fence
+}
+
+func (m *Mutex) RaiseFence(ctx context.Context, fence int64) error {
+	return script.LockFenceRaise.Run(ctx, m.dl.client, []string{redisx.LOCK_FENCE_KEY + m.key}, fence).Err()
+}
+
+// Lost 锁丢失时关闭的 channel，正常释放时不会关闭；未持有锁时返回已关闭的 channel
+func (m *Mutex) Lost() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lost
+}
+
+// Context 返回在锁丢失时取消的 ctx，持锁执行的任务用它中断后续操作
+func (m *Mutex) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	return lostContext(parent, m.Lost())
+}
+
+func lostContext(parent context.Context, lost <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-lost:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// TryLock 尝试获取一次锁，不等待；公平锁获取失败时退出等待队列，不占用队首
+func (m *Mutex) TryLock(ctx context.Context) (bool, error) {
+	acquired, _, err := m.tryAcquire(ctx)
+	if err != nil || !acquired {
+		m.leaveQueue()
 	}
+	return acquired, err
 }
 
-// LockWithWatchDog 自动管理看门狗的加锁方法
-func (dl *DistributedLock) LockWithWatchDog(ctx context.Context, key string, ttl time.Duration) (bool, string, error) {
-	token := uuid.New().String()
-	result, err := dl.client.SetNX(ctx, key, token, ttl).Result()
+// Lock 阻塞获取锁，锁释放时通过 Pub/Sub 唤醒，ctx 结束时返回 ErrLockTimeout
+// 同一客户端上的等待者共用一条订阅连接，见 lockNotifier
+func (m *Mutex) Lock(ctx context.Context) error {
+	acquired, _, err := m.tryAcquire(ctx)
+	if err != nil || acquired {
+		return err
+	}
+
+	// 先订阅再重试，避免错过两次尝试之间的释放通知
+	released, leave, err := m.dl.notifier.wait(ctx, redisx.LOCK_CHANNEL_KEY+m.key)
 	if err != nil {
-		return false, "", err
+		m.leaveQueue()
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %s: %w", ErrLockTimeout, m.key, ctx.Err())
+		}
+		return fmt.Errorf("subscribe lock channel %s: %w", m.key, err)
 	}
+	defer leave()
 
-	if !result {
-		return false, "", nil
+	for {
+		acquired, wait, err := m.tryAcquire(ctx)
+		if err != nil {
+			m.leaveQueue()
+			return err
+		}
+		if acquired {
+			return nil
+		}
+
+		timer := time.NewTimer(min(wait, lockMaxWait))
+		select {
+		case <-released:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			m.leaveQueue()
+			return fmt.Errorf("%w: %s: %w", ErrLockTimeout, m.key, ctx.Err())
+		}
+		timer.Stop()
 	}
+}
 
-	// 启动看门狗
-	dl.mutex.Lock()
-	defer dl.mutex.Unlock()
+// Unlock 释放一次锁，持有次数减到 0 时停止看门狗
+// 读写锁两侧共用令牌，一侧完全释放而另一侧仍持有时锁不会删除，由仍持有的一侧的看门狗续期
+func (m *Mutex) Unlock(ctx context.Context) error {
+	result, err := script.LockRelease.Run(ctx, m.dl.client,
+		[]string{m.key, redisx.LOCK_CHANNEL_KEY + m.key}, m.token, m.ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("release lock %s: %w", m.key, err)
+	}
 
-	// 如果已有看门狗，先停止它（防止重复）
-	if cancel, ok := dl.watchDogs[key]; ok {
-		cancel()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch result {
+	case -1:
+		m.stopWatchDog()
+		return ErrLockNotHeld
+	case 0:
+		m.holds--
+		if m.holds <= 0 {
+			m.stopWatchDog()
+		}
+	default:
+		m.stopWatchDog()
 	}
+	return nil
+}
 
-	// 创建新的看门狗上下文
-	dogCtx, cancel := context.WithCancel(context.Background())
-	dl.watchDogs[key] = cancel
+// tryAcquire 获取成功时返回 true，否则返回建议等待的时间
+func (m *Mutex) tryAcquire(ctx context.Context) (bool, time.Duration, error) {
+	var cmd *redis.Cmd
+	if m.fair {
+		cmd = script.LockAcquireFair.Run(ctx, m.dl.client, m.fairKeys(), m.token,
+			m.ttl.Milliseconds(), fairQueueTimeout.Milliseconds(), time.Now().UnixMilli())
+	} else {
+		cmd = script.LockAcquire.Run(ctx, m.dl.client, []string{m.key, redisx.LOCK_FENCE_KEY + m.key},
+			m.token, m.ttl.Milliseconds(), m.mode)
+	}
+	result, err := cmd.Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("acquire lock %s: %w", m.key, err)
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("acquire lock %s: unexpected result %v", m.key, result)
+	}
+	if result[0] == 0 {
+		return false, time.Duration(result[1]) * time.Millisecond, nil
+	}
 
-	// 启动看门狗协程
-	go dl.watchDog(dogCtx, key, token, ttl)
+	m.mu.Lock()
+	m.holds++
+	m.fence = result[1]
+	if m.holds == 1 {
+		dogCtx, cancel := context.WithCancel(context.Background())
+		m.stopDog = cancel
+		m.lost = make(chan struct{})
+		go m.watchDog(dogCtx, m.lost)
+	}
+	m.mu.Unlock()
+	return true, 0, nil
+}
 
-	return true, token, nil
+func (m *Mutex) fairKeys() []string {
+	return []string{m.key, m.key + ":queue", m.key + ":timeout", redisx.LOCK_FENCE_KEY + m.key}
 }
 
-// UnlockWithWatchDog 自动停止看门狗的解锁方法
-func (dl *DistributedLock) UnlockWithWatchDog(ctx context.Context, key, token string) error {
-	// 先停止看门狗
-	dl.mutex.Lock()
-	if cancel, ok := dl.watchDogs[key]; ok {
-		cancel()
-		delete(dl.watchDogs, key)
+// leaveQueue 放弃等待时退出公平锁的等待队列
+func (m *Mutex) leaveQueue() {
+	if !m.fair {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	keys := m.fairKeys()
+	pipe := m.dl.client.TxPipeline()
+	pipe.LRem(ctx, keys[1], 0, m.token)
+	pipe.ZRem(ctx, keys[2], m.token)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logrus.Warnf("leave lock queue %s failed: %v", m.key, err)
 	}
-	dl.mutex.Unlock()
+}
 
-	// 执行解锁操作
-	script := `
-        if redis.call("GET", KEYS[1]) == ARGV[1] then
-            return redis.call("DEL", KEYS[1])
-        else
-            return 0
-        end
-    `
-	_, err := dl.client.Eval(ctx, script, []string{key}, token).Result()
-	return err
+// stopWatchDog 调用方需持有 m.mu
+func (m *Mutex) stopWatchDog() {
+	m.holds = 0
+	m.fence = 0
+	m.lost = notHeld
+	if m.stopDog != nil {
+		m.stopDog()
+		m.stopDog = nil
+	}
 }
 
-// watchDog 自动续期的看门狗实现
-func (dl *DistributedLock) watchDog(ctx context.Context, key, token string, ttl time.Duration) {
-	ticker := time.NewTicker(ttl / 2)
+// watchDog 自动续期的看门狗实现，锁被他人占用或超过 TTL 未能续期时关闭 lost
+func (m *Mutex) watchDog(ctx context.Context, lost chan struct{}) {
+	ticker := time.NewTicker(m.ttl / 3)
 	defer ticker.Stop()
+	renewedAt := time.Now()
 
 	for {
 		select {
 		case <-ticker.C:
 			// 续期时验证令牌
-			script := `
-                if redis.call("GET", KEYS[1]) == ARGV[1] then
-                    return redis.call("EXPIRE", KEYS[1], ARGV[2])
-                else
-                    return 0
-                end
-            `
-			result, err := dl.client.Eval(ctx, script, []string{key}, token, int(ttl/time.Second)).Result()
-			if err != nil || result == nil {
-				logrus.Warnf("锁续期失败: key=%s, err=%v", key, err)
+			now := time.Now()
+			renewed, err := script.LockOwnerRenew.Run(ctx, m.dl.client, []string{m.key},
+				m.token, m.ttl.Milliseconds()).Int()
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logrus.Warnf("锁续期失败: key=%s, err=%v", m.key, err)
+				// 下次续期前锁就会过期
+				if now.Sub(renewedAt) >= m.ttl*2/3 {
+					logrus.Warnf("锁已过期: key=%s", m.key)
+					close(lost)
+					return
+				}
+				continue
+			}
+			if renewed == 0 {
+				logrus.Warnf("锁已丢失: key=%s", m.key)
+				close(lost)
 				return
 			}
+			renewedAt = now
 
 		case <-ctx.Done():
 			return
 		}
 	}
 }
+
+// RWMutex 可重入的分布式读写锁，读锁共享、写锁互斥
+// 持有写锁时可以再获取读锁，不支持读锁升级为写锁
+type RWMutex struct {
+	r *Mutex
+	w *Mutex
+}
+
+// NewRWMutex 创建读写锁，读写两侧共用同一个持有者令牌
+func (dl *DistributedLock) NewRWMutex(key string, ttl time.Duration) *RWMutex {
+	token := uuid.New().String()
+	return &RWMutex{
+		r: dl.newMutex(key, token, ttl, lockModeRead, false),
+		w: dl.newMutex(key, token, ttl, lockModeWrite, false),
+	}
+}
+
+// 读写两侧的加解锁语义同 Mutex
+func (rw *RWMutex) RLock(ctx context.Context) error            { return rw.r.Lock(ctx) }
+func (rw *RWMutex) TryRLock(ctx context.Context) (bool, error) { return rw.r.TryLock(ctx) }
+func (rw *RWMutex) RUnlock(ctx context.Context) error          { return rw.r.Unlock(ctx) }
+func (rw *RWMutex) Lock(ctx context.Context) error             { return rw.w.Lock(ctx) }
+func (rw *RWMutex) TryLock(ctx context.Context) (bool, error)  { return rw.w.TryLock(ctx) }
+func (rw *RWMutex) Unlock(ctx context.Context) error           { return rw.w.Unlock(ctx) }
+
+// LockWithWatchDog 尝试获取一次互斥锁并由看门狗续期，获取成功时返回锁句柄
+func (dl *DistributedLock) LockWithWatchDog(ctx context.Context, key string, ttl time.Duration) (Lock, bool, error) {
+	m := dl.NewMutex(key, ttl)
+	acquired, err := m.TryLock(ctx)
+	if err != nil || !acquired {
+		return nil, false, err
+	}
+	return m, true, nil
+}
@@ -0,0 +1,271 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"local-review-go/src/utils/redisx"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func setupLockRedis(t *testing.T) (*miniredis.Miniredis, *DistributedLock) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, NewDistributedLock(client)
+}
+
+func TestMutexReentrant(t *testing.T) {
+	mr, dl := setupLockRedis(t)
+	ctx := context.Background()
+
+	m := dl.NewMutex("lock:test", 10*time.Second)
+	for i := 0; i < 2; i++ {
+		if ok, err := m.TryLock(ctx); err != nil || !ok {
+			t.Fatalf("lock #%d = %v, %v", i+1, ok, err)
+		}
+	}
+	if ok, _ := dl.NewMutex("lock:test", 10*time.Second).TryLock(ctx); ok {
+		t.Fatal("another owner acquired a held lock")
+	}
+
+	m.Unlock(ctx)
+	if !mr.Exists("lock:test") {
+		t.Fatal("lock released before all holds are unlocked")
+	}
+	m.Unlock(ctx)
+	if mr.Exists("lock:test") {
+		t.Fatal("lock not released")
+	}
+	if err := m.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("unlock not held lock: err = %v", err)
+	}
+}
+
+func TestMutexBlockingLock(t *testing.T) {
+	_, dl := setupLockRedis(t)
+	ctx := context.Background()
+
+	holder := dl.NewMutex("lock:test", 10*time.Second)
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := dl.NewMutex("lock:test", 10*time.Second).Lock(timeoutCtx); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("lock held lock: err = %v, want ErrLockTimeout", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		done <- dl.NewMutex("lock:test", 10*time.Second).Lock(waitCtx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	holder.Unlock(ctx)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("waiter lock: %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("waiter not woken up by release")
+	}
+}
+
+func TestMutexWaitersShareSubscription(t *testing.T) {
+	_, dl := setupLockRedis(t)
+	ctx := context.Background()
+	channel := redisx.LOCK_CHANNEL_KEY + "lock:test"
+
+	holder := dl.NewMutex("lock:test", 10*time.Second)
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	const waiters = 10
+	done := make(chan error, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			m := dl.NewMutex("lock:test", 10*time.Second)
+			err := m.Lock(waitCtx)
+			if err == nil {
+				m.Unlock(ctx)
+			}
+			done <- err
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// 热点 key 上的所有等待者共用一条订阅连接
+	if n := dl.client.PubSubNumSub(ctx, channel).Val()[channel]; n != 1 {
+		t.Fatalf("subscribers of %s = %d, want 1", channel, n)
+	}
+
+	holder.Unlock(ctx)
+	for i := 0; i < waiters; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("waiter lock: %v", err)
+		}
+	}
+	// 最后一个等待者退出后取消订阅
+	time.Sleep(50 * time.Millisecond)
+	if n := dl.client.PubSubNumSub(ctx, channel).Val()[channel]; n != 0 {
+		t.Fatalf("subscribers of %s after all waiters left = %d, want 0", channel, n)
+	}
+}
+
+func TestRWMutex(t *testing.T) {
+	_, dl := setupLockRedis(t)
+	ctx := context.Background()
+
+	r1 := dl.NewRWMutex("lock:rw", 10*time.Second)
+	r2 := dl.NewRWMutex("lock:rw", 10*time.Second)
+	w := dl.NewRWMutex("lock:rw", 10*time.Second)
+
+	if ok, err := r1.TryRLock(ctx); err != nil || !ok {
+		t.Fatalf("read lock r1 = %v, %v", ok, err)
+	}
+	if ok, err := r2.TryRLock(ctx); err != nil || !ok {
+		t.Fatalf("read lock r2 = %v, %v", ok, err)
+	}
+	if ok, _ := w.TryLock(ctx); ok {
+		t.Fatal("write lock acquired while read locks are held")
+	}
+	r1.RUnlock(ctx)
+	r2.RUnlock(ctx)
+
+	if ok, err := w.TryLock(ctx); err != nil || !ok {
+		t.Fatalf("write lock = %v, %v", ok, err)
+	}
+	if ok, _ := r1.TryRLock(ctx); ok {
+		t.Fatal("read lock acquired while write lock is held")
+	}
+	// 持有写锁时可以再获取读锁
+	if ok, err := w.TryRLock(ctx); err != nil || !ok {
+		t.Fatalf("read lock by writer = %v, %v", ok, err)
+	}
+
+	// 先释放写锁时停止写侧的看门狗，读侧继续持有并续期
+	if err := w.Unlock(ctx); err != nil {
+		t.Fatalf("unlock write side: %v", err)
+	}
+	w.w.mu.Lock()
+	writeDog := w.w.stopDog
+	w.w.mu.Unlock()
+	if writeDog != nil {
+		t.Fatal("write side watchdog still running after unlock")
+	}
+	if err := w.RUnlock(ctx); err != nil {
+		t.Fatalf("unlock read side: %v", err)
+	}
+}
+
+func TestFairMutex(t *testing.T) {
+	mr, dl := setupLockRedis(t)
+	ctx := context.Background()
+
+	holder := dl.NewFairMutex("lock:fair", 10*time.Second)
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	// TryLock 失败后退出等待队列，不在队首留下挡住后来者的记录
+	if ok, _ := dl.NewFairMutex("lock:fair", 10*time.Second).TryLock(ctx); ok {
+		t.Fatal("try lock acquired a held lock")
+	}
+	if mr.Exists("lock:fair:queue") {
+		t.Fatal("failed try lock left an entry in the queue")
+	}
+
+	// 排队等待的持有者在锁释放后获得锁，后到者即使锁空闲也不能插队
+	first := dl.NewFairMutex("lock:fair", 10*time.Second)
+	done := make(chan error, 1)
+	go func() {
+		waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		done <- first.Lock(waitCtx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	holder.Unlock(ctx)
+
+	if ok, _ := dl.NewFairMutex("lock:fair", 10*time.Second).TryLock(ctx); ok {
+		t.Fatal("late comer jumped the queue")
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("queue head lock: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queue head not woken up by release")
+	}
+}
+
+func TestMutexFenceAndLost(t *testing.T) {
+	mr, dl := setupLockRedis(t)
+	ctx := context.Background()
+
+	first, ok, err := dl.LockWithWatchDog(ctx, "lock:fence", 300*time.Millisecond)
+	if err != nil || !ok {
+		t.Fatalf("lock = %v, %v", ok, err)
+	}
+	fence := first.Fence()
+	if fence <= 0 {
+		t.Fatalf("fence = %d, want > 0", fence)
+	}
+
+	// 锁被删除后看门狗续期失败，Lost 关闭
+	mr.Del("lock:fence")
+	select {
+	case <-first.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lost not closed after the lock disappeared")
+	}
+
+	second, ok, err := dl.LockWithWatchDog(ctx, "lock:fence", 300*time.Millisecond)
+	if err != nil || !ok {
+		t.Fatalf("relock = %v, %v", ok, err)
+	}
+	if second.Fence() <= fence {
+		t.Fatalf("fence not increasing: %d after %d", second.Fence(), fence)
+	}
+	select {
+	case <-second.Lost():
+		t.Fatal("lost closed while the lock is held")
+	default:
+	}
+	second.Unlock(ctx)
+}
+
+func TestMutexRaiseFence(t *testing.T) {
+	mr, dl := setupLockRedis(t)
+	ctx := context.Background()
+
+	m := dl.NewMutex("lock:test", 10*time.Second)
+	if ok, err := m.TryLock(ctx); err != nil || !ok {
+		t.Fatalf("lock = %v, %v", ok, err)
+	}
+	m.Unlock(ctx)
+
+	// 计数器丢失后按存储记录的值提升，之后分配的 token 大于该值
+	mr.Del("lock:fence:lock:test")
+	if err := m.RaiseFence(ctx, 100); err != nil {
+		t.Fatalf("raise fence: %v", err)
+	}
+	if ok, err := m.TryLock(ctx); err != nil || !ok {
+		t.Fatalf("relock = %v, %v", ok, err)
+	}
+	if m.Fence() <= 100 {
+		t.Fatalf("fence = %d after raising to 100", m.Fence())
+	}
+}
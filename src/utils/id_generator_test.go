@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	redisConfig "local-review-go/src/config/redis"
+	"local-review-go/src/utils/redisx"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// generateIds 多个生成器并发各生成 n 个 ID，检查没有重复
+func generateIds(t *testing.T, n int, gens ...redisx.IDGenerator) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		seen = make(map[int64]struct{}, n*len(gens))
+		wg   sync.WaitGroup
+	)
+	for g := 0; g < 8*len(gens); g++ {
+		gen := gens[g%len(gens)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n/8; i++ {
+				id, err := gen.NextId("order")
+				if err != nil {
+					t.Errorf("next id: %v", err)
+					return
+				}
+				mu.Lock()
+				if _, ok := seen[id]; ok {
+					t.Errorf("duplicate id %d", id)
+				}
+				seen[id] = struct{}{}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSnowflakeWorker(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	a, err := NewSnowflakeWorker(ctx, client)
+	if err != nil {
+		t.Fatalf("new snowflake worker: %v", err)
+	}
+	b, err := NewSnowflakeWorker(ctx, client)
+	if err != nil {
+		t.Fatalf("new snowflake worker: %v", err)
+	}
+	if a.WorkerId() == b.WorkerId() {
+		t.Fatalf("two workers leased the same id %d", a.WorkerId())
+	}
+	generateIds(t, 20000, a, b)
+
+	// 释放时记录最后使用的时间戳，之后租到该 workerId 的实例不会生成更早的 ID
+	id := a.WorkerId()
+	if err := a.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := a.NextId("order"); err == nil {
+		t.Fatal("closed worker still generates ids")
+	}
+	if mr.Exists(snowflakeWorkerKey(id)) {
+		t.Fatal("worker id not released on close")
+	}
+	if !mr.Exists(snowflakeLastKey(id)) {
+		t.Fatal("last timestamp not saved on close")
+	}
+	b.Close(ctx)
+}
+
+func TestSegmentWorker(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	prev := redisConfig.GetRedisClient()
+	redisConfig.SetRedisClient(client)
+	defer redisConfig.SetRedisClient(prev)
+
+	// 号段与 RedisWorker 共用 Redis 序号，步长很小以覆盖号段切换与预取
+	generateIds(t, 4000, redisx.NewSegmentWorker(client, 16), redisx.NewSegmentWorker(client, 16), redisx.RedisWork)
+}
+
+func TestSnowflakeWorkerClockBackwards(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	w, err := NewSnowflakeWorker(ctx, client)
+	if err != nil {
+		t.Fatalf("new snowflake worker: %v", err)
+	}
+	defer w.Close(ctx)
+	clock := time.Now()
+	w.now = func() time.Time { return clock }
+	w.sleep = func(d time.Duration) { clock = clock.Add(d) }
+
+	seen := make(map[int64]struct{})
+	next := func(step string) {
+		t.Helper()
+		id, err := w.NextId("order")
+		if err != nil {
+			t.Fatalf("%s: next id: %v", step, err)
+		}
+		if _, ok := seen[id]; ok {
+			t.Fatalf("%s: duplicate id %d", step, id)
+		}
+		seen[id] = struct{}{}
+	}
+	for i := 0; i < 3; i++ {
+		next("before backwards")
+		clock = clock.Add(time.Millisecond)
+	}
+
+	// 小幅回拨时等待时钟追平，之后生成的 ID 不与回拨前的重复
+	clock = clock.Add(-3 * time.Millisecond)
+	next("small backwards")
+	next("small backwards")
+
+	// 超过容忍范围的回拨直接拒绝
+	clock = clock.Add(-time.Second)
+	if _, err := w.NextId("order"); !errors.Is(err, ErrClockBackwards) {
+		t.Fatalf("large backwards: err = %v, want ErrClockBackwards", err)
+	}
+	clock = clock.Add(time.Second + time.Millisecond)
+	next("after recovery")
+}
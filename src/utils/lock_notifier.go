@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const lockNotifierRetry = 100 * time.Millisecond // 共享订阅连接出错后多久重新读取
+
+// lockNotifiers 每个 Redis 客户端共用一个 lockNotifier，*redis.Client -> *lockNotifier
+var lockNotifiers sync.Map
+
+// lockNotifier 同一客户端上所有等待锁的持有者共用一条 Pub/Sub 连接，
+// 每个锁的释放频道只订阅一次，收到释放通知后分发给该频道的所有等待者；
+// 热点 key 上大量并发等待时不会为每个等待者各建一条订阅连接
+type lockNotifier struct {
+	client *redis.Client
+
+	mu       sync.Mutex
+	pubsub   *redis.PubSub
+	channels map[string]*lockWaiters
+}
+
+type lockWaiters struct {
+	ready   chan struct{} // 收到订阅确认后关闭，此后发布的释放通知不会错过
+	waiters map[chan struct{}]struct{}
+}
+
+func notifierOf(client *redis.Client) *lockNotifier {
+	n, _ := lockNotifiers.LoadOrStore(client, &lockNotifier{
+		client:   client,
+		channels: make(map[string]*lockWaiters),
+	})
+	return n.(*lockNotifier)
+}
+
+// wait 订阅释放频道，返回收到释放通知时可读的 channel 与退出等待的函数；订阅确认后才返回
+func (n *lockNotifier) wait(ctx context.Context, channel string) (<-chan struct{}, func(), error) {
+	released := make(chan struct{}, 1)
+
+	n.mu.Lock()
+	if n.pubsub == nil {
+		n.pubsub = n.client.Subscribe(context.Background())
+		go n.dispatch(n.pubsub)
+	}
+	w, ok := n.channels[channel]
+	if !ok {
+		if err := n.pubsub.Subscribe(ctx, channel); err != nil {
+			n.mu.Unlock()
+			return nil, nil, err
+		}
+		w = &lockWaiters{ready: make(chan struct{}), waiters: make(map[chan struct{}]struct{})}
+		n.channels[channel] = w
+	}
+	w.waiters[released] = struct{}{}
+	n.mu.Unlock()
+
+	leave := func() { n.leave(channel, w, released) }
+	select {
+	case <-w.ready:
+		return released, leave, nil
+	case <-ctx.Done():
+		leave()
+		return nil, nil, ctx.Err()
+	}
+}
+
+// leave 退出等待，频道上没有等待者时取消订阅
+func (n *lockNotifier) leave(channel string, w *lockWaiters, released chan struct{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(w.waiters, released)
+	if len(w.waiters) > 0 || n.channels[channel] != w {
+		return
+	}
+	delete(n.channels, channel)
+	if err := n.pubsub.Unsubscribe(context.Background(), channel); err != nil {
+		logrus.Warnf("unsubscribe lock channel %s failed: %v", channel, err)
+	}
+}
+
+// dispatch 读取共享连接上的消息：订阅确认唤醒等待订阅的持有者，释放通知分发给频道上的所有等待者
+// 连接断开时 go-redis 重连并重新订阅，期间错过的通知由 Lock 的定时重试兜底
+func (n *lockNotifier) dispatch(pubsub *redis.PubSub) {
+	for {
+		msg, err := pubsub.Receive(context.Background())
+		if err != nil {
+			if errors.Is(err, redis.ErrClosed) {
+				// 客户端已关闭，放行仍在等待订阅确认的持有者，由其后续的加锁请求返回错误
+				n.mu.Lock()
+				if n.pubsub == pubsub {
+					n.pubsub = nil
+					for channel, w := range n.channels {
+						select {
+						case <-w.ready:
+						default:
+							close(w.ready)
+						}
+						delete(n.channels, channel)
+					}
+				}
+				n.mu.Unlock()
+				return
+			}
+			time.Sleep(lockNotifierRetry)
+			continue
+		}
+
+		n.mu.Lock()
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			if w := n.channels[msg.Channel]; w != nil && msg.Kind == "subscribe" {
+				select {
+				case <-w.ready:
+				default:
+					close(w.ready)
+				}
+			}
+		case *redis.Message:
+			if w := n.channels[msg.Channel]; w != nil {
+				for released := range w.waiters {
+					select {
+					case released <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+		n.mu.Unlock()
+	}
+}
@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisBloomProbeKey 探测 RedisBloom 时查询的 key，不存在或类型不对都不影响结果
+const redisBloomProbeKey = "bf:probe"
+
+// HasRedisBloom 检测 Redis 是否提供 BF.* 命令（加载了 RedisBloom 模块或 Redis 8 内置），
+// 只有服务端明确返回未知命令时才判定不支持，连接失败也按不支持处理
+func HasRedisBloom(ctx context.Context, client *redis.Client) bool {
+	err := client.Do(ctx, "BF.EXISTS", redisBloomProbeKey, 0).Err()
+	if err == nil {
+		return true
+	}
+	var replyErr redis.Error
+	if !errors.As(err, &replyErr) {
+		return false
+	}
+	return !strings.Contains(strings.ToLower(err.Error()), "unknown command")
+}
+
+// RedisBloomFilter 基于 RedisBloom 模块的布隆过滤器，扩容由模块完成（EXPANSION 2，每层误判率减半）
+//
+// 为与位图实现的 key 区分，元数据前缀为 {key}:rb，每一代的过滤器为 {key}:rb:{gen}
+type RedisBloomFilter struct {
+	client *redis.Client
+	key    string
+	n      uint64
+	p      float64
+
+	mu       sync.Mutex
+	reserved map[string]bool // 本实例已确认创建过的过滤器
+}
+
+// NewRedisBloomFilter 创建基于 RedisBloom 的布隆过滤器，参数同 NewBloomFilter
+func NewRedisBloomFilter(client *redis.Client, key string, n uint64, p float64) *RedisBloomFilter {
+	checkBloomParams(n, p)
+	return &RedisBloomFilter{
+		client:   client,
+		key:      key,
+		n:        n,
+		p:        p,
+		reserved: make(map[string]bool),
+	}
+}
+
+func (bf *RedisBloomFilter) prefix() string {
+	return bf.key + ":rb"
+}
+
+func (bf *RedisBloomFilter) filterKey(gen int64) string {
+	return fmt.Sprintf("%s:%d", bf.prefix(), gen)
+}
+
+// reserve 按容量与误判率创建过滤器，避免 BF.MADD 以默认参数自动创建
+func (bf *RedisBloomFilter) reserve(ctx context.Context, key string, capacity uint64) error {
+	bf.mu.Lock()
+	done := bf.reserved[key]
+	bf.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	err := bf.client.BFReserveExpansion(ctx, key, bf.p, int64(capacity), bloomGrowth).Err()
+	if err != nil && !strings.Contains(err.Error(), "exists") {
+		return fmt.Errorf("reserve bloom filter %s: %w", key, err)
+	}
+	bf.mu.Lock()
+	bf.reserved[key] = true
+	bf.mu.Unlock()
+	return nil
+}
+
+// Add 添加元素到布隆过滤器
+func (bf *RedisBloomFilter) Add(id int64) error {
+	return bf.AddBatch([]int64{id})
+}
+
+// AddBatch 使用 BF.MADD 批量添加，重建期间同时写入新一代
+func (bf *RedisBloomFilter) AddBatch(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	meta, err := readBloomMeta(ctx, bf.client, bf.prefix(), bf.n)
+	if err != nil {
+		return err
+	}
+	current := bf.filterKey(meta.gen)
+	if err := bf.reserve(ctx, current, meta.capacity); err != nil {
+		return err
+	}
+
+	items := bloomItems(ids)
+	pipe := bf.client.Pipeline()
+	pipe.BFMAdd(ctx, current, items...)
+	if meta.building != nil {
+		pipe.BFMAdd(ctx, bf.filterKey(meta.building.gen), items...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("add to bloom filter %s: %w", bf.key, err)
+	}
+	return nil
+}
+
+// Contains 检查元素是否存在
+func (bf *RedisBloomFilter) Contains(id int64) (bool, error) {
+	present, err := bf.ContainsBatch([]int64{id})
+	if err != nil {
+		return false, err
+	}
+	return present[0], nil
+}
+
+// ContainsBatch 使用 BF.MEXISTS 批量检查，结果与 ids 一一对应，预热完成前一律返回可能存在
+func (bf *RedisBloomFilter) ContainsBatch(ids []int64) ([]bool, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	ctx := context.Background()
+	meta, err := readBloomMeta(ctx, bf.client, bf.prefix(), bf.n)
+	if err != nil {
+		return nil, err
+	}
+	if !meta.ready() {
+		return allPresent(len(ids)), nil
+	}
+	present, err := bf.client.BFMExists(ctx, bf.filterKey(meta.gen), bloomItems(ids)...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("check bloom filter %s: %w", bf.key, err)
+	}
+	return present, nil
+}
+
+// Stats 由 BF.INFO 读取容量、层数与写入数
+// 模块不暴露填充率，误判率按各层配置的上限估算：第 i 层为 p*0.5^i，整体为 1-Π(1-各层误判率)
+func (bf *RedisBloomFilter) Stats(ctx context.Context) (BloomStats, error) {
+	meta, err := readBloomMeta(ctx, bf.client, bf.prefix(), bf.n)
+	if err != nil {
+		return BloomStats{}, err
+	}
+	stats := BloomStats{
+		Key:        bf.key,
+		Backend:    "redisbloom",
+		Generation: meta.gen,
+		BuiltAt:    meta.builtAt,
+		Ready:      meta.ready(),
+		Rebuilding: meta.building != nil,
+	}
+
+	info, err := bf.client.BFInfo(ctx, bf.filterKey(meta.gen)).Result()
+	if err != nil {
+		// 尚未写入过元素
+		if strings.Contains(err.Error(), "not found") {
+			return stats, nil
+		}
+		return BloomStats{}, fmt.Errorf("stats bloom filter %s: %w", bf.key, err)
+	}
+
+	stats.Items = uint64(info.ItemsInserted)
+	stats.EstimatedItems = float64(info.ItemsInserted)
+	notFalse := 1.0
+	for i := int64(0); i < info.Filters; i++ {
+		ls := BloomLayerStats{
+			Capacity:          meta.capacity * uint64(math.Pow(bloomGrowth, float64(i))),
+			FalsePositiveRate: bf.p * math.Pow(bloomTightening, float64(i)),
+		}
+		notFalse *= 1 - ls.FalsePositiveRate
+		stats.Layers = append(stats.Layers, ls)
+	}
+	stats.FalsePositiveRate = 1 - notFalse
+	return stats, nil
+}
+
+// Rebuild 重建到新的一代，新一代容量取初始容量与当前元素数两倍中的较大者；
+// 上次重建中断时从检查点继续写入已创建的过滤器
+func (bf *RedisBloomFilter) Rebuild(ctx context.Context, load BloomLoader) error {
+	meta, err := readBloomMeta(ctx, bf.client, bf.prefix(), bf.n)
+	if err != nil {
+		return err
+	}
+	stats, err := bf.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	build, resumed, err := nextBloomBuild(meta, max(bf.n, stats.Items*bloomGrowth))
+	if err != nil {
+		return err
+	}
+	next := bf.filterKey(build.gen)
+
+	if err := beginBloomBuild(ctx, bf.client, bf.prefix(), build); err != nil {
+		return err
+	}
+	// 拿到重建标记后再清理上次放弃的重建可能留下的同代数据并按参数创建新一代，
+	// 两步在同一事务中执行，标记之后的并发写入以默认参数自动创建的过滤器会被替换，
+	// 被清掉的元素在从头加载时补回
+	_, err = bf.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if !resumed {
+			pipe.Del(ctx, next)
+		}
+		pipe.BFReserveExpansion(ctx, next, bf.p, int64(build.capacity), bloomGrowth)
+		return nil
+	})
+	if err != nil && !(resumed && strings.Contains(err.Error(), "exists")) {
+		abortBloomBuild(bf.client, bf.prefix())
+		return fmt.Errorf("reserve bloom filter %s: %w", next, err)
+	}
+
+	err = loadBloomBuild(ctx, bf.client, bf.prefix(), build, load, func(pipe redis.Pipeliner, ids []int64) {
+		pipe.BFMAdd(ctx, next, bloomItems(ids)...)
+	})
+	if err != nil {
+		abortBloomBuild(bf.client, bf.prefix())
+		return fmt.Errorf("rebuild bloom filter %s: %w", bf.key, err)
+	}
+	return commitBloomBuild(ctx, bf.client, bf.prefix(), build, bf.filterKey(meta.gen))
+}
+
+// DebugInfo 获取调试信息
+func (bf *RedisBloomFilter) DebugInfo() string {
+	return fmt.Sprintf("RedisBloomFilter[Key=%s, n=%d, p=%g]", bf.key, bf.n, bf.p)
+}
+
+func bloomItems(ids []int64) []interface{} {
+	items := make([]interface{}, len(ids))
+	for i, id := range ids {
+		items[i] = id
+	}
+	return items
+}
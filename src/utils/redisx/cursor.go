@@ -0,0 +1,81 @@
+package redisx
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidCursor 游标格式错误
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ScoreCursor ZSET 倒序滚动分页游标
+// Score 为上一页最后一条的分数，Offset 为该分数下已经返回的条数，用于跳过同分成员
+type ScoreCursor struct {
+	Score  float64
+	Offset int
+}
+
+// FirstScoreCursor 第一页游标，从最大分数开始
+func FirstScoreCursor() ScoreCursor {
+	return ScoreCursor{Score: math.Inf(1)}
+}
+
+// Max 作为 ZREVRANGEBYSCORE 的 max 参数
+func (c ScoreCursor) Max() string {
+	if math.IsInf(c.Score, 1) {
+		return "+inf"
+	}
+	return strconv.FormatFloat(c.Score, 'f', -1, 64)
+}
+
+// Encode 编码为对外暴露的不透明字符串
+func (c ScoreCursor) Encode() string {
+	raw := c.Max() + ":" + strconv.Itoa(c.Offset)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeScoreCursor 解析游标，空字符串表示第一页
+func DecodeScoreCursor(token string) (ScoreCursor, error) {
+	if token == "" {
+		return FirstScoreCursor(), nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return ScoreCursor{}, ErrInvalidCursor
+	}
+	scoreStr, offsetStr, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return ScoreCursor{}, ErrInvalidCursor
+	}
+	score, err := strconv.ParseFloat(scoreStr, 64)
+	if err != nil || math.IsNaN(score) {
+		return ScoreCursor{}, ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil || offset < 0 {
+		return ScoreCursor{}, ErrInvalidCursor
+	}
+	return ScoreCursor{Score: score, Offset: offset}, nil
+}
+
+// NextScoreCursor 根据本页结果计算下一页游标
+// 本页最后一个分数与上一游标相同时（整页都是同分成员），需要累加上一游标的 Offset
+func NextScoreCursor(prev ScoreCursor, page []redis.Z) ScoreCursor {
+	if len(page) == 0 {
+		return prev
+	}
+	last := page[len(page)-1].Score
+	count := 0
+	for i := len(page) - 1; i >= 0 && page[i].Score == last; i-- {
+		count++
+	}
+	if last == prev.Score {
+		count += prev.Offset
+	}
+	return ScoreCursor{Score: last, Offset: count}
+}
@@ -2,18 +2,50 @@ package redisx
 
 // Redis key 常量集中管理
 const (
-	LOGIN_CODE_KEY       = "login:code:"
-	CACHE_SHOP_KEY       = "cache:shop:"
-	CACHE_SHOP_LIST      = "shop:list"
-	CACHE_LOCK_KEY       = "shop:lock:"
-	SECKILL_STOCK_KEY    = "seckill:stock:"
-	BLOG_LIKE_KEY        = "blog:like:"
-	FOLLOW_USER_KEY      = "follow:"
-	FEED_KEY             = "feed:"
-	SHOP_GEO_KEY         = "shop:geo:"
-	USER_SIGN_KEY        = "sign:"
-	DISTRIBUTED_LOCK_KEY = "lock:voucher:"
-	UVKeyPrefix          = "uv:"
+	LOGIN_CODE_KEY          = "login:code:"
+	CACHE_SHOP_KEY          = "cache:shop:"
+	CACHE_SHOP_LIST         = "shop:list"
+	CACHE_LOCK_KEY          = "shop:lock:"
+	SECKILL_STOCK_KEY       = "seckill:stock:"
+	SECKILL_COUNT_KEY       = "seckill:count:"      // hash: userId -> 已购数量
+	SECKILL_META_KEY        = "seckill:meta:"       // hash: 秒杀时间、状态与购买限制
+	SECKILL_ORDER_KEY       = "seckill:order:"      // set: 旧版秒杀脚本记录的已购用户
+	SECKILL_SHOP_COUNT_KEY  = "seckill:shop:count:" // hash: userId -> 在该店铺已购数量
+	SECKILL_RELEASED_KEY    = "seckill:released:"   // string: 订单被拒绝后已归还 Redis 扣减的标记
+	BLOG_LIKE_KEY           = "blog:like:"
+	FOLLOW_USER_KEY         = "follow:"
+	FEED_KEY                = "feed:"
+	SHOP_GEO_KEY            = "shop:geo:"
+	USER_SIGN_KEY           = "sign:"
+	USER_SIGN_MAKEUP_KEY    = "sign:makeup:" // string: 某月已使用的补签次数
+	USER_SIGN_STAT_KEY      = "sign:stat:"   // hash: longest -> 最长连续签到天数
+	USER_LEVEL_LOCK_KEY     = "lock:user:level"
+	SECKILL_WARMUP_LOCK_KEY = "lock:seckill:warmup"
+	SECKILL_STOCK_LOCK_KEY  = "lock:seckill:stock:"
+	DISTRIBUTED_LOCK_KEY    = "lock:voucher:"
+	UVKeyPrefix             = "uv:"
+	REVIEW_HELPFUL_KEY      = "review:helpful:"
+	BLOG_PURGE_LOCK_KEY     = "lock:blog:purge"
+	BLOG_HOT_KEY            = "blog:hot"
+	BLOG_HOT_LOCK_KEY       = "lock:blog:hot"
+	BLOG_LIKE_DELTA_KEY     = "delta:blog:like" // hash: blogId -> 待写回的点赞增量
+	BLOG_LIKE_LOCK_KEY      = "lock:blog:like"
+	FEED_OUTBOX_KEY         = "feed:outbox:"    // zset: 作者发布的博客，大V的粉丝读时拉取
+	FEED_ACTIVE_KEY         = "feed:active"     // zset: userId -> 最近一次读 feed 的时间
+	FEED_CELEBRITY_KEY      = "feed:celebrity"  // set: 粉丝数超过阈值、只拉不推的作者
+	FEED_SYNC_BLOG_KEY      = "feed:sync:blog"  // set: authorId:blogId，推送队列已满时暂存，后台按 MySQL 状态补做
+	FEED_SYNC_FOLLOW_KEY    = "feed:sync:user"  // set: userId:authorId，关注任务队列已满时暂存，后台按 MySQL 关注关系补做
+	NOTIFY_UNREAD_KEY       = "notify:unread:"  // hash: 通知类型 -> 未读数
+	NOTIFY_ACTORS_KEY       = "notify:actors:"  // set: 聚合通知已计入的触发者
+	DM_UNREAD_KEY           = "dm:unread:"      // hash: peerId -> 来自该用户的未读私信数
+	DM_CHANNEL_KEY          = "dm:channel:"     // pub/sub: 新私信到达，唤醒长轮询
+	SCRIPT_REGISTRY_KEY     = "script:registry" // hash: name:v{version} -> 脚本 SHA1
+	SNOWFLAKE_WORKER_KEY    = "idgen:worker:"   // string: 雪花算法 workerId 的租约令牌
+	LOCK_FENCE_KEY          = "lock:fence:"     // string: 锁的 fencing token 计数器，只增不减
+	LOCK_CHANNEL_KEY        = "lock:channel:"   // pub/sub: 分布式锁释放，唤醒等待者
+	BLOOM_KEY               = "bf:"             // 布隆过滤器的 key 前缀，后接过滤器名称，结构见 utils.BloomFilter
+	BLOOM_LOCK_KEY          = "lock:bloom:"     // 后接过滤器名称，重建布隆过滤器的分布式锁
+	SNOWFLAKE_LAST_KEY      = "idgen:last:"     // string: workerId 最后生成 ID 的毫秒时间戳
 )
 
 const (
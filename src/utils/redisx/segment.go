@@ -0,0 +1,121 @@
+package redisx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DEFAULT_SEGMENT_STEP  int64 = 1000
+	segmentPrefetchFactor       = 5 // 剩余不足 step/5 时预取下一号段
+)
+
+// SegmentWorker 号段模式的 ID 生成器，每次用 INCRBY 预留 step 个当天序号，本地分配完再向 Redis 申请
+// 生成的 ID 与 RedisWorker 格式相同且共用序号 key，两者可以在不同实例上混用
+type SegmentWorker struct {
+	client   *redis.Client
+	step     int64
+	mu       sync.Mutex
+	segments map[string]*idSegment
+}
+
+// idSegment 某个业务当天的号段，[next, end] 为当前可用序号
+type idSegment struct {
+	mu        sync.Mutex
+	day       string
+	next      int64
+	end       int64
+	nextStart int64 // 预取的下一号段，nextEnd 为 0 表示没有
+	nextEnd   int64
+	loading   bool // 是否正在预取
+}
+
+func NewSegmentWorker(client *redis.Client, step int64) *SegmentWorker {
+	if step <= 0 {
+		step = DEFAULT_SEGMENT_STEP
+	}
+	return &SegmentWorker{
+		client:   client,
+		step:     step,
+		segments: make(map[string]*idSegment),
+	}
+}
+
+func (w *SegmentWorker) NextId(keyPrefix string) (int64, error) {
+	w.mu.Lock()
+	seg, ok := w.segments[keyPrefix]
+	if !ok {
+		seg = &idSegment{}
+		w.segments[keyPrefix] = seg
+	}
+	w.mu.Unlock()
+
+	now := time.Now()
+	key := idCountKey(keyPrefix, now)
+	day := now.Format("2006:01:02")
+
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
+
+	// 跨天后序号重新计数，旧号段作废
+	if seg.day != day {
+		seg.day = day
+		seg.next, seg.end = 0, 0
+		seg.nextStart, seg.nextEnd = 0, 0
+		seg.loading = false
+	}
+	if seg.next > seg.end || seg.end == 0 {
+		if seg.nextEnd != 0 {
+			seg.next, seg.end = seg.nextStart, seg.nextEnd
+			seg.nextStart, seg.nextEnd = 0, 0
+		} else {
+			start, end, err := w.reserve(key)
+			if err != nil {
+				return 0, err
+			}
+			seg.next, seg.end = start, end
+		}
+	}
+
+	count := seg.next
+	seg.next++
+	if seg.end-seg.next < w.step/segmentPrefetchFactor && seg.nextEnd == 0 && !seg.loading {
+		seg.loading = true
+		go w.prefetchSegment(seg, key, day)
+	}
+	return composeId(now, count), nil
+}
+
+// prefetchSegment 异步预取下一号段，期间跨天则丢弃
+func (w *SegmentWorker) prefetchSegment(seg *idSegment, key, day string) {
+	start, end, err := w.reserve(key)
+
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
+	if seg.day != day {
+		return
+	}
+	seg.loading = false
+	if err != nil {
+		logrus.Warnf("prefetch id segment %s failed: %v", key, err)
+		return
+	}
+	seg.nextStart, seg.nextEnd = start, end
+}
+
+// reserve 向 Redis 预留 step 个序号，返回闭区间 [start, end]
+func (w *SegmentWorker) reserve(key string) (int64, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	end, err := w.client.IncrBy(ctx, key, w.step).Result()
+	if err != nil {
+		return 0, 0, fmt.Errorf("reserve id segment %s: %w", key, err)
+	}
+	return end - w.step + 1, end, nil
+}
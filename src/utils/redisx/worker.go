@@ -6,6 +6,12 @@ import (
 	"time"
 )
 
+// IDGenerator 全局唯一 ID 生成器，keyPrefix 区分业务
+type IDGenerator interface {
+	NextId(keyPrefix string) (int64, error)
+}
+
+// RedisWorker 每个 ID 都通过 Redis INCR 取当天序号
 type RedisWorker struct{}
 
 // RedisWork 是全局ID生成器实例
@@ -18,17 +24,24 @@ const (
 
 func (*RedisWorker) NextId(keyPrefix string) (int64, error) {
 	now := time.Now()
-	nowSecond := now.UTC().Unix()
-	timeStamp := nowSecond - BEGIN_TIMESTAMP
-	format := now.Format("2006:01:02")
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	count, err := redis.GetRedisClient().Incr(ctx, "icr:"+keyPrefix+":"+format).Result()
+	count, err := redis.GetRedisClient().Incr(ctx, idCountKey(keyPrefix, now)).Result()
 	if err != nil {
 		return 0, err
 	}
 
-	return timeStamp<<COUNT_BITS | count, nil
+	return composeId(now, count), nil
+}
+
+// idCountKey 当天序号的 key，按天重置
+func idCountKey(keyPrefix string, now time.Time) string {
+	return "icr:" + keyPrefix + ":" + now.Format("2006:01:02")
+}
+
+// composeId 高位为相对 BEGIN_TIMESTAMP 的秒数，低 COUNT_BITS 位为当天序号
+func composeId(now time.Time, count int64) int64 {
+	timeStamp := now.UTC().Unix() - BEGIN_TIMESTAMP
+	return timeStamp<<COUNT_BITS | count
 }
@@ -0,0 +1,346 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/script"
+	"local-review-go/src/utils/redisx"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	redlockDriftFactor = 0.01                   // 时钟漂移按 TTL 的 1% 估算
+	redlockNodeTimeout = 100 * time.Millisecond // 单个节点的请求超时，远小于 TTL，避免卡在故障节点上
+	redlockRetryJitter = 50 * time.Millisecond  // 重试前的随机等待上限，错开同时竞争的实例
+)
+
+// RedLock 基于多个相互独立的 Redis 节点的分布式锁
+// 在多数节点上加锁成功，且扣除加锁耗时与时钟漂移后仍有剩余有效期才算获取成功，
+// 单个节点故障或主从切换不会让两个持有者同时持锁
+type RedLock struct {
+	clients []*redis.Client
+	quorum  int
+}
+
+func NewRedLock(clients ...*redis.Client) *RedLock {
+	return &RedLock{clients: clients, quorum: len(clients)/2 + 1}
+}
+
+// NewMutex 创建多节点的可重入互斥锁，语义同 DistributedLock.NewMutex
+func (rl *RedLock) NewMutex(key string, ttl time.Duration) Lock {
+	return &redMutex{rl: rl, key: key, token: uuid.New().String(), ttl: ttl, lost: notHeld}
+}
+
+// LockWithWatchDog 尝试获取一次互斥锁并由看门狗续期，获取成功时返回锁句柄
+func (rl *RedLock) LockWithWatchDog(ctx context.Context, key string, ttl time.Duration) (Lock, bool, error) {
+	m := rl.NewMutex(key, ttl)
+	acquired, err := m.TryLock(ctx)
+	if err != nil || !acquired {
+		return nil, false, err
+	}
+	return m, true, nil
+}
+
+// eachNode 并发在所有节点上执行 fn，每个节点单独限时
+func (rl *RedLock) eachNode(ctx context.Context, fn func(ctx context.Context, client *redis.Client) *redis.Cmd) []*redis.Cmd {
+	cmds := make([]*redis.Cmd, len(rl.clients))
+	var wg sync.WaitGroup
+	for i, client := range rl.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nodeCtx, cancel := context.WithTimeout(ctx, redlockNodeTimeout)
+			defer cancel()
+			cmds[i] = fn(nodeCtx, client)
+		}()
+	}
+	wg.Wait()
+	return cmds
+}
+
+// redMutex RedLock 的持有者，每个节点上的锁结构与 DistributedLock 相同
+type redMutex struct {
+	rl    *RedLock
+	key   string
+	token string
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	holds   int
+	fence   int64
+	lost    chan struct{}
+	stopDog context.CancelFunc
+}
+
+func (m *redMutex) Key() string {
+	return m.key
+}
+
+// Fence 多数节点上 fencing token 的最大值，获取成功后会把多数节点的计数器提升到该值，
+// 任意两个多数派至少有一个公共节点，因此后一次获取得到的值一定更大
+func (m *redMutex) Fence() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fence
+}
+
+// RaiseFence 在所有节点上提升 fencing token 计数器，少于多数节点成功时返回错误
+func (m *redMutex) RaiseFence(ctx context.Context, fence int64) error {
+	if raised, err := m.raiseFence(ctx, fence); raised < m.rl.quorum {
+		return fmt.Errorf("raise fence of redlock %s on %d nodes: %w", m.key, raised, err)
+	}
+	return nil
+}
+
+// raiseFence 返回计数器提升成功的节点数与失败节点的错误
+func (m *redMutex) raiseFence(ctx context.Context, fence int64) (int, error) {
+	cmds := m.rl.eachNode(ctx, func(ctx context.Context, client *redis.Client) *redis.Cmd {
+		return script.LockFenceRaise.Run(ctx, client, []string{redisx.LOCK_FENCE_KEY + m.key}, fence)
+	})
+	raised := 0
+	var errs []error
+	for i, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("node %d: %w", i, err))
+			continue
+		}
+		raised++
+	}
+	return raised, errors.Join(errs...)
+}
+
+func (m *redMutex) Lost() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lost
+}
+
+func (m *redMutex) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	return lostContext(parent, m.Lost())
+}
+
+func (m *redMutex) TryLock(ctx context.Context) (bool, error) {
+	acquired, _, err := m.tryAcquire(ctx)
+	return acquired, err
+}
+
+// Lock 阻塞获取锁，失败后随机等待一段时间重试，ctx 结束时返回 ErrLockTimeout
+func (m *redMutex) Lock(ctx context.Context) error {
+	for {
+		acquired, wait, err := m.tryAcquire(ctx)
+		if err != nil || acquired {
+			return err
+		}
+
+		timer := time.NewTimer(min(wait, lockMaxWait) + time.Duration(rand.Int63n(int64(redlockRetryJitter))))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w: %s: %w", ErrLockTimeout, m.key, ctx.Err())
+		}
+	}
+}
+
+// tryAcquire 在所有节点上加锁，未达到多数或有效期已耗尽时撤销本次加锁
+func (m *redMutex) tryAcquire(ctx context.Context) (bool, time.Duration, error) {
+	start := time.Now()
+	keys := []string{m.key, redisx.LOCK_FENCE_KEY + m.key}
+	cmds := m.rl.eachNode(ctx, func(ctx context.Context, client *redis.Client) *redis.Cmd {
+		return script.LockAcquire.Run(ctx, client, keys, m.token, m.ttl.Milliseconds(), lockModeWrite)
+	})
+
+	var (
+		acquired []int
+		failed   []int // 结果未知的节点，可能已经加锁成功
+		fence    int64
+		wait     time.Duration
+		errs     []error
+	)
+	for i, cmd := range cmds {
+		result, err := cmd.Int64Slice()
+		if err == nil && len(result) != 2 {
+			err = fmt.Errorf("unexpected result %v", result)
+		}
+		if err != nil {
+			failed = append(failed, i)
+			errs = append(errs, fmt.Errorf("node %d: %w", i, err))
+			continue
+		}
+		if result[0] == 1 {
+			acquired = append(acquired, i)
+			fence = max(fence, result[1])
+		} else {
+			wait = max(wait, time.Duration(result[1])*time.Millisecond)
+		}
+	}
+	if len(errs) == len(cmds) {
+		return false, 0, fmt.Errorf("acquire redlock %s: %w", m.key, errors.Join(errs...))
+	}
+
+	drift := time.Duration(float64(m.ttl)*redlockDriftFactor) + 2*time.Millisecond
+	validity := m.ttl - time.Since(start) - drift
+	if len(acquired) < m.rl.quorum || validity <= 0 {
+		m.undoAcquire(acquired, failed)
+		return false, max(wait, redlockRetryJitter), nil
+	}
+
+	// 多数节点的计数器都不小于 fence，后一次获取的多数派才一定能得到更大的值，否则放弃本次获取
+	if raised, err := m.raiseFence(ctx, fence); raised < m.rl.quorum {
+		m.undoAcquire(acquired, failed)
+		return false, 0, fmt.Errorf("raise fence of redlock %s on %d nodes: %w", m.key, raised, err)
+	}
+
+	m.mu.Lock()
+	m.holds++
+	m.fence = fence
+	if m.holds == 1 {
+		dogCtx, cancel := context.WithCancel(context.Background())
+		m.stopDog = cancel
+		m.lost = make(chan struct{})
+		go m.watchDog(dogCtx, m.lost)
+	}
+	m.mu.Unlock()
+	return true, 0, nil
+}
+
+// undoAcquire 撤销本次加锁，重入失败时只撤销确定加锁成功的节点，避免误删原本持有的锁
+func (m *redMutex) undoAcquire(acquired, failed []int) {
+	m.mu.Lock()
+	reentrant := m.holds > 0
+	m.mu.Unlock()
+	undo := acquired
+	if !reentrant {
+		undo = append(undo, failed...)
+	}
+	m.release(undo)
+}
+
+// release 撤销指定节点上的一次加锁
+func (m *redMutex) release(nodes []int) {
+	if len(nodes) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redlockNodeTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, i := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys := []string{m.key, redisx.LOCK_CHANNEL_KEY + m.key}
+			script.LockRelease.Run(ctx, m.rl.clients[i], keys, m.token, m.ttl.Milliseconds())
+		}()
+	}
+	wg.Wait()
+}
+
+// Unlock 在所有节点上释放一次锁，持有次数减到 0 时停止看门狗
+func (m *redMutex) Unlock(ctx context.Context) error {
+	keys := []string{m.key, redisx.LOCK_CHANNEL_KEY + m.key}
+	cmds := m.rl.eachNode(ctx, func(ctx context.Context, client *redis.Client) *redis.Cmd {
+		return script.LockRelease.Run(ctx, client, keys, m.token, m.ttl.Milliseconds())
+	})
+
+	var (
+		notHeldNodes int
+		errs         []error
+	)
+	for i, cmd := range cmds {
+		result, err := cmd.Int()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("node %d: %w", i, err))
+			continue
+		}
+		if result == -1 {
+			notHeldNodes++
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if notHeldNodes == len(cmds) {
+		m.stopWatchDog()
+		return ErrLockNotHeld
+	}
+	m.holds--
+	if m.holds <= 0 {
+		m.stopWatchDog()
+	}
+	if len(errs) > 0 {
+		// 未释放的节点由 TTL 兜底
+		logrus.Warnf("release redlock %s on some nodes failed: %v", m.key, errors.Join(errs...))
+	}
+	return nil
+}
+
+// stopWatchDog 调用方需持有 m.mu
+func (m *redMutex) stopWatchDog() {
+	m.holds = 0
+	m.fence = 0
+	m.lost = notHeld
+	if m.stopDog != nil {
+		m.stopDog()
+		m.stopDog = nil
+	}
+}
+
+// watchDog 在所有节点上续期，多数节点明确不再持有或超过有效期未能在多数节点续期时关闭 lost
+func (m *redMutex) watchDog(ctx context.Context, lost chan struct{}) {
+	ticker := time.NewTicker(m.ttl / 3)
+	defer ticker.Stop()
+	renewedAt := time.Now()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			cmds := m.rl.eachNode(ctx, func(ctx context.Context, client *redis.Client) *redis.Cmd {
+				return script.LockOwnerRenew.Run(ctx, client, []string{m.key}, m.token, m.ttl.Milliseconds())
+			})
+			if ctx.Err() != nil {
+				return
+			}
+
+			renewed, notHeldNodes := 0, 0
+			for _, cmd := range cmds {
+				result, err := cmd.Int()
+				if err != nil {
+					continue
+				}
+				if result == 1 {
+					renewed++
+				} else {
+					notHeldNodes++
+				}
+			}
+			if renewed >= m.rl.quorum {
+				renewedAt = now
+				continue
+			}
+			if notHeldNodes > len(cmds)-m.rl.quorum {
+				logrus.Warnf("锁已丢失: key=%s, 续期成功节点数=%d", m.key, renewed)
+				close(lost)
+				return
+			}
+			logrus.Warnf("锁续期失败: key=%s, 续期成功节点数=%d", m.key, renewed)
+			// 下次续期前锁就会过期
+			if now.Sub(renewedAt) >= m.ttl*2/3 {
+				logrus.Warnf("锁已过期: key=%s", m.key)
+				close(lost)
+				return
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
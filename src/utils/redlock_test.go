@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"local-review-go/script"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func setupRedLock(t *testing.T, n int) ([]*miniredis.Miniredis, *RedLock) {
+	t.Helper()
+	nodes := make([]*miniredis.Miniredis, n)
+	clients := make([]*redis.Client, n)
+	for i := range nodes {
+		nodes[i] = miniredis.RunT(t)
+		clients[i] = redis.NewClient(&redis.Options{Addr: nodes[i].Addr(), MaxRetries: -1})
+		t.Cleanup(func() { clients[i].Close() })
+	}
+	return nodes, NewRedLock(clients...)
+}
+
+func TestRedLockMajority(t *testing.T) {
+	nodes, rl := setupRedLock(t, 3)
+	ctx := context.Background()
+
+	// 一个节点故障时仍能在多数节点上加锁
+	nodes[2].Close()
+	lock, ok, err := rl.LockWithWatchDog(ctx, "lock:red", 10*time.Second)
+	if err != nil || !ok {
+		t.Fatalf("lock with one node down = %v, %v", ok, err)
+	}
+	if ok, _ := rl.NewMutex("lock:red", 10*time.Second).TryLock(ctx); ok {
+		t.Fatal("another owner acquired a held redlock")
+	}
+	fence := lock.Fence()
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	for _, node := range nodes[:2] {
+		if node.Exists("lock:red") {
+			t.Fatal("lock not released on a node")
+		}
+	}
+
+	again, ok, err := rl.LockWithWatchDog(ctx, "lock:red", 10*time.Second)
+	if err != nil || !ok {
+		t.Fatalf("relock = %v, %v", ok, err)
+	}
+	if again.Fence() <= fence {
+		t.Fatalf("fence not increasing: %d after %d", again.Fence(), fence)
+	}
+	again.Unlock(ctx)
+}
+
+func TestRedLockMinority(t *testing.T) {
+	nodes, rl := setupRedLock(t, 3)
+	ctx := context.Background()
+
+	// 另一个持有者已占用一个节点，且一个节点故障，无法达到多数
+	nodes[0].HSet("lock:red", "mode", "write", "other", "1")
+	nodes[2].Close()
+	if ok, _ := rl.NewMutex("lock:red", 10*time.Second).TryLock(ctx); ok {
+		t.Fatal("acquired redlock without a majority")
+	}
+	// 未达到多数时撤销已成功的节点
+	if nodes[1].Exists("lock:red") {
+		t.Fatal("partial lock not rolled back")
+	}
+}
+
+// failFenceRaise 让节点上提升 fencing token 计数器的脚本执行失败
+type failFenceRaise struct{}
+
+func (failFenceRaise) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (failFenceRaise) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func (failFenceRaise) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		for _, arg := range cmd.Args() {
+			if arg == script.LockFenceRaise.Hash() {
+				cmd.SetErr(errors.New("fence raise failed"))
+				return cmd.Err()
+			}
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func TestRedLockFenceRaiseMinority(t *testing.T) {
+	nodes, rl := setupRedLock(t, 3)
+	ctx := context.Background()
+
+	// 加锁成功但只有少数节点提升了计数器时放弃本次获取
+	rl.clients[0].AddHook(failFenceRaise{})
+	rl.clients[1].AddHook(failFenceRaise{})
+	if ok, err := rl.NewMutex("lock:red", 10*time.Second).TryLock(ctx); err == nil || ok {
+		t.Fatalf("lock with fence raised on a minority = %v, %v, want error", ok, err)
+	}
+	for i, node := range nodes {
+		if node.Exists("lock:red") {
+			t.Fatalf("lock left on node %d", i)
+		}
+	}
+}
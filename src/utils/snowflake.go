@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"local-review-go/script"
+	"local-review-go/src/utils/redisx"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// 雪花 ID：1 位符号 + 41 位毫秒时间戳 + 10 位 workerId + 12 位序号
+const (
+	// SNOWFLAKE_EPOCH_MILLI 2023-01-01 UTC，比 RedisWorker 的起始时间早一年，
+	// 约 20 年内雪花 ID 总大于 RedisWorker 已生成的 ID，切换生成器不会与历史订单冲突
+	SNOWFLAKE_EPOCH_MILLI int64 = 1672531200000
+
+	snowflakeWorkerBits   = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxWorker    = 1<<snowflakeWorkerBits - 1
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+
+	snowflakeLeaseTTL     = 30 * time.Second
+	snowflakeHeartbeat    = snowflakeLeaseTTL / 3
+	snowflakeMaxBackwards = 5 * time.Millisecond // 时钟回拨不超过该值时等待追平，否则拒绝生成
+)
+
+var (
+	ErrNoWorkerId      = errors.New("没有可用的 workerId")
+	ErrWorkerLeaseLost = errors.New("workerId 租约已失效")
+	ErrClockBackwards  = errors.New("时钟回拨")
+)
+
+// SnowflakeWorker 本地生成 ID 的雪花算法实现，workerId 从 Redis 租用并由心跳续期
+// 租约在心跳失败超过 TTL 后视为失效，此时拒绝生成 ID 并尝试重新租用
+type SnowflakeWorker struct {
+	client *redis.Client
+
+	mu         sync.Mutex
+	workerId   int64 // -1 表示当前没有租约
+	token      string
+	leaseUntil time.Time
+	lastMilli  int64
+	sequence   int64
+
+	// 生成 ID 时读取的时钟与等待方式，测试中替换以模拟时钟回拨
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	cancel context.CancelFunc
+}
+
+// NewSnowflakeWorker 租用一个 workerId 并启动心跳
+func NewSnowflakeWorker(ctx context.Context, client *redis.Client) (*SnowflakeWorker, error) {
+	w := &SnowflakeWorker{client: client, workerId: -1, now: time.Now, sleep: time.Sleep}
+	if err := w.lease(ctx); err != nil {
+		return nil, err
+	}
+	hbCtx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	go w.heartbeat(hbCtx)
+	return w, nil
+}
+
+func snowflakeWorkerKey(workerId int64) string {
+	return redisx.SNOWFLAKE_WORKER_KEY + strconv.FormatInt(workerId, 10)
+}
+
+func snowflakeLastKey(workerId int64) string {
+	return redisx.SNOWFLAKE_LAST_KEY + strconv.FormatInt(workerId, 10)
+}
+
+// WorkerId 当前租用的 workerId，没有租约时为 -1
+func (w *SnowflakeWorker) WorkerId() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.workerId
+}
+
+// NextId 生成雪花 ID，keyPrefix 仅为满足 IDGenerator 接口，ID 全局唯一
+func (w *SnowflakeWorker) NextId(string) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.workerId < 0 || time.Now().After(w.leaseUntil) {
+		return 0, ErrWorkerLeaseLost
+	}
+
+	now := w.now().UnixMilli()
+	if now < w.lastMilli {
+		backwards := time.Duration(w.lastMilli-now) * time.Millisecond
+		if backwards > snowflakeMaxBackwards {
+			return 0, fmt.Errorf("%w: %s", ErrClockBackwards, backwards)
+		}
+		w.sleep(backwards)
+		now = w.now().UnixMilli()
+		if now < w.lastMilli {
+			return 0, fmt.Errorf("%w: %dms", ErrClockBackwards, w.lastMilli-now)
+		}
+	}
+
+	if now == w.lastMilli {
+		w.sequence = (w.sequence + 1) & snowflakeMaxSequence
+		if w.sequence == 0 {
+			// 本毫秒序号用完，等到下一毫秒
+			for now <= w.lastMilli {
+				w.sleep(100 * time.Microsecond)
+				now = w.now().UnixMilli()
+			}
+		}
+	} else {
+		w.sequence = 0
+	}
+	w.lastMilli = now
+
+	return (now-SNOWFLAKE_EPOCH_MILLI)<<(snowflakeWorkerBits+snowflakeSequenceBits) |
+		w.workerId<<snowflakeSequenceBits | w.sequence, nil
+}
+
+// lease 从随机位置开始依次尝试租用空闲的 workerId，
+// 并读取该 workerId 上次使用的时间戳，避免重启后时钟落后生成重复 ID
+func (w *SnowflakeWorker) lease(ctx context.Context) error {
+	token := uuid.New().String()
+	leasedAt := time.Now()
+	start := rand.Int63n(snowflakeMaxWorker + 1)
+	for i := int64(0); i <= snowflakeMaxWorker; i++ {
+		id := (start + i) & snowflakeMaxWorker
+		ok, err := w.client.SetNX(ctx, snowflakeWorkerKey(id), token, snowflakeLeaseTTL).Result()
+		if err != nil {
+			return fmt.Errorf("lease snowflake worker id: %w", err)
+		}
+		if !ok {
+			continue
+		}
+
+		last, err := w.client.Get(ctx, snowflakeLastKey(id)).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			script.LockUnlock.Run(ctx, w.client, []string{snowflakeWorkerKey(id)}, token)
+			return fmt.Errorf("get last timestamp of worker %d: %w", id, err)
+		}
+
+		w.mu.Lock()
+		w.workerId = id
+		w.token = token
+		w.leaseUntil = leasedAt.Add(snowflakeLeaseTTL)
+		w.lastMilli = max(w.lastMilli, last)
+		w.mu.Unlock()
+		logrus.Infof("snowflake worker id %d leased", id)
+		return nil
+	}
+	return ErrNoWorkerId
+}
+
+func (w *SnowflakeWorker) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(snowflakeHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.renew(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// renew 续期租约并记录最后使用的时间戳，租约已被他人占用时重新租用
+func (w *SnowflakeWorker) renew(ctx context.Context) {
+	w.mu.Lock()
+	id, token, last := w.workerId, w.token, w.lastMilli
+	w.mu.Unlock()
+
+	if id < 0 {
+		if err := w.lease(ctx); err != nil {
+			logrus.Warnf("re-lease snowflake worker id failed: %v", err)
+		}
+		return
+	}
+
+	renewedAt := time.Now()
+	renewed, err := script.LockRenew.Run(ctx, w.client, []string{snowflakeWorkerKey(id)},
+		token, int(snowflakeLeaseTTL/time.Second)).Int()
+	if err != nil {
+		logrus.Warnf("renew snowflake worker id %d failed: %v", id, err)
+		return
+	}
+	if renewed == 0 {
+		logrus.Warnf("snowflake worker id %d lease lost", id)
+		w.mu.Lock()
+		if w.workerId == id {
+			w.workerId = -1
+		}
+		w.mu.Unlock()
+		if err := w.lease(ctx); err != nil {
+			logrus.Warnf("re-lease snowflake worker id failed: %v", err)
+		}
+		return
+	}
+
+	w.mu.Lock()
+	if w.workerId == id {
+		w.leaseUntil = renewedAt.Add(snowflakeLeaseTTL)
+	}
+	w.mu.Unlock()
+	if err := w.client.Set(ctx, snowflakeLastKey(id), last, 0).Err(); err != nil {
+		logrus.Warnf("save last timestamp of worker %d failed: %v", id, err)
+	}
+}
+
+// Close 停止心跳，记录最后使用的时间戳并释放 workerId
+func (w *SnowflakeWorker) Close(ctx context.Context) error {
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.mu.Lock()
+	id, token, last := w.workerId, w.token, w.lastMilli
+	w.workerId = -1
+	w.mu.Unlock()
+	if id < 0 {
+		return nil
+	}
+
+	if err := w.client.Set(ctx, snowflakeLastKey(id), last, 0).Err(); err != nil {
+		return fmt.Errorf("save last timestamp of worker %d: %w", id, err)
+	}
+	return script.LockUnlock.Run(ctx, w.client, []string{snowflakeWorkerKey(id)}, token).Err()
+}